@@ -26,18 +26,21 @@ type BatteryInfoCmd struct {
 }
 
 func (cmd *BatteryInfoCmd) Run(globals *Globals) error {
-	portOptions := &common.PortOptions{
+	portOptions, err := common.ParseAddress(&common.PortOptions{
 		Address:     cmd.Address,
 		Mode:        &serial.Mode{BaudRate: int(cmd.BaudRate)},
 		Type:        common.DeviceTypeFromString[cmd.DeviceType],
 		ReadTimeout: cmd.ReadTimeout,
+	})
+	if err != nil {
+		return err
 	}
 	battery, err := bms.Instance(string(cmd.BMSType))
 	if err != nil {
 		return fmt.Errorf("failed to create BMS instance: %w", err)
 	}
 	if cmd.Protocol == "auto" {
-		cmd.Protocol = battery.DefaultProtocol(cmd.DeviceType)
+		cmd.Protocol = battery.DefaultProtocol(portOptions.Type.String())
 	}
 	port, err := common.OpenPort(portOptions)
 	if err != nil {
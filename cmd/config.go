@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"wombatt/internal/config"
+)
+
+type ConfigCmd struct {
+	Validate ConfigValidateCmd `cmd:"" help:"Checks a configuration file for the monitor command"`
+}
+
+type ConfigValidateCmd struct {
+	File string `arg:"" type:"existingfile" help:"Configuration file to check"`
+}
+
+func (cmd *ConfigValidateCmd) Run(globals *Globals, ctx context.Context) error {
+	cfg, err := config.Load(cmd.File)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d buses, %d devices\n", cmd.File, len(cfg.Buses), len(cfg.Devices))
+	return nil
+}
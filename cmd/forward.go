@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"time"
 
 	"wombatt/internal/common"
+	"wombatt/internal/sniffer"
 
 	"go.bug.st/serial"
 )
@@ -18,6 +20,7 @@ type ForwardCmd struct {
 	Subordinate string `name:"subordinate-port" required:"" help:"Serial port or address of the subordinate device"`
 	BaudRate    uint   `short:"B" default:"9600" help:"Baud rate"`
 	DeviceType  string `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
+	Decode      bool   `help:"Split the data into frames and decode them instead of logging raw data"`
 }
 
 func (cmd *ForwardCmd) Run(globals *Globals) error {
@@ -34,6 +37,7 @@ type Forward struct {
 
 	controller  common.Port
 	subordinate common.Port
+	decoder     *sniffer.Decoder
 }
 
 func NewForward(cmd *ForwardCmd) *Forward {
@@ -60,6 +64,9 @@ func (f *Forward) Init() error {
 		return err
 	}
 	f.subordinate = port
+	if f.Decode {
+		f.decoder = sniffer.NewDecoder(os.Stdout)
+	}
 	return nil
 }
 
@@ -78,13 +85,17 @@ func (f *Forward) RunForever() {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	readWrite := func(from, to common.Port, fname, tname string) {
+	readWrite := func(from, to common.Port, fname, tname string, dir sniffer.Direction) {
 		data, err := read(from)
 		if err != nil {
 			reopenOnError(err, from, fname, "reading")
 			return
 		}
-		slog.Info("writing data", "file", fname, "data", hex.EncodeToString(data))
+		if f.decoder != nil {
+			f.decoder.Add(dir, data)
+		} else {
+			slog.Info("writing data", "file", fname, "data", hex.EncodeToString(data))
+		}
 		_, err = to.Write(data)
 		if err != nil {
 			reopenOnError(err, to, tname, "writing")
@@ -94,11 +105,11 @@ func (f *Forward) RunForever() {
 
 	go func() {
 		for {
-			readWrite(f.controller, f.subordinate, filepath.Base(f.Controller), f.Subordinate)
+			readWrite(f.controller, f.subordinate, filepath.Base(f.Controller), f.Subordinate, sniffer.Request)
 		}
 	}()
 
 	for {
-		readWrite(f.subordinate, f.controller, filepath.Base(f.Subordinate), f.Controller)
+		readWrite(f.subordinate, f.controller, filepath.Base(f.Subordinate), f.Controller, sniffer.Response)
 	}
 }
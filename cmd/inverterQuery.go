@@ -36,7 +36,7 @@ type InverterQueryCmd struct {
 	ReadTimeout  time.Duration `short:"t" default:"5s" help:"Per inverter timeout for processing all the commands being sent"`
 	DeviceType   string        `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
 	InverterType InverterType  `short:"I" default:"pi30" enum:"pi30,solark,eg4_18kpv,eg4_6000xp" help:"Type of inverter protocol (pi30, solark, eg4_18kpv, eg4_6000xp)"`
-	Protocol     string        `short:"R" default:"auto" enum:"ModbusRTU,ModbusTCP,auto" help:"Modbus protocol (auto, ModbusRTU, ModbusTCP)"`
+	Protocol     string        `short:"R" default:"auto" enum:"ModbusRTU,ModbusTCP,ModbusRTUoverTCP,ModbusASCII,auto" help:"Modbus protocol (auto, ModbusRTU, ModbusTCP, ModbusRTUoverTCP, ModbusASCII)"`
 	ModbusID     int           `short:"i" default:"1" help:"Modbus slave ID"`
 }
 
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
+
+	"go.bug.st/serial"
+)
+
+type ModbusGatewayCmd struct {
+	ListenAddress string        `short:"L" required:"" help:"Address to listen on for Modbus TCP clients. <IP>:<Port>, i.e., 0.0.0.0:502"`
+	Address       string        `short:"p" required:"" help:"Port or TCP address of the Modbus RTU devices"`
+	BaudRate      uint          `short:"B" default:"9600" help:"Baud rate"`
+	DeviceType    string        `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
+	ReadTimeout   time.Duration `short:"t" default:"500ms" help:"Timeout when reading from the Modbus RTU devices"`
+}
+
+func (cmd *ModbusGatewayCmd) Run(globals *Globals, ctx context.Context) error {
+	portOptions := &common.PortOptions{
+		Address:     cmd.Address,
+		Mode:        &serial.Mode{BaudRate: int(cmd.BaudRate)},
+		Type:        common.DeviceTypeFromString[cmd.DeviceType],
+		ReadTimeout: cmd.ReadTimeout,
+	}
+	port, err := common.OpenPort(portOptions)
+	if err != nil {
+		return fmt.Errorf("failed to open port: %w", err)
+	}
+	defer port.Close()
+
+	l, err := net.Listen("tcp", cmd.ListenAddress)
+	if err != nil {
+		return err
+	}
+	slog.Info("forwarding Modbus TCP requests", "listen-address", l.Addr(), "address", cmd.Address)
+	return modbus.NewGateway(port).ServeTCP(ctx, l)
+}
@@ -22,8 +22,8 @@ type ModbusReadCmd struct {
 	Address          string `short:"p" required:"" help:"Port or TCP address used for communication"`
 	ID               uint8  `required:"" help:"Device ID"`
 	Start            uint16 `required:"" help:"Start address of the first register to read"`
-	Count            uint8  `required:"" help:"Number of registers to read"`
-	RegisterType     string `default:"holding" help:"valid values are 'input' or 'holding'"`
+	Count            uint16 `required:"" help:"Number of registers, coils or discrete inputs to read"`
+	RegisterType     string `default:"holding" enum:"holding,input,coil,discrete" help:"valid values are 'holding', 'input', 'coil' or 'discrete'"`
 	BaudRate         uint   `short:"B" default:"9600" help:"Baud rate"`
 	Protocol         string `default:"auto" enum:"${protocols}" help:"One of ${protocols}"`
 	DeviceType       string `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
@@ -32,7 +32,8 @@ type ModbusReadCmd struct {
 }
 
 func (cmd *ModbusReadCmd) Help() string {
-	return `The registers read are written as a hexadecimal dump. For a custom
+	return `The registers read are written as a hexadecimal dump. Coils and
+	discrete inputs are written one per line with their address. For a custom
 	output, use the '-o' or '--output-format. The format syntax is a
 	comma-separated list:
 
@@ -81,12 +82,19 @@ func (cmd *ModbusReadCmd) Run(globals *Globals) error {
 	if cmd.ID == 0 || cmd.ID > 247 {
 		log.Fatal("id must be between 1 and 247")
 	}
-	if cmd.Count > 125 {
+	bits := cmd.RegisterType == "coil" || cmd.RegisterType == "discrete"
+	if bits && cmd.Count > modbus.MaxReadBits {
+		log.Fatalf("count must be <= %d", modbus.MaxReadBits)
+	}
+	if !bits && cmd.Count > 125 {
 		log.Fatal("count must be <= 125")
 	}
 	if cmd.OutputFormat != "" && cmd.OutputFormatFile != "" {
 		log.Fatal("only one of -o and -O can be used")
 	}
+	if bits && (cmd.OutputFormat != "" || cmd.OutputFormatFile != "") {
+		log.Fatal("output formats can't be used with coils or discrete inputs")
+	}
 	if cmd.OutputFormatFile != "" {
 		f, err := readOutputFormatFile(cmd.OutputFormatFile)
 		if err != nil {
@@ -108,11 +116,14 @@ func (cmd *ModbusReadCmd) Run(globals *Globals) error {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	if bits {
+		return cmd.readBits(reader)
+	}
 	readFunc := reader.ReadHoldingRegisters
 	if cmd.RegisterType == "input" {
 		readFunc = reader.ReadInputRegisters
 	}
-	data, err := readFunc(cmd.ID, cmd.Start, cmd.Count)
+	data, err := readFunc(cmd.ID, cmd.Start, uint8(cmd.Count))
 	if err != nil {
 		slog.Error("error reading registers", "address", cmd.Address, "error", err)
 		log.Fatal(err.Error())
@@ -127,6 +138,31 @@ func (cmd *ModbusReadCmd) Run(globals *Globals) error {
 	return nil
 }
 
+func (cmd *ModbusReadCmd) readBits(reader modbus.RegisterReader) error {
+	br, ok := reader.(modbus.BitReader)
+	if !ok {
+		log.Fatalf("protocol %v does not support reading coils or discrete inputs", cmd.Protocol)
+	}
+	readFunc := br.ReadCoils
+	if cmd.RegisterType == "discrete" {
+		readFunc = br.ReadDiscreteInputs
+	}
+	values, err := readFunc(cmd.ID, cmd.Start, cmd.Count)
+	if err != nil {
+		slog.Error("error reading bits", "address", cmd.Address, "error", err)
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("%v ID#%d:\n", cmd.Address, cmd.ID)
+	for i, v := range values {
+		state := "off"
+		if v {
+			state = "on"
+		}
+		fmt.Printf("%d: %s\n", int(cmd.Start)+i, state)
+	}
+	return nil
+}
+
 func readOutputFormatFile(fileName string) (string, error) {
 	data, err := os.ReadFile(fileName)
 	if err != nil {
@@ -150,6 +186,24 @@ func readOutputFormatFile(fileName string) (string, error) {
 }
 
 func printRegisters(format string, data []byte) error {
+	fields, err := parseFormatFields(format)
+	if err != nil {
+		return err
+	}
+
+	inst, err := createStruct(fields, data)
+	if err != nil {
+		log.Fatalf("%v: check the output format syntax\n", err.Error())
+	}
+	if err := printStruct(inst); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return nil
+}
+
+// parseFormatFields converts an output format string into the fields of a struct.
+func parseFormatFields(format string) ([]reflect.StructField, error) {
 	var fields []reflect.StructField
 	for ii, v := range strings.Split(format, ",") {
 		s := strings.TrimSpace(v)
@@ -166,7 +220,7 @@ func printRegisters(format string, data []byte) error {
 			case 0: // type
 				t, err = parseFieldType(f)
 				if err != nil {
-					return err
+					return nil, err
 				}
 			case 1: // name
 				name = toTitleCase(f)
@@ -183,7 +237,7 @@ func printRegisters(format string, data []byte) error {
 					tag = fmt.Sprintf(`type:"%s" %s`, f, tag)
 				}
 			default:
-				return fmt.Errorf("too many colons in '%s'", s)
+				return nil, fmt.Errorf("too many colons in '%s'", s)
 			}
 		}
 		pkgPath := ""
@@ -197,16 +251,7 @@ func printRegisters(format string, data []byte) error {
 			PkgPath: pkgPath,
 		})
 	}
-
-	inst, err := createStruct(fields, data)
-	if err != nil {
-		log.Fatalf("%v: check the output format syntax\n", err.Error())
-	}
-	if err := printStruct(inst); err != nil {
-		log.Fatal(err.Error())
-	}
-
-	return nil
+	return fields, nil
 }
 
 func printStruct(inst any) (err error) {
@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
+
+	"go.bug.st/serial"
+)
+
+type ModbusWriteCmd struct {
+	Address         string   `short:"p" required:"" help:"Port or TCP address used for communication"`
+	ID              uint8    `required:"" help:"Device ID"`
+	Start           uint16   `required:"" help:"Start address of the first register or coil to write"`
+	Values          []string `arg:"" required:"" help:"Values to write"`
+	RegisterType    string   `default:"holding" enum:"holding,coil" help:"valid values are 'holding' or 'coil'"`
+	Multiple        bool     `help:"Always use the write multiple functions, even for a single value"`
+	Verify          bool     `help:"Read back the values written and compare them"`
+	DryRun          bool     `help:"Print the request frame in hexadecimal instead of sending it"`
+	BaudRate        uint     `short:"B" default:"9600" help:"Baud rate"`
+	Protocol        string   `default:"auto" enum:"${protocols}" help:"One of ${protocols}"`
+	DeviceType      string   `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
+	InputFormat     string   `short:"f" help:"Input format for the values to write"`
+	InputFormatFile string   `short:"F" help:"Input format file for the values to write"`
+}
+
+func (cmd *ModbusWriteCmd) Help() string {
+	return `Without an input format, every value is written to one 16-bit
+	register. Values can be decimal, hexadecimal (0x prefix) or negative,
+	in which case they are written as 16-bit signed integers. Use '--'
+	before the values when any of them is negative.
+
+	When writing coils, the values are one of 1, 0, on, off, true or false.
+
+	For typed values, use the '-f' or '--input-format' option. The format
+	syntax is the same one used by modbus-read for its output format:
+
+			<type>[:[<name>][:[<unit>][:[<multiplier>][:[<string>]]]]]
+
+	Each field takes one value, or one value per element for arrays, except
+	for byte arrays with the 'string' tag, which take a single string value.
+	Fields named '_' take no value and are written as zeros.
+
+	Values for fields with a multiplier are given in <unit>, and are divided
+	by the multiplier before being written. The resulting data must be a
+	whole number of registers.
+
+	The same comma-separated values for the -f option can be read from a file,
+	one line per register, with comments starting with the '#' character.
+	To read formatting values from a file, use the -F option.
+
+	With TCP devices, set --protocol to ModbusTCP or ModbusRTUoverTCP. The framing
+	is not probed with writes, as a retry with the other framing could write the
+	values twice.
+
+	Example input format values:
+		u16:Voltage:V:0.01 -- one register that takes a value in V and writes it
+			in 10mV units. E.g., a value of 53.2 is written as 5320.
+
+		i32,[2]u16 -- 3 values: a signed 32-bit integer using 2 registers,
+			followed by 2 unsigned 16-bit registers.
+
+	`
+}
+
+func (cmd *ModbusWriteCmd) Run(globals *Globals) error {
+	if cmd.ID == 0 || cmd.ID > 247 {
+		log.Fatal("id must be between 1 and 247")
+	}
+	if cmd.InputFormat != "" && cmd.InputFormatFile != "" {
+		log.Fatal("only one of -f and -F can be used")
+	}
+	if cmd.InputFormat != "" || cmd.InputFormatFile != "" {
+		if cmd.RegisterType == "coil" {
+			log.Fatal("input formats can't be used with coils")
+		}
+	}
+	if cmd.InputFormatFile != "" {
+		f, err := readOutputFormatFile(cmd.InputFormatFile)
+		if err != nil {
+			log.Fatalf("error reading input format file '%v': %v", cmd.InputFormatFile, err)
+		}
+		cmd.InputFormat = f
+	}
+
+	var registers []uint16
+	var coils []bool
+	var err error
+	if cmd.RegisterType == "coil" {
+		coils, err = parseCoilValues(cmd.Values)
+	} else {
+		registers, err = encodeRegisterValues(cmd.InputFormat, cmd.Values)
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(registers) > modbus.MaxWriteRegisters {
+		log.Fatalf("too many registers to write: %d (max %d)", len(registers), modbus.MaxWriteRegisters)
+	}
+	if len(coils) > modbus.MaxWriteCoils {
+		log.Fatalf("too many coils to write: %d (max %d)", len(coils), modbus.MaxWriteCoils)
+	}
+
+	if cmd.DryRun {
+		// Write the request to a buffer instead of the device. There's nothing to
+		// read back, so the error about the missing response is ignored.
+		var frame bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(nil), &frame, common.DeviceTypeFromString[cmd.DeviceType])
+		writer, err := modbus.Writer(port, cmd.Protocol)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		_ = cmd.write(writer, registers, coils)
+		fmt.Printf("%v ID#%d: %s\n", cmd.Address, cmd.ID, hex.EncodeToString(frame.Bytes()))
+		return nil
+	}
+
+	portOptions := &common.PortOptions{
+		Address: cmd.Address,
+		Mode:    &serial.Mode{BaudRate: int(cmd.BaudRate)},
+		Type:    common.DeviceTypeFromString[cmd.DeviceType],
+	}
+	port, err := common.OpenPort(portOptions)
+	if err != nil {
+		return fmt.Errorf("failed to open port: %w", err)
+	}
+	defer port.Close()
+	writer, err := modbus.Writer(port, cmd.Protocol)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := cmd.write(writer, registers, coils); err != nil {
+		slog.Error("error writing", "address", cmd.Address, "error", err)
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("%v ID#%d: wrote %d %s value(s) starting at %d\n", cmd.Address, cmd.ID, len(registers)+len(coils), cmd.RegisterType, cmd.Start)
+	if !cmd.Verify {
+		return nil
+	}
+	if err := cmd.verify(writer, registers, coils); err != nil {
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("%v ID#%d: verified\n", cmd.Address, cmd.ID)
+	return nil
+}
+
+func (cmd *ModbusWriteCmd) write(writer modbus.RegisterWriter, registers []uint16, coils []bool) error {
+	switch {
+	case len(coils) == 1 && !cmd.Multiple:
+		return writer.WriteSingleCoil(cmd.ID, cmd.Start, coils[0])
+	case len(coils) > 0:
+		return writer.WriteMultipleCoils(cmd.ID, cmd.Start, coils)
+	case len(registers) == 1 && !cmd.Multiple:
+		return writer.WriteSingleRegister(cmd.ID, cmd.Start, registers[0])
+	default:
+		return writer.WriteMultipleRegisters(cmd.ID, cmd.Start, registers)
+	}
+}
+
+func (cmd *ModbusWriteCmd) verify(writer modbus.RegisterWriter, registers []uint16, coils []bool) error {
+	reader, ok := writer.(modbus.RegisterReader)
+	if !ok {
+		return fmt.Errorf("unable to read back values")
+	}
+	if len(coils) > 0 {
+		br, ok := writer.(modbus.BitReader)
+		if !ok {
+			return fmt.Errorf("unable to read back coils")
+		}
+		read, err := br.ReadCoils(cmd.ID, cmd.Start, uint16(len(coils)))
+		if err != nil {
+			return fmt.Errorf("error reading back coils: %w", err)
+		}
+		if !slices.Equal(read, coils) {
+			return fmt.Errorf("verification failed: read %v, wrote %v", read, coils)
+		}
+		return nil
+	}
+	data, err := reader.ReadHoldingRegisters(cmd.ID, cmd.Start, uint8(len(registers)))
+	if err != nil {
+		return fmt.Errorf("error reading back registers: %w", err)
+	}
+	want := make([]byte, 0, len(registers)*2)
+	for _, r := range registers {
+		want = binary.BigEndian.AppendUint16(want, r)
+	}
+	if !bytes.Equal(data, want) {
+		return fmt.Errorf("verification failed: read %s, wrote %s", hex.EncodeToString(data), hex.EncodeToString(want))
+	}
+	return nil
+}
+
+// parseCoilValues converts the command line values into coil states.
+func parseCoilValues(values []string) ([]bool, error) {
+	var coils []bool
+	for _, v := range values {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "1", "on", "true":
+			coils = append(coils, true)
+		case "0", "off", "false":
+			coils = append(coils, false)
+		default:
+			return nil, fmt.Errorf("invalid coil value: %q", v)
+		}
+	}
+	return coils, nil
+}
+
+// encodeRegisterValues converts the command line values into register values, using the
+// given input format if it's not empty.
+func encodeRegisterValues(format string, values []string) ([]uint16, error) {
+	var data []byte
+	if format == "" {
+		for _, v := range values {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 0, 32)
+			if err != nil || n < math.MinInt16 || n > math.MaxUint16 {
+				return nil, fmt.Errorf("invalid register value: %q", v)
+			}
+			data = binary.BigEndian.AppendUint16(data, uint16(n))
+		}
+	} else {
+		var err error
+		if data, err = encodeStruct(format, values); err != nil {
+			return nil, err
+		}
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("the input format has an odd number of bytes (%d)", len(data))
+	}
+	registers := make([]uint16, len(data)/2)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return registers, nil
+}
+
+// encodeStruct fills a struct created from the input format with the values given and
+// returns its binary representation.
+func encodeStruct(format string, values []string) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data = nil
+			err = fmt.Errorf("%v: check the input format syntax", r)
+		}
+	}()
+	fields, err := parseFormatFields(format)
+	if err != nil {
+		return nil, err
+	}
+	inst := reflect.New(reflect.StructOf(fields)).Elem()
+	next := 0
+	nextValue := func(name string) (string, error) {
+		if next >= len(values) {
+			return "", fmt.Errorf("missing value for %s", name)
+		}
+		next++
+		return strings.TrimSpace(values[next-1]), nil
+	}
+	for i, f := range fields {
+		if f.Name == "_" {
+			continue
+		}
+		v := inst.Field(i)
+		mult := f.Tag.Get("multiplier")
+		switch {
+		case f.Type.Kind() == reflect.Array && f.Tag.Get("type") == "string":
+			s, err := nextValue(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if len(s) > v.Len() {
+				return nil, fmt.Errorf("string too long for %s: %d bytes (max %d)", f.Name, len(s), v.Len())
+			}
+			reflect.Copy(v, reflect.ValueOf([]byte(s)))
+		case f.Type.Kind() == reflect.Array:
+			for k := range v.Len() {
+				s, err := nextValue(f.Name)
+				if err != nil {
+					return nil, err
+				}
+				if err := setFieldValue(v.Index(k), s, mult); err != nil {
+					return nil, fmt.Errorf("%s[%d]: %w", f.Name, k, err)
+				}
+			}
+		default:
+			s, err := nextValue(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if err := setFieldValue(v, s, mult); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+	}
+	if next != len(values) {
+		return nil, fmt.Errorf("too many values: got %d, the input format takes %d", len(values), next)
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, inst.Interface()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setFieldValue parses 's' and sets the integer field 'v' with it. If there's a multiplier,
+// 's' is in display units and is divided by the multiplier.
+func setFieldValue(v reflect.Value, s string, multiplier string) error {
+	var n float64
+	if multiplier != "" {
+		m, err := strconv.ParseFloat(multiplier, 64)
+		if err != nil || m == 0 {
+			return fmt.Errorf("invalid multiplier: %q", multiplier)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value: %q", s)
+		}
+		n = math.Round(f / m)
+	} else {
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value: %q", s)
+		}
+		n = float64(i)
+	}
+	switch {
+	case v.CanInt():
+		if v.OverflowInt(int64(n)) {
+			return fmt.Errorf("value out of range: %s", s)
+		}
+		v.SetInt(int64(n))
+	case v.CanUint():
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value out of range: %s", s)
+		}
+		v.SetUint(uint64(n))
+	default:
+		return fmt.Errorf("unsupported type: %v", v.Type())
+	}
+	return nil
+}
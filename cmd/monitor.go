@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wombatt/internal/bms"
+	"wombatt/internal/common"
+	"wombatt/internal/config"
+	"wombatt/internal/modbus"
+	"wombatt/internal/mqttha"
+	"wombatt/internal/web"
+)
+
+type MonitorCmd struct {
+	MQTTFlags         `embed:""`
+	ModbusServerFlags `embed:""`
+
+	File string `arg:"" optional:"" type:"existingfile" help:"Configuration file with the buses and devices to monitor. The other flags are only used without it"`
+
+	Batteries []string `name:"battery" sep:"none" help:"<address>,<bms_type>,<id1[:id2...]>,<mqtt_prefix>[,<setting>=<value>...]. E.g. /dev/ttyUSB0,EG4LLv2,1:2:3,eg4. The settings are baud-rate, data-bits, stop-bits, parity, device-type, protocol and read-timeout"`
+	Inverters []string `name:"inverter" sep:"none" help:"Inverter to monitor, as in monitor-inverters. E.g. /dev/ttyS0,Q1:QPIGS,pi30_1,pi30 or 192.168.1.40:502,RealtimeData,eg4_1,eg4_18kpv,device-type=tcp,modbus-id=1"`
+
+	PollInterval     time.Duration `short:"P" default:"10s" help:"Time to wait between polling cycles"`
+	WebServerAddress string        `short:"w" help:"Address to use for serving HTTP. <IP>:<Port>, i.e., 127.0.0.1:8080"`
+}
+
+// siteMonitor has what is shared by all the devices in a configuration file.
+type siteMonitor struct {
+	client      *mqttha.Client
+	broker      string
+	topicPrefix string
+	webServer   *web.Server
+	image       *modbus.RegisterImage
+}
+
+func (cmd *MonitorCmd) Run(globals *Globals, ctx context.Context) error {
+	cfg, err := cmd.config()
+	if err != nil {
+		return err
+	}
+	m := &siteMonitor{}
+	if cfg.MQTT != nil {
+		m.client, err = mqttha.Connect(cfg.MQTT.Broker, cfg.MQTT.User, cfg.MQTT.Password)
+		if err != nil {
+			log.Fatalf("error connecting to MQTT broker at %s: %v\n", cfg.MQTT.Broker, err)
+		}
+		defer m.client.Disconnect(250)
+		m.broker = cfg.MQTT.Broker
+		m.topicPrefix = cfg.MQTT.TopicPrefix
+	}
+	if cfg.Web != nil {
+		m.webServer = web.NewServer(cfg.Web.Address, "/")
+		if err := m.webServer.Start(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer func() {
+			slog.Info("shutting down web server...")
+			sdCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = m.webServer.Shutdown(sdCtx)
+		}()
+	}
+	if cfg.ModbusServer != nil {
+		flags := &ModbusServerFlags{
+			ModbusServerAddress:    cfg.ModbusServer.Address,
+			ModbusServerDeviceType: cfg.ModbusServer.DeviceType,
+			ModbusServerBaudRate:   uint(cfg.ModbusServer.BaudRate),
+		}
+		m.image, err = flags.startModbusServer(ctx)
+		if err != nil {
+			log.Fatalf("error starting Modbus server: %v\n", err)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, d := range cfg.Devices {
+		wg.Go(func() {
+			switch d.Kind {
+			case config.BatteryKind:
+				m.monitorBatteries(ctx, d)
+			case config.InverterKind:
+				m.monitorInverter(ctx, d)
+			}
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// monitorBatteries reads the information from the batteries in 'd' every polling cycle.
+func (m *siteMonitor) monitorBatteries(ctx context.Context, d *config.Device) {
+	battery, err := bms.Instance(d.Model)
+	if err != nil {
+		slog.Error("failed to create BMS instance", "device", d.Name, "error", err)
+		return
+	}
+	portOptions, err := d.PortOptions()
+	if err != nil {
+		slog.Error("invalid connection settings", "device", d.Name, "error", err)
+		return
+	}
+	cmd := &MonitorBatteriesCmd{
+		Address:     d.Address,
+		ReadTimeout: d.ReadTimeout,
+		BMSType:     d.Model,
+		MQTTPrefix:  d.MQTTPrefix,
+		Protocol:    d.Protocol,
+	}
+	for _, id := range d.IDs {
+		cmd.ID = append(cmd.ID, uint(id))
+	}
+	if cmd.Protocol == modbus.AutoProtocol {
+		cmd.Protocol = battery.DefaultProtocol(portOptions.Type.String())
+	}
+	var image *modbus.RegisterImage
+	if d.HasOutput(config.ModbusServerOutput) {
+		image = m.image
+	}
+
+	var ch chan *batteryInfo
+	if d.HasOutput(config.MQTTOutput) || d.HasOutput(config.WebOutput) {
+		var mqttChannel chan *batteryInfo
+		if d.HasOutput(config.MQTTOutput) {
+			cmd.MQTTBroker = m.broker
+			cmd.MQTTTopicPrefix = m.topicPrefix
+			mqttChannel = make(chan *batteryInfo, len(cmd.ID))
+			go mqttPublish(ctx, m.client, mqttChannel, cmd, battery.InfoInstance())
+		}
+		var webServer *web.Server
+		if d.HasOutput(config.WebOutput) {
+			webServer = m.webServer
+		}
+		ch = make(chan *batteryInfo, len(cmd.ID))
+		defer close(ch)
+		go dispatchBatteryInfo(ctx, ch, mqttChannel, webServer, d.Name+"/")
+	}
+
+	for {
+		port, err := common.AcquirePort(ctx, portOptions)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("failed to open port", "device", d.Name, "address", d.Address, "error", err)
+		} else {
+			monitorBatteries(ctx, ch, d.HasOutput(config.StdoutOutput), port, cmd, battery, image)
+			port.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+// monitorInverter runs the commands of the inverter in 'd' every polling cycle.
+func (m *siteMonitor) monitorInverter(ctx context.Context, d *config.Device) {
+	im := &inverterMonitor{
+		Device:       d.Address,
+		Commands:     d.Commands,
+		MQTTTag:      d.MQTTPrefix,
+		InverterType: d.Model,
+		ModbusID:     d.IDs[0],
+		BaudRate:     d.BaudRate,
+		DataBits:     d.DataBits,
+		StopBits:     d.StopBits,
+		Parity:       d.Parity,
+		DeviceType:   d.DeviceType,
+		Protocol:     d.Protocol,
+		ReadTimeout:  d.ReadTimeout,
+		webPage:      d.Name,
+	}
+	if d.HasOutput(config.MQTTOutput) {
+		im.client = m.client
+		invertersDiscoveryConfig(ctx, m.topicPrefix, []*inverterMonitor{im})
+	}
+	if d.HasOutput(config.WebOutput) {
+		im.webServer = m.webServer
+	}
+	if d.HasOutput(config.ModbusServerOutput) {
+		ctx = modbus.ContextWithImage(ctx, m.image)
+	}
+
+	portOptions, err := d.PortOptions()
+	if err != nil {
+		slog.Error("invalid connection settings", "device", d.Name, "error", err)
+		return
+	}
+	for {
+		var r *cmdResponse
+		port, err := common.AcquirePort(ctx, portOptions)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("error opening device", "device", d.Name, "address", d.Address, "error", err)
+		} else {
+			r = im.poll(ctx, port, d.ReadTimeout)
+			port.Close()
+		}
+		if r != nil {
+			r.ValidateResponses()
+			r.Publish(ctx, m.topicPrefix, 0)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+// config returns the configuration in the file, or the one for the flags if there is no file.
+func (cmd *MonitorCmd) config() (*config.Config, error) {
+	if cmd.File != "" {
+		if len(cmd.Batteries) > 0 || len(cmd.Inverters) > 0 {
+			return nil, fmt.Errorf("--battery and --inverter can't be used with a configuration file")
+		}
+		return config.Load(cmd.File)
+	}
+	if len(cmd.Batteries) == 0 && len(cmd.Inverters) == 0 {
+		return nil, fmt.Errorf("need a configuration file, or at least one --battery or --inverter")
+	}
+	cfg := &config.Config{PollInterval: cmd.PollInterval}
+	if cmd.MQTTBroker != "" {
+		cfg.MQTT = &config.MQTT{
+			Broker:      cmd.MQTTBroker,
+			User:        cmd.MQTTUser,
+			Password:    cmd.MQTTPassword,
+			TopicPrefix: cmd.MQTTTopicPrefix,
+		}
+	}
+	if cmd.WebServerAddress != "" {
+		cfg.Web = &config.Web{Address: cmd.WebServerAddress}
+	}
+	if cmd.ModbusServerAddress != "" {
+		cfg.ModbusServer = &config.ModbusServer{
+			Address:    cmd.ModbusServerAddress,
+			DeviceType: cmd.ModbusServerDeviceType,
+			BaudRate:   int(cmd.ModbusServerBaudRate),
+		}
+	}
+	for _, arg := range cmd.Batteries {
+		d, err := batteryDevice(arg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Devices = append(cfg.Devices, d)
+	}
+	monitors, err := getMonitors(cmd.Inverters, &MonitorInvertersCmd{ModbusID: 1})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range monitors {
+		cfg.Devices = append(cfg.Devices, &config.Device{
+			Name:       m.MQTTTag,
+			Kind:       config.InverterKind,
+			Model:      m.InverterType,
+			Connection: m.connection(),
+			IDs:        []uint8{m.ModbusID},
+			Commands:   m.Commands,
+		})
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// batteryDevice returns the device for a --battery argument.
+func batteryDevice(arg string) (*config.Device, error) {
+	p := strings.Split(arg, ",")
+	if len(p) < 4 {
+		return nil, fmt.Errorf("invalid battery argument: '%s'. Expected <address>,<bms_type>,<id1[:id2...]>,<mqtt_prefix>[,<setting>=<value>...]", arg)
+	}
+	var ids []uint8
+	for s := range strings.SplitSeq(p[2], ":") {
+		id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid battery ID in '%s': %w", arg, err)
+		}
+		ids = append(ids, uint8(id))
+	}
+	// The settings are the ones of the inverters, except for the Modbus ID.
+	m := &inverterMonitor{Device: p[0]}
+	for _, setting := range p[4:] {
+		if strings.HasPrefix(setting, "modbus-id=") {
+			return nil, fmt.Errorf("invalid setting in '%s': unknown setting: 'modbus-id'", arg)
+		}
+		if err := m.setSetting(setting); err != nil {
+			return nil, fmt.Errorf("invalid setting in '%s': %w", arg, err)
+		}
+	}
+	return &config.Device{
+		Name:       p[3],
+		Kind:       config.BatteryKind,
+		Model:      p[1],
+		Connection: m.connection(),
+		IDs:        ids,
+	}, nil
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -19,7 +20,8 @@ import (
 )
 
 type MonitorBatteriesCmd struct {
-	MQTTFlags `embed:""`
+	MQTTFlags         `embed:""`
+	ModbusServerFlags `embed:""`
 
 	Address  string `short:"p" required:"" help:"Serial port attached to the batteries"`
 	BaudRate uint   `short:"B" default:"9600" help:"Baud rate for serial ports"`
@@ -61,8 +63,17 @@ func (cmd *MonitorBatteriesCmd) Run(globals *Globals, ctx context.Context) error
 	if err != nil {
 		return fmt.Errorf("failed to create BMS instance: %w", err)
 	}
+	portOptions, err := common.ParseAddress(&common.PortOptions{
+		Address:     cmd.Address,
+		Mode:        &serial.Mode{BaudRate: int(cmd.BaudRate)},
+		Type:        common.DeviceTypeFromString[cmd.DeviceType],
+		ReadTimeout: cmd.ReadTimeout,
+	})
+	if err != nil {
+		return err
+	}
 	if cmd.Protocol == "auto" {
-		cmd.Protocol = battery.DefaultProtocol(cmd.DeviceType)
+		cmd.Protocol = battery.DefaultProtocol(portOptions.Type.String())
 	}
 	var mqttChannel chan *batteryInfo
 	if cmd.MQTTBroker != "" {
@@ -74,51 +85,29 @@ func (cmd *MonitorBatteriesCmd) Run(globals *Globals, ctx context.Context) error
 		defer client.Disconnect(250)
 		go mqttPublish(ctx, client, mqttChannel, cmd, battery.InfoInstance())
 	}
-	if webServer == nil && mqttChannel == nil {
-		log.Fatalf("need at least MQTT or web server argument to publish info to.\n")
+	image, err := cmd.startModbusServer(ctx)
+	if err != nil {
+		log.Fatalf("error starting Modbus server: %v\n", err)
+	}
+	if webServer == nil && mqttChannel == nil && image == nil {
+		log.Fatalf("need at least MQTT, web server or Modbus server argument to publish info to.\n")
 	}
 	ch := make(chan *batteryInfo, len(cmd.ID))
 	defer close(ch)
-	go func() {
-		defer func() {
-			if mqttChannel != nil {
-				close(mqttChannel)
-			}
-		}()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case bi, ok := <-ch:
-				if !ok {
-					return
-				}
-				if mqttChannel != nil {
-					mqttChannel <- bi
-				}
-				if webServer != nil {
-					webServer.Publish(fmt.Sprintf("%d", bi.ID), bi.Info)
-				}
-			}
-		}
-	}()
-	portOptions := &common.PortOptions{
-		Address:     cmd.Address,
-		Mode:        &serial.Mode{BaudRate: int(cmd.BaudRate)},
-		Type:        common.DeviceTypeFromString[cmd.DeviceType],
-		ReadTimeout: cmd.ReadTimeout,
-	}
-
+	go dispatchBatteryInfo(ctx, ch, mqttChannel, webServer, "")
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			port, err := common.OpenPort(portOptions)
+			port, err := common.AcquirePort(ctx, portOptions)
 			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 				slog.Error("failed to open port", "address", cmd.Address, "error", err)
 			} else {
-				monitorBatteries(ctx, ch, port, cmd, battery)
+				monitorBatteries(ctx, ch, false, port, cmd, battery, image)
 				port.Close()
 			}
 			select {
@@ -130,12 +119,43 @@ func (cmd *MonitorBatteriesCmd) Run(globals *Globals, ctx context.Context) error
 	}
 }
 
-func monitorBatteries(ctx context.Context, ch chan *batteryInfo, port common.Port, cmd *MonitorBatteriesCmd, battery bms.BMS) {
+// dispatchBatteryInfo sends the information received from 'ch' to 'mqttChannel' and 'webServer', which can be nil.
+// The web pages are named after the battery ID, with 'webPage' as prefix. 'mqttChannel' is closed when done.
+func dispatchBatteryInfo(ctx context.Context, ch, mqttChannel chan *batteryInfo, webServer *web.Server, webPage string) {
+	defer func() {
+		if mqttChannel != nil {
+			close(mqttChannel)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case bi, ok := <-ch:
+			if !ok {
+				return
+			}
+			if mqttChannel != nil {
+				mqttChannel <- bi
+			}
+			if webServer != nil {
+				webServer.Publish(fmt.Sprintf("%s%d", webPage, bi.ID), bi.Info)
+			}
+		}
+	}
+}
+
+// monitorBatteries reads the batteries in 'cmd' once. The information read is sent to 'ch' if it is
+// not nil, and printed if 'stdout' is set.
+func monitorBatteries(ctx context.Context, ch chan *batteryInfo, stdout bool, port common.Port, cmd *MonitorBatteriesCmd, battery bms.BMS, image *modbus.RegisterImage) {
 	reader, err := modbus.Reader(port, cmd.Protocol, string(cmd.BMSType))
 	if err != nil {
 		slog.Error("error creating modbus reader", "error", err)
 		return
 	}
+	if modbus.IsModbusProtocol(cmd.Protocol) {
+		reader = modbus.NewImageReader(reader, image)
+	}
 	slog.Info("fetching info from batteries", "battery-id", cmd.ID)
 	success := []uint{}
 	for _, id := range cmd.ID {
@@ -147,15 +167,22 @@ func monitorBatteries(ctx context.Context, ch chan *batteryInfo, port common.Por
 			if ctx.Err() != nil {
 				return
 			}
-			if err := port.ReopenWithBackoff(); err != nil {
-				slog.Error("error reopening", "error", err)
+			// AcquirePort reconnects the port before the next turn if it failed.
+			slog.Warn("error reading battery info", "battery-id", id, "error", err)
+			if errors.Is(err, bms.ErrTimeout) {
+				// Ends the read left running, so that it doesn't take the next responses.
+				if err := common.AbandonRead(port); err != nil {
+					slog.Error("error resetting port", "address", cmd.Address, "error", err)
+					return
+				}
 			}
 			time.Sleep(50 * time.Millisecond)
 			continue
 		}
 		if ch != nil {
 			ch <- &batteryInfo{uint8(id), info}
-		} else {
+		}
+		if stdout {
 			fmt.Printf("Battery #%d\n===========\n", id)
 			writeBatteryInfo(info)
 			fmt.Println()
@@ -6,13 +6,17 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"wombatt/internal/common"
+	"wombatt/internal/config"
 	"wombatt/internal/eg4_18kpv"
 	"wombatt/internal/eg4_6000xp"
+	"wombatt/internal/modbus"
 	"wombatt/internal/mqttha"
 	"wombatt/internal/pi30"
 	"wombatt/internal/solark"
@@ -20,7 +24,8 @@ import (
 )
 
 type MonitorInvertersCmd struct {
-	MQTTFlags `embed:""`
+	MQTTFlags         `embed:""`
+	ModbusServerFlags `embed:""`
 
 	BaudRate     uint          `short:"B" default:"2400" help:"Baud rate for serial ports"`
 	DataBits     int           `help:"Number of data bits for serial port" default:"8"`
@@ -29,12 +34,12 @@ type MonitorInvertersCmd struct {
 	PollInterval time.Duration `short:"P" default:"10s" help:"Time to wait between polling cycles"`
 	ReadTimeout  time.Duration `short:"t" default:"5s" help:"Timeout when reading from devices"`
 
-	Monitors []string `arg:"" required:"" help:"<device>,<command1[:command2:command3...]>,<mqtt_prefix>[,<inverter_type>]. E.g. /dev/ttyS0,QPIRI:QPGS1,eg4_1,pi30 or /dev/ttyUSB0,RealtimeData:IntrinsicAttributes,solark_1,solark or /dev/ttyUSB0,RealtimeData,eg4_18kpv_1,eg4_18kpv or /dev/ttyUSB0,RealtimeData,eg4_6000xp_1,eg4_6000xp. Valid solark commands are RealtimeData and IntrinsicAttributes. Valid eg4_18kpv/eg4_6000xp commands are RealtimeData."`
+	Monitors []string `arg:"" required:"" help:"<device>,<command1[:command2:command3...]>,<mqtt_prefix>[,<inverter_type>[,<setting>=<value>...]]. E.g. /dev/ttyS0,QPIRI:QPGS1,eg4_1,pi30 or /dev/ttyUSB0,RealtimeData:IntrinsicAttributes,solark_1,solark or /dev/ttyUSB0,RealtimeData,eg4_18kpv_1,eg4_18kpv or /dev/ttyUSB0,RealtimeData,eg4_6000xp_1,eg4_6000xp. Valid solark commands are RealtimeData and IntrinsicAttributes. Valid eg4_18kpv/eg4_6000xp commands are RealtimeData. The settings override the flags with the same name for that inverter: modbus-id, baud-rate, data-bits, stop-bits, parity, device-type, protocol and read-timeout. E.g. /dev/ttyUSB1,RealtimeData,eg4_2,eg4_18kpv,modbus-id=2."`
 
 	WebServerAddress string `short:"w" help:"Address to use for serving HTTP. <IP>:<Port>, i.e., 127.0.0.1:8080"`
 
 	DeviceType string `short:"T" default:"serial" enum:"${device_types}" help:"One of ${device_types}"`
-	Protocol   string `short:"R" default:"auto" enum:"ModbusRTU,ModbusTCP,auto" help:"Modbus protocol (auto, ModbusRTU, ModbusTCP)"`
+	Protocol   string `short:"R" default:"auto" enum:"ModbusRTU,ModbusTCP,ModbusRTUoverTCP,ModbusASCII,auto" help:"Modbus protocol (auto, ModbusRTU, ModbusTCP, ModbusRTUoverTCP, ModbusASCII)"`
 	ModbusID   int    `short:"i" default:"1" help:"Modbus slave ID (only used for solark, eg4_18kpv, and eg4_6000xp inverters)"`
 }
 
@@ -46,7 +51,7 @@ func (cmd *MonitorInvertersCmd) Run(globals *Globals, ctx context.Context) error
 		return fmt.Errorf("invalid modbus ID: %d", cmd.ModbusID)
 	}
 
-	monitors, err := getMonitors(cmd.Monitors)
+	monitors, err := getMonitors(cmd.Monitors, cmd)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -73,6 +78,11 @@ func (cmd *MonitorInvertersCmd) Run(globals *Globals, ctx context.Context) error
 			_ = webServer.Shutdown(sdCtx)
 		}()
 	}
+	image, err := cmd.startModbusServer(ctx)
+	if err != nil {
+		log.Fatalf("error starting Modbus server: %v\n", err)
+	}
+	ctx = modbus.ContextWithImage(ctx, image)
 	for _, m := range monitors {
 		m.client = client
 		m.webServer = webServer
@@ -86,8 +96,19 @@ type inverterMonitor struct {
 	MQTTTag      string
 	InverterType string // New field to differentiate inverter types
 
+	// Connection settings, from the flags unless set for this inverter.
+	ModbusID    uint8
+	BaudRate    int
+	DataBits    int
+	StopBits    int
+	Parity      string
+	DeviceType  string
+	Protocol    string
+	ReadTimeout time.Duration
+
 	client    *mqttha.Client
 	webServer *web.Server
+	webPage   string // Prefix for the pages in webServer. The position of the inverter if empty.
 }
 
 func runInverterMonitor(ctx context.Context, cmd *MonitorInvertersCmd, monitors []*inverterMonitor) error {
@@ -115,49 +136,17 @@ func runInverterMonitor(ctx context.Context, cmd *MonitorInvertersCmd, monitors
 					if ctx.Err() != nil {
 						return
 					}
-					port, err := common.NewPort(m.Device, cmd.DeviceType, int(cmd.BaudRate), cmd.DataBits, cmd.StopBits, cmd.Parity)
+					port, err := m.acquirePort(ctx)
 					if err != nil {
+						if ctx.Err() != nil {
+							return
+						}
 						slog.Error("error opening device", "device", m.Device, "error", err)
 						responses[i] = &cmdResponse{nil, []error{err}, m}
 						return
 					}
 					defer port.Close()
-					ctx_to, cancel := context.WithTimeout(ctx, cmd.ReadTimeout)
-					defer cancel()
-
-					var results []any
-					var errors []error
-
-					slog.Info("fetching info from inverter", "inverter-name", m.Device, "inverter-type", m.InverterType, "commands", m.Commands)
-
-					switch m.InverterType {
-					case "pi30":
-						results, errors = pi30.RunCommands(ctx_to, port, m.Commands)
-					case "solark":
-						// For Solark, the supported commands are "RealtimeData" and "IntrinsicAttributes".
-						results, errors = solark.RunCommands(ctx_to, port, cmd.Protocol, uint8(cmd.ModbusID), m.Commands)
-					case "eg4_18kpv":
-						results, errors = eg4_18kpv.RunCommands(ctx_to, port, cmd.Protocol, uint8(cmd.ModbusID), m.Commands)
-					case "eg4_6000xp":
-						results, errors = eg4_6000xp.RunCommands(ctx_to, port, cmd.Protocol, uint8(cmd.ModbusID), m.Commands)
-					default:
-						errors = append(errors, fmt.Errorf("unknown inverter type: %s", m.InverterType))
-					}
-
-					if ctx.Err() != nil {
-						return
-					}
-
-					responses[i] = &cmdResponse{results, errors, m}
-
-					okCommands := []string{}
-					for k := range errors {
-						if errors[k] != nil {
-							continue
-						}
-						okCommands = append(okCommands, m.Commands[k])
-					}
-					slog.Info("publishing info from inverter", "inverter-name", m.Device, "commands", okCommands)
+					responses[i] = m.poll(ctx, port, m.ReadTimeout)
 				}(i, m)
 			}
 			wg.Wait()
@@ -181,6 +170,51 @@ func runInverterMonitor(ctx context.Context, cmd *MonitorInvertersCmd, monitors
 	}
 }
 
+// poll runs the commands of the inverter on 'port'. It returns nil if the context is canceled.
+func (m *inverterMonitor) poll(ctx context.Context, port common.Port, readTimeout time.Duration) *cmdResponse {
+	ctx_to, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var results []any
+	var errors []error
+
+	slog.Info("fetching info from inverter", "inverter-name", m.Device, "inverter-type", m.InverterType, "commands", m.Commands)
+
+	switch m.InverterType {
+	case "pi30":
+		results, errors = pi30.RunCommands(ctx_to, port, m.Commands)
+	case "solark":
+		// For Solark, the supported commands are "RealtimeData" and "IntrinsicAttributes".
+		results, errors = solark.RunCommands(ctx_to, port, m.Protocol, m.ModbusID, m.Commands)
+	case "eg4_18kpv":
+		results, errors = eg4_18kpv.RunCommands(ctx_to, port, m.Protocol, m.ModbusID, m.Commands)
+	case "eg4_6000xp":
+		results, errors = eg4_6000xp.RunCommands(ctx_to, port, m.Protocol, m.ModbusID, m.Commands)
+	default:
+		errors = append(errors, fmt.Errorf("unknown inverter type: %s", m.InverterType))
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if ctx_to.Err() != nil {
+		// A command timed out and may have left a read running.
+		if err := common.AbandonRead(port); err != nil {
+			slog.Error("error resetting port", "inverter-name", m.Device, "error", err)
+		}
+	}
+
+	okCommands := []string{}
+	for k := range errors {
+		if errors[k] != nil {
+			continue
+		}
+		okCommands = append(okCommands, m.Commands[k])
+	}
+	slog.Info("publishing info from inverter", "inverter-name", m.Device, "commands", okCommands)
+	return &cmdResponse{results, errors, m}
+}
+
 type cmdResponse struct {
 	Responses []any
 	Errors    []error
@@ -208,7 +242,11 @@ func (r *cmdResponse) Publish(ctx context.Context, topicPrefix string, cmdIndex
 			continue
 		}
 		if m.webServer != nil {
-			m.webServer.Publish(fmt.Sprintf("%d/%s", cmdIndex+1, m.Commands[ic]), ir)
+			page := m.webPage
+			if page == "" {
+				page = fmt.Sprintf("%d", cmdIndex+1)
+			}
+			m.webServer.Publish(fmt.Sprintf("%s/%s", page, m.Commands[ic]), ir)
 		}
 	}
 
@@ -340,12 +378,12 @@ func (im *inverterMonitor) publishToMQTT(ctx context.Context, mqttTopicPrefix st
 	}
 }
 
-func getMonitors(args []string) ([]*inverterMonitor, error) {
+func getMonitors(args []string, cmd *MonitorInvertersCmd) ([]*inverterMonitor, error) {
 	var monitors []*inverterMonitor
 	for _, arg := range args {
-		p := strings.SplitN(arg, ",", 4) // Increased split limit to 4 for inverter type
+		p := strings.Split(arg, ",")
 		if len(p) < 3 {
-			return nil, fmt.Errorf("invalid inverter argument: '%s'. Expected <device>,<commands>,<mqtt_prefix>[,<inverter_type>]", arg)
+			return nil, fmt.Errorf("invalid inverter argument: '%s'. Expected <device>,<commands>,<mqtt_prefix>[,<inverter_type>[,<setting>=<value>...]]", arg)
 		}
 		dev := p[0]
 		var cmds []string
@@ -367,12 +405,97 @@ func getMonitors(args []string) ([]*inverterMonitor, error) {
 		if inverterType != "pi30" && inverterType != "solark" && inverterType != "eg4_18kpv" && inverterType != "eg4_6000xp" {
 			return nil, fmt.Errorf("invalid inverter type: '%s'. Must be 'pi30', 'solark', 'eg4_18kpv' or 'eg4_6000xp'", inverterType)
 		}
-		monitors = append(monitors, &inverterMonitor{
+		m := &inverterMonitor{
 			Device:       dev,
 			Commands:     cmds,
 			MQTTTag:      prefix,
 			InverterType: inverterType,
-		})
+			ModbusID:     uint8(cmd.ModbusID),
+			BaudRate:     int(cmd.BaudRate),
+			DataBits:     cmd.DataBits,
+			StopBits:     cmd.StopBits,
+			Parity:       cmd.Parity,
+			DeviceType:   cmd.DeviceType,
+			Protocol:     cmd.Protocol,
+			ReadTimeout:  cmd.ReadTimeout,
+		}
+		if len(p) > 4 {
+			for _, setting := range p[4:] {
+				if err := m.setSetting(setting); err != nil {
+					return nil, fmt.Errorf("invalid setting in '%s': %w", arg, err)
+				}
+			}
+		}
+		monitors = append(monitors, m)
 	}
 	return monitors, nil
 }
+
+// acquirePort waits for the turn to use the port of the inverter, which is shared with the other
+// inverters at the same address. Closing the port ends the turn.
+func (m *inverterMonitor) acquirePort(ctx context.Context) (common.Port, error) {
+	conn := m.connection()
+	opts, err := conn.PortOptions()
+	if err != nil {
+		return nil, err
+	}
+	return common.AcquirePort(ctx, opts)
+}
+
+// connection returns the connection settings of the inverter.
+func (m *inverterMonitor) connection() config.Connection {
+	return config.Connection{
+		Address:     m.Device,
+		DeviceType:  m.DeviceType,
+		BaudRate:    m.BaudRate,
+		DataBits:    m.DataBits,
+		StopBits:    m.StopBits,
+		Parity:      m.Parity,
+		Protocol:    m.Protocol,
+		ReadTimeout: m.ReadTimeout,
+	}
+}
+
+// setSetting sets a connection setting given as <name>=<value>, where name is the name of the flag.
+func (m *inverterMonitor) setSetting(setting string) error {
+	name, value, ok := strings.Cut(setting, "=")
+	if !ok {
+		return fmt.Errorf("'%s': expected <setting>=<value>", setting)
+	}
+	var err error
+	switch name {
+	case "modbus-id":
+		var id uint64
+		id, err = strconv.ParseUint(value, 10, 8)
+		m.ModbusID = uint8(id)
+	case "baud-rate":
+		m.BaudRate, err = strconv.Atoi(value)
+	case "data-bits":
+		m.DataBits, err = strconv.Atoi(value)
+	case "stop-bits":
+		m.StopBits, err = strconv.Atoi(value)
+	case "parity":
+		m.Parity = value
+	case "device-type":
+		if _, ok := common.DeviceTypeFromString[value]; !ok {
+			return fmt.Errorf("invalid device type: '%s'", value)
+		}
+		m.DeviceType = value
+	case "protocol":
+		if !slices.Contains([]string{modbus.RTUProtocol, modbus.TCPProtocol, modbus.RTUoverTCPProtocol, modbus.ASCIIProtocol, modbus.AutoProtocol}, value) {
+			return fmt.Errorf("invalid protocol: '%s'", value)
+		}
+		m.Protocol = value
+	case "read-timeout":
+		m.ReadTimeout, err = time.ParseDuration(value)
+		if err == nil && m.ReadTimeout <= 0 {
+			err = fmt.Errorf("'%s' is not positive", value)
+		}
+	default:
+		return fmt.Errorf("unknown setting: '%s'", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
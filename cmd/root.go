@@ -1,9 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net"
+
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
 
 	"github.com/alecthomas/kong"
+	"go.bug.st/serial"
 )
 
 var Version = "dev" // Default version, overridden by -ldflags
@@ -12,6 +19,7 @@ type Globals struct {
 	Config   kong.ConfigFlag `help:"Location of client config files" type:"path"`
 	LogLevel string          `short:"l" enum:"debug,info,warn,error" help:"Set the logging level (debug|info|warn|error)" default:"info"`
 	Version  VersionFlag     `short:"v" name:"version" help:"Print version information and quit"`
+	Capture  string          `type:"path" help:"Record all the data read from and written to the devices in this file. Files ending in .pcap are written in pcap format, and any other as JSON lines"`
 }
 
 type VersionFlag bool
@@ -28,11 +36,16 @@ type CLI struct {
 	Globals
 
 	BatteryInfo      BatteryInfoCmd      `cmd:"" help:"Displays battery information"`
+	ConfigFile       ConfigCmd           `cmd:"" name:"config" help:"Works with the configuration files of the monitor command"`
 	Forward          ForwardCmd          `cmd:"" help:"Forwards commands between a two devices"`
 	InverterQuery    InverterQueryCmd    `cmd:"" help:"Sends PI30 protocol commands to inverters"`
+	ModbusGateway    ModbusGatewayCmd    `cmd:"" help:"Forwards Modbus TCP requests to Modbus RTU devices"`
 	ModbusRead       ModbusReadCmd       `cmd:"" help:"Reads Modbus holding registers\n"`
+	ModbusWrite      ModbusWriteCmd      `cmd:"" help:"Writes Modbus holding registers or coils\n"`
+	Monitor          MonitorCmd          `cmd:"" help:"Monitors batteries and inverters in a single process"`
 	MonitorBatteries MonitorBatteriesCmd `cmd:"" help:"Monitors batteries state, MQTT publishing optional"`
 	MonitorInverters MonitorInvertersCmd `cmd:"" help:"Monitors inverters state, MQTT publishing optional"`
+	Simulate         SimulateCmd         `cmd:"" help:"Serves simulated battery or inverter data"`
 }
 
 // MQTTFlags are embedded in multiple commands.
@@ -56,3 +69,53 @@ func (f *MQTTFlags) Validate() error {
 	}
 	return nil
 }
+
+// ModbusServerFlags are embedded in the monitor commands.
+type ModbusServerFlags struct {
+	ModbusServerAddress    string `group:"Modbus server" help:"Address to serve the registers read from the devices. <IP>:<Port> for Modbus TCP, or a serial port for Modbus RTU"`
+	ModbusServerDeviceType string `group:"Modbus server" default:"tcp" enum:"serial,tcp" help:"One of serial,tcp"`
+	ModbusServerBaudRate   uint   `group:"Modbus server" default:"9600" help:"Baud rate for the Modbus RTU server"`
+}
+
+// startModbusServer starts a Modbus server that answers with the registers stored in the image returned.
+// The image is nil if no server address was provided.
+func (f *ModbusServerFlags) startModbusServer(ctx context.Context) (*modbus.RegisterImage, error) {
+	if f.ModbusServerAddress == "" {
+		return nil, nil
+	}
+	opts, err := common.ParseAddress(&common.PortOptions{
+		Address: f.ModbusServerAddress,
+		Mode:    &serial.Mode{BaudRate: int(f.ModbusServerBaudRate)},
+		Type:    common.DeviceTypeFromString[f.ModbusServerDeviceType],
+	})
+	if err != nil {
+		return nil, err
+	}
+	image := modbus.NewRegisterImage()
+	server := modbus.NewServer(image)
+	if opts.Type == common.TCPDevice {
+		l, err := net.Listen("tcp", opts.Address)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			if err := server.ServeTCP(ctx, l); err != nil {
+				slog.Error("Modbus TCP server failed", "address", f.ModbusServerAddress, "error", err)
+			}
+		}()
+		return image, nil
+	}
+	port, err := common.OpenPort(opts)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer port.Close()
+		stop := context.AfterFunc(ctx, func() { port.Close() })
+		defer stop()
+		if err := server.ServeRTU(ctx, port); err != nil {
+			slog.Error("Modbus RTU server failed", "address", f.ModbusServerAddress, "error", err)
+		}
+	}()
+	return image, nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"wombatt/internal/common"
+	"wombatt/internal/simulator"
+)
+
+type SimulateCmd struct {
+	Model         string `short:"m" required:"" enum:"${simulator_models}" help:"One of ${simulator_models}"`
+	IDs           []uint `short:"i" name:"id" default:"1" help:"IDs of the simulated devices"`
+	ListenAddress string `short:"L" xor:"listen" required:"" help:"Address to listen on for clients. <IP>:<Port>, i.e., 0.0.0.0:502"`
+	PTY           bool   `xor:"listen" required:"" help:"Serve on a pseudo-terminal instead of a TCP address. Its path is logged at startup"`
+}
+
+func (cmd *SimulateCmd) Run(globals *Globals, ctx context.Context) error {
+	var ids []uint8
+	for _, id := range cmd.IDs {
+		if id > 255 {
+			return fmt.Errorf("invalid ID: %d", id)
+		}
+		ids = append(ids, uint8(id))
+	}
+	sim, err := simulator.New(cmd.Model, ids)
+	if err != nil {
+		return err
+	}
+	if cmd.PTY {
+		port, name, err := common.OpenPTY()
+		if err != nil {
+			return err
+		}
+		defer port.Close()
+		stop := context.AfterFunc(ctx, func() { port.Close() })
+		defer stop()
+		slog.Info("simulating devices", "model", cmd.Model, "ids", cmd.IDs, "pty", name)
+		return sim.Serve(ctx, port)
+	}
+	l, err := net.Listen("tcp", cmd.ListenAddress)
+	if err != nil {
+		return err
+	}
+	slog.Info("simulating devices", "model", cmd.Model, "ids", cmd.IDs, "listen-address", l.Addr())
+	return sim.ServeTCP(ctx, l)
+}
@@ -2,9 +2,9 @@
 
 _wombatt_completions() {
     local cur prev
-    local common bi br bt dt mqtt p pi sp rto webs id start count regtype of off db sb par tout
+    local common bi br bt dt mqtt p pi sp rto webs id start count regtype of off mw inf inff db sb par tout
 
-    common="-h --help -v --version -l --log-level --config"
+    common="-h --help -v --version -l --log-level --config --capture"
 
     # Common flags for serial ports
     db="-D --data-bits"
@@ -31,6 +31,13 @@ _wombatt_completions() {
     modbus_id="-i --modbus-id"
     p_R="-R --protocol"
 
+    # Flags for ModbusGatewayCmd
+    listen="-L --listen-address"
+
+    # Flags for SimulateCmd
+    model="-m --model"
+    sim_id="-i --id"
+
     # Flags for ModbusReadCmd
     mr_p="--protocol"
     mr_id="--id"
@@ -40,11 +47,17 @@ _wombatt_completions() {
     of="-o --output-format"
     off="-O --output-format-file"
 
+    # Flags for ModbusWriteCmd
+    mw="--multiple --verify --dry-run"
+    inf="-f --input-format"
+    inff="-F --input-format-file"
+
     # Flags for MonitorBatteriesCmd
     mqtt="--mqtt-broker --mqtt-password --mqtt-topic-prefix --mqtt-user"
     pi="-P --poll-interval"
     webs="-w --web-server-address"
     mqtt_prefix="--mqtt-prefix"
+    mbs="--modbus-server-address --modbus-server-device-type --modbus-server-baud-rate"
 
     
 
@@ -55,27 +68,45 @@ _wombatt_completions() {
 
     case ${COMP_CWORD} in
         1)
-            COMPREPLY=($(compgen -W "battery-info forward inverter-query modbus-read monitor-batteries monitor-inverters" -- "${COMP_WORDS[1]}"))
+            COMPREPLY=($(compgen -W "battery-info config forward inverter-query modbus-gateway modbus-read modbus-write monitor monitor-batteries monitor-inverters simulate" -- "${COMP_WORDS[1]}"))
             ;;
         *)
             case ${prev} in
             "battery-info")
                 COMPREPLY=($(compgen -W "$common $bi $br $bt $dt $p $rto $sp" -- ${cur}))
                 ;;
+            "config")
+                COMPREPLY=($(compgen -W "validate" -- ${cur}))
+                ;;
+            "validate")
+                COMPREPLY=($(compgen -f -- ${cur}))
+                ;;
             "forward")
-                COMPREPLY=($(compgen -W "$common $br $dt $controller_port $subordinate_port" -- ${cur}))
+                COMPREPLY=($(compgen -W "$common $br $dt $controller_port $subordinate_port --decode" -- ${cur}))
                 ;;
             "inverter-query")
                 COMPREPLY=($(compgen -W "$common $br $dt $rto $sp $command $db $sb $par $p_R $modbus_id $inv_type" -- ${cur}))
                 ;;
+            "modbus-gateway")
+                COMPREPLY=($(compgen -W "$common $br $dt $sp $rto $listen" -- ${cur}))
+                ;;
             "modbus-read")
                 COMPREPLY=($(compgen -W "$common $br $dt $mr_p $rto $sp $mr_id $start $count $regtype $of $off" -- ${cur}))
                 ;;
+            "modbus-write")
+                COMPREPLY=($(compgen -W "$common $br $dt $mr_p $sp $mr_id $start $regtype $mw $inf $inff" -- ${cur}))
+                ;;
+            "monitor")
+                COMPREPLY=($(compgen -W "$common $mqtt $pi $webs $mbs --battery --inverter" -f -- ${cur}))
+                ;;
             "monitor-batteries")
-                COMPREPLY=($(compgen -W "$common $bi $br $bt $dt $mqtt $p $pi $rto $sp $webs $mqtt_prefix" -- ${cur}))
+                COMPREPLY=($(compgen -W "$common $bi $br $bt $dt $mqtt $p $pi $rto $sp $webs $mqtt_prefix $mbs" -- ${cur}))
                 ;;
             "monitor-inverters")
-                COMPREPLY=($(compgen -W "$common $br $db $sb $par $dt $mqtt $pi $rto $webs $p_R $modbus_id" -- ${cur}))
+                COMPREPLY=($(compgen -W "$common $br $db $sb $par $dt $mqtt $pi $rto $webs $p_R $modbus_id $mbs" -- ${cur}))
+                ;;
+            "simulate")
+                COMPREPLY=($(compgen -W "$common $model $sim_id $listen --pty" -- ${cur}))
                 ;;
             
         esac
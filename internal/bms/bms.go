@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"reflect"
@@ -17,12 +18,16 @@ import (
 )
 
 const (
+	DalyBMS        = "daly"
 	EG4LLv2BMS     = "EG4LLv2"
+	JBDBMS         = "jbd"
+	JKBMS          = "jkbms"
 	Lifepower4BMS  = "lifepower4"
 	Lifepowerv2BMS = "lifepowerv2" // Protocol switches: 1-off, 2 through 6-on
 	PaceBMS        = "pacemodbus"
-
-	NumCells = 16 // Standard number of cells in a 48V battery pack for voltage stats
+	PylontechBMS   = "pylontech"
+	SeplosV2BMS    = "seplosv2"
+	SeplosV3BMS    = "seplosv3"
 )
 
 // BMS defines the interface for interacting with different Battery Management Systems.
@@ -47,14 +52,26 @@ type BMS interface {
 // It returns an error if the BMS type is unsupported.
 func Instance(bmsType string) (BMS, error) {
 	switch bmsType {
+	case DalyBMS:
+		return NewDaly(), nil
 	case EG4LLv2BMS:
 		return NewEG4LLv2(), nil
+	case JBDBMS:
+		return NewJBD(), nil
+	case JKBMS:
+		return NewJK(), nil
 	case Lifepower4BMS:
 		return NewLFP4(), nil
 	case Lifepowerv2BMS:
 		return NewEG4LLv2(), nil // Same protocol as EG4LLv2 BMS.
 	case PaceBMS:
 		return NewPace(), nil
+	case PylontechBMS:
+		return NewPylontech(), nil
+	case SeplosV2BMS:
+		return NewSeplosV2(), nil
+	case SeplosV3BMS:
+		return NewSeplosV3(), nil
 	default:
 		return nil, fmt.Errorf("unsupported BMS type: %v", bmsType)
 	}
@@ -69,19 +86,19 @@ type VoltageStats struct {
 }
 
 // updateVoltageStats calculates and updates voltage statistics (min, max, mean, median)
-// for a given array of cell voltages.
-func updateVoltageStats(cellVoltage [16]uint16, vs *VoltageStats) {
-	voltages := make([]uint16, NumCells)
+// for the given cell voltages, which must be only those of the cells present in the pack.
+func updateVoltageStats(cellVoltages []uint16, vs *VoltageStats) {
+	if len(cellVoltages) == 0 {
+		return
+	}
+	voltages := slices.Clone(cellVoltages)
 
 	// Initialize min/max with the first cell's voltage
-	vs.MinVoltage = cellVoltage[0]
-	vs.MaxVoltage = cellVoltage[0]
-	voltages[0] = cellVoltage[0]
-	sum := uint(cellVoltage[0])
+	vs.MinVoltage = voltages[0]
+	vs.MaxVoltage = voltages[0]
+	sum := uint(voltages[0])
 
-	for i := 1; i < NumCells; i++ { // Start from the second cell
-		mv := cellVoltage[i]
-		voltages[i] = mv
+	for _, mv := range voltages[1:] { // Start from the second cell
 		sum += uint(mv)
 		if vs.MinVoltage > mv {
 			vs.MinVoltage = mv
@@ -90,15 +107,23 @@ func updateVoltageStats(cellVoltage [16]uint16, vs *VoltageStats) {
 			vs.MaxVoltage = mv
 		}
 	}
-	vs.MeanVoltage = uint16(sum / NumCells)
+	n := len(voltages)
+	vs.MeanVoltage = uint16(sum / uint(n))
 	slices.Sort(voltages)
-	vs.MedianVoltage = (voltages[NumCells/2-1] + voltages[NumCells/2]) / 2
+	if n%2 == 1 {
+		vs.MedianVoltage = voltages[n/2]
+	} else {
+		vs.MedianVoltage = (voltages[n/2-1] + voltages[n/2]) / 2
+	}
 }
 
 // readIntoStruct reads data from the Modbus device into the provided struct.
 // The `quantityOrCommand` parameter serves a dual purpose:
 // - For standard Modbus protocols (RTU, TCP), it represents the number of registers to read.
-// - For the Lifepower4 protocol, it represents a command code.
+// - For the Lifepower4, Seplos v2 and Pylontech protocols, it represents a command code.
+// - For the Daly protocol, it represents a data ID, and `address` the number of response frames.
+// - For the JBD protocol, it represents the register to read.
+// - For the JK native protocol, it represents a command, and `address` the data identification code.
 func readIntoStruct(result any, reader modbus.RegisterReader, timeout time.Duration, id uint8, address uint16, quantityOrCommand uint8) ([]byte, error) {
 	data, err := readWithTimeout(reader, timeout, id, address, quantityOrCommand)
 	if err != nil {
@@ -112,6 +137,20 @@ func readIntoStruct(result any, reader modbus.RegisterReader, timeout time.Durat
 	return data, nil
 }
 
+// inputReader reads input registers instead of holding registers, for the BMS that have their
+// information in input registers.
+type inputReader struct {
+	modbus.RegisterReader
+}
+
+func (r inputReader) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return r.ReadInputRegisters(id, start, count)
+}
+
+// ErrTimeout is returned when the BMS doesn't answer in time. The read is left running, so the
+// port has to be reset before using it again, as done by common.AbandonRead.
+var ErrTimeout = errors.New("timed out")
+
 func readWithTimeout(reader modbus.RegisterReader, timeout time.Duration, id uint8, start uint16, quantityOrCommand uint8) ([]byte, error) {
 	var data []byte
 	var err error
@@ -122,7 +161,7 @@ func readWithTimeout(reader modbus.RegisterReader, timeout time.Duration, id uin
 	}()
 	select {
 	case <-time.After(timeout):
-		return nil, fmt.Errorf("timed out")
+		return nil, ErrTimeout
 	case <-result:
 		return data, err
 	}
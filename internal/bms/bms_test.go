@@ -3,6 +3,7 @@ package bms
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"io"
 	"reflect"
 	"testing"
@@ -158,6 +159,198 @@ func TestBatteryInfo(t *testing.T) {
 				FETStatusCode:          3,
 			},
 		},
+		{
+			resp:     "a5029008021400007548036b80a50291080d11050cfa0c000075a502920841023f0100000000c4a50293080101010a0002ab9894a50294081004010011002a0093a5029508010d020d030d040075a5029508020d050d060d07007fa5029508030d080d090d0a0089a5029508040d0b0d0c0d0d0093a5029508050d0e0d0f0d10009da5029508060d11000000000068a50296080140413f3e00000044a50297080180000000000000c7a502980801000200000000004a",
+			protocol: modbus.DalyProtocol,
+			bmsType:  "daly",
+			value: &DalyBatteryInfo{
+				Voltage:           532,
+				Current:           24,
+				SOC:               875,
+				MaxCellVoltage:    3345,
+				MaxVoltageCell:    5,
+				MinCellVoltage:    3322,
+				MinVoltageCell:    12,
+				MaxTemp:           25,
+				MaxTempSensor:     2,
+				MinTemp:           23,
+				MinTempSensor:     1,
+				State:             1,
+				ChargingMOSFET:    1,
+				DischargingMOSFET: 1,
+				RemainingCapacity: 175000,
+				NumberOfCells:     16,
+				CycleCounts:       42,
+				CellVoltages:      [16]uint16{3330, 3331, 3332, 3333, 3334, 3335, 3336, 3337, 3338, 3339, 3340, 3341, 3342, 3343, 3344, 3345},
+				CellTemps:         [4]int16{24, 25, 23, 22},
+				BalanceStatus:     0x8001,
+				DalyFailureInfo: DalyFailureInfo{
+					VoltageAlarms: 0x01,
+					CurrentAlarms: 0x02,
+				},
+			},
+		},
+		{
+			resp:     "a50294081004010011002a0093",
+			isExtra:  true,
+			protocol: modbus.DalyProtocol,
+			bmsType:  "daly",
+			value: &DalyExtraBatteryInfo{
+				NumberOfTempSensors: 4,
+				ChargerStatus:       1,
+				DIOStatus:           0x11,
+			},
+		},
+		{
+			resp:     "7e323030323436303031303936303030323130304345343043453530434536304345373043453830434539304345413043454230434543304345443043454530434546304346303043463130434632304346333036304241353042413630424137304241383042414630424239464435433134413033343445304134323638303331333436353030303436303345383134394630303030303030303030303030303030444334360d",
+			protocol: modbus.SeplosV2Protocol,
+			bmsType:  "seplosv2",
+			value: &SeplosV2BatteryInfo{
+				SeplosV2AnalogValueInfo: SeplosV2AnalogValueInfo{
+					NumberOfCells:     16,
+					CellVoltages:      [16]uint16{3300, 3301, 3302, 3303, 3304, 3305, 3306, 3307, 3308, 3309, 3310, 3311, 3312, 3313, 3314, 3315},
+					CellTemps:         [4]uint16{2981, 2982, 2983, 2984},
+					EnvTemp:           2991,
+					MOSFETTemp:        3001,
+					Current:           -676,
+					Voltage:           5280,
+					RemainingCapacity: 13390,
+					FullCapacity:      17000,
+					SOC:               787,
+					RatedCapacity:     18000,
+					CycleCounts:       70,
+					SOH:               1000,
+					PortVoltage:       5279,
+				},
+				VoltageStats: VoltageStats{
+					MaxVoltage:    3315,
+					MinVoltage:    3300,
+					MeanVoltage:   3307,
+					MedianVoltage: 3307,
+				},
+			},
+		},
+		{
+			resp:     "7e3230303234363030383036323030303231303030303030303030303030303030303030303030303030303030303030303030303630303030303030303030303030303032313430303031303030303038303030333030383130323030303030303031303030303030303030303030454231410d",
+			isExtra:  true,
+			protocol: modbus.SeplosV2Protocol,
+			bmsType:  "seplosv2",
+			value: &SeplosV2AlarmInfo{
+				NumberOfCells: 16,
+				VoltageAlarm:  2,
+				AlarmEvent2:   0x01,
+				AlarmEvent5:   0x08,
+				SwitchStatus:  0x03,
+				BalanceStatus: 0x0081,
+				SystemStatus:  0x02,
+				AlarmEvent8:   0x01,
+			},
+		},
+		{
+			resp:     "7e3230303234363030463037413130303230463043453430434535304345363043453730434538304345393043454130434542304345433043454430434545304345463043463030434631304346323035304241353042413630424137304241383042413946464345433143354646464630344646464630303233303044364438303132313130453134360d",
+			protocol: modbus.PylontechProtocol,
+			bmsType:  "pylontech",
+			value: &PylontechBatteryInfo{
+				NumberOfCells:     15,
+				CellVoltages:      [16]uint16{3300, 3301, 3302, 3303, 3304, 3305, 3306, 3307, 3308, 3309, 3310, 3311, 3312, 3313, 3314},
+				BMSTemp:           2981,
+				CellTemps:         [4]uint16{2982, 2983, 2984, 2985},
+				Current:           -50,
+				Voltage:           49605,
+				RemainingCapacity: 55000,
+				FullCapacity:      74000,
+				CycleCounts:       35,
+				SOC:               74,
+			},
+		},
+		{
+			resp: "7e32303032343630304330343031303032304630303030303230303030303030303030303030303030303030303030303030353030303030303030303030303030303030303045303430303030463136320d" +
+				"7e3230303234363030423033323130304537343042353430414630304430333041414230334643443246304146433841343130304430333039453330334643463237390d",
+			isExtra:  true,
+			protocol: modbus.PylontechProtocol,
+			bmsType:  "pylontech",
+			value: &PylontechExtraBatteryInfo{
+				PylontechAlarmInfo: PylontechAlarmInfo{
+					NumberOfCells:     15,
+					CellVoltageAlarms: [16]uint8{0, 0, 2},
+					Status2:           0x0e,
+					Status3:           0x04,
+				},
+				PylontechSystemParameters: PylontechSystemParameters{
+					CellHighVoltageLimit:    3700,
+					CellLowVoltageLimit:     2900,
+					CellUnderVoltageLimit:   2800,
+					ChargeHighTempLimit:     3331,
+					ChargeLowTempLimit:      2731,
+					ChargeCurrentLimit:      1020,
+					ModuleHighVoltageLimit:  54000,
+					ModuleLowVoltageLimit:   45000,
+					ModuleUnderVoltageLimit: 42000,
+					DischargeHighTempLimit:  3331,
+					DischargeLowTempLimit:   2531,
+					DischargeCurrentLimit:   1020,
+				},
+			},
+		},
+		{
+			resp:     "dd03001d14befb1e21662710002a306f00050000020021560310030ba50ba70baff9c177" + "dd0400200cee0cef0cf00cf10cf20cf30cf40cf50cf60cf70cf80cf90cfa0cfb0cfc0cfdefc877",
+			protocol: modbus.JBDProtocol,
+			bmsType:  "jbd",
+			value: &JBDBatteryInfo{
+				JBDBasicInfo: JBDBasicInfo{
+					Voltage:           5310,
+					Current:           -1250,
+					RemainingCapacity: 8550,
+					NominalCapacity:   10000,
+					CycleCounts:       42,
+					BalanceStatus:     0x0005,
+					ProtectionStatus:  0x0200,
+					SoftwareVersion:   0x21,
+					SOC:               86,
+					MOSFETStatus:      0x03,
+					NumberOfCells:     16,
+					NumberOfNTCs:      3,
+				},
+				NTCTemps:     [4]uint16{2981, 2983, 2991},
+				CellVoltages: [16]uint16{3310, 3311, 3312, 3313, 3314, 3315, 3316, 3317, 3318, 3319, 3320, 3321, 3322, 3323, 3324, 3325},
+				VoltageStats: VoltageStats{
+					MaxVoltage:    3325,
+					MinVoltage:    3310,
+					MeanVoltage:   3317,
+					MedianVoltage: 3317,
+				},
+			},
+		},
+		{
+			// 4S pack: the voltage stats only include the cells present.
+			resp:     "dd03001d0532fb1e21662710002a306f00050000020021560304030ba50ba70baffa6877" + "dd0400080ce40ce50ce20ce6fc3777",
+			protocol: modbus.JBDProtocol,
+			bmsType:  "jbd",
+			value: &JBDBatteryInfo{
+				JBDBasicInfo: JBDBasicInfo{
+					Voltage:           1330,
+					Current:           -1250,
+					RemainingCapacity: 8550,
+					NominalCapacity:   10000,
+					CycleCounts:       42,
+					BalanceStatus:     0x0005,
+					ProtectionStatus:  0x0200,
+					SoftwareVersion:   0x21,
+					SOC:               86,
+					MOSFETStatus:      0x03,
+					NumberOfCells:     4,
+					NumberOfNTCs:      3,
+				},
+				NTCTemps:     [4]uint16{2981, 2983, 2991},
+				CellVoltages: [16]uint16{3300, 3301, 3298, 3302},
+				VoltageStats: VoltageStats{
+					MaxVoltage:    3302,
+					MinVoltage:    3298,
+					MeanVoltage:   3300,
+					MedianVoltage: 3300,
+				},
+			},
+		},
 	}
 
 	for tid, tt := range tests {
@@ -198,3 +391,14 @@ func TestBatteryInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestReadInfoTimeout(t *testing.T) {
+	r, w := io.Pipe() // Nothing is ever written, so reads block until the end of the test.
+	defer w.Close()
+	port := common.NewTestPort(r, io.Discard, 0)
+	reader, _ := modbus.Reader(port, modbus.RTUProtocol, "")
+	_, err := NewEG4LLv2().ReadInfo(reader, 2, 20*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v; want %v", err, ErrTimeout)
+	}
+}
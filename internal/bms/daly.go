@@ -0,0 +1,228 @@
+package bms
+
+import (
+	"encoding/binary"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+// Data IDs of the Daly protocol.
+const (
+	dalySOCCommand          uint8 = 0x90
+	dalyCellVoltageCommand  uint8 = 0x91
+	dalyTempCommand         uint8 = 0x92
+	dalyMOSFETCommand       uint8 = 0x93
+	dalyStatusCommand       uint8 = 0x94
+	dalyCellVoltagesCommand uint8 = 0x95
+	dalyTempsCommand        uint8 = 0x96
+	dalyBalanceCommand      uint8 = 0x97
+	dalyFailureCommand      uint8 = 0x98
+
+	dalyCurrentOffset = 30000 // In 0.1A.
+	dalyTempOffset    = 40    // In °C.
+	dalyCellsPerFrame = 3
+	dalyTempsPerFrame = 7
+)
+
+type Daly struct {
+}
+
+func NewDaly() BMS {
+	return &Daly{}
+}
+
+func (*Daly) InfoInstance() any {
+	return &DalyBatteryInfo{}
+}
+
+func (*Daly) DefaultProtocol(_ string) string {
+	return modbus.DalyProtocol
+}
+
+// The data of the responses to each data ID.
+type dalySOC struct {
+	Voltage uint16
+	_       uint16 // Gathered voltage.
+	Current uint16
+	SOC     uint16
+}
+
+type dalyCellVoltageRange struct {
+	MaxVoltage     uint16
+	MaxVoltageCell uint8
+	MinVoltage     uint16
+	MinVoltageCell uint8
+	_              uint16
+}
+
+type dalyTempRange struct {
+	MaxTemp       uint8
+	MaxTempSensor uint8
+	MinTemp       uint8
+	MinTempSensor uint8
+	_             uint32
+}
+
+type dalyMOSFETStatus struct {
+	State             uint8
+	ChargingMOSFET    uint8
+	DischargingMOSFET uint8
+	_                 uint8 // BMS life.
+	RemainingCapacity uint32
+}
+
+type dalyStatus struct {
+	NumberOfCells       uint8
+	NumberOfTempSensors uint8
+	ChargerStatus       uint8
+	LoadStatus          uint8
+	DIOStatus           uint8
+	CycleCounts         uint16
+	_                   uint8
+}
+
+func (*Daly) readStatus(reader modbus.RegisterReader, id uint8, timeout time.Duration) (*dalyStatus, error) {
+	var status dalyStatus
+	if _, err := readIntoStruct(&status, reader, timeout, id, 0, dalyStatusCommand); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (d *Daly) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var soc dalySOC
+	if _, err := readIntoStruct(&soc, reader, timeout, id, 0, dalySOCCommand); err != nil {
+		return nil, err
+	}
+	var cellVoltage dalyCellVoltageRange
+	if _, err := readIntoStruct(&cellVoltage, reader, timeout, id, 0, dalyCellVoltageCommand); err != nil {
+		return nil, err
+	}
+	var temp dalyTempRange
+	if _, err := readIntoStruct(&temp, reader, timeout, id, 0, dalyTempCommand); err != nil {
+		return nil, err
+	}
+	var mosfet dalyMOSFETStatus
+	if _, err := readIntoStruct(&mosfet, reader, timeout, id, 0, dalyMOSFETCommand); err != nil {
+		return nil, err
+	}
+	status, err := d.readStatus(reader, id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	result := DalyBatteryInfo{
+		Voltage:           soc.Voltage,
+		Current:           int16(int(soc.Current) - dalyCurrentOffset),
+		SOC:               soc.SOC,
+		MaxCellVoltage:    cellVoltage.MaxVoltage,
+		MaxVoltageCell:    cellVoltage.MaxVoltageCell,
+		MinCellVoltage:    cellVoltage.MinVoltage,
+		MinVoltageCell:    cellVoltage.MinVoltageCell,
+		MaxTemp:           int16(temp.MaxTemp) - dalyTempOffset,
+		MaxTempSensor:     temp.MaxTempSensor,
+		MinTemp:           int16(temp.MinTemp) - dalyTempOffset,
+		MinTempSensor:     temp.MinTempSensor,
+		State:             mosfet.State,
+		ChargingMOSFET:    mosfet.ChargingMOSFET,
+		DischargingMOSFET: mosfet.DischargingMOSFET,
+		RemainingCapacity: mosfet.RemainingCapacity,
+		NumberOfCells:     status.NumberOfCells,
+		CycleCounts:       status.CycleCounts,
+	}
+
+	// Each frame has its number, starting at 1, followed by the values.
+	frames := (uint16(status.NumberOfCells) + dalyCellsPerFrame - 1) / dalyCellsPerFrame
+	data, err := readWithTimeout(reader, timeout, id, frames, dalyCellVoltagesCommand)
+	if err != nil {
+		return nil, err
+	}
+	for f := 0; f+8 <= len(data); f += 8 {
+		for i := range dalyCellsPerFrame {
+			n := (int(data[f])-1)*dalyCellsPerFrame + i
+			if n >= 0 && n < len(result.CellVoltages) && n < int(status.NumberOfCells) {
+				result.CellVoltages[n] = binary.BigEndian.Uint16(data[f+1+2*i:])
+			}
+		}
+	}
+	frames = (uint16(status.NumberOfTempSensors) + dalyTempsPerFrame - 1) / dalyTempsPerFrame
+	data, err = readWithTimeout(reader, timeout, id, frames, dalyTempsCommand)
+	if err != nil {
+		return nil, err
+	}
+	for f := 0; f+8 <= len(data); f += 8 {
+		for i := range dalyTempsPerFrame {
+			n := (int(data[f])-1)*dalyTempsPerFrame + i
+			if n >= 0 && n < len(result.CellTemps) && n < int(status.NumberOfTempSensors) {
+				result.CellTemps[n] = int16(data[f+1+i]) - dalyTempOffset
+			}
+		}
+	}
+
+	data, err = readWithTimeout(reader, timeout, id, 0, dalyBalanceCommand)
+	if err != nil {
+		return nil, err
+	}
+	result.BalanceStatus = uint16(data[1])<<8 | uint16(data[0]) // Bit 0 of the first byte is cell 1.
+	if _, err := readIntoStruct(&result.DalyFailureInfo, reader, timeout, id, 0, dalyFailureCommand); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (d *Daly) ReadExtraInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	status, err := d.readStatus(reader, id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &DalyExtraBatteryInfo{
+		NumberOfTempSensors: status.NumberOfTempSensors,
+		ChargerStatus:       status.ChargerStatus,
+		LoadStatus:          status.LoadStatus,
+		DIOStatus:           status.DIOStatus,
+	}, nil
+}
+
+type DalyBatteryInfo struct {
+	// Reference: Daly UART/RS485 communication protocol V1.2.
+	Voltage           uint16     `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.1" precision:"1"`
+	Current           int16      `name:"current" dclass:"current" unit:"A" multiplier:"0.1" precision:"1" icon:"mdi:current-dc"`
+	SOC               uint16     `name:"soc" dclass:"battery" unit:"%" multiplier:"0.1" precision:"1"`
+	MaxCellVoltage    uint16     `name:"max_cell_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MaxVoltageCell    uint8      `name:"max_voltage_cell"`
+	MinCellVoltage    uint16     `name:"min_cell_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MinVoltageCell    uint8      `name:"min_voltage_cell"`
+	MaxTemp           int16      `name:"max_temp" dclass:"temperature" unit:"°C"`
+	MaxTempSensor     uint8      `name:"max_temp_sensor"`
+	MinTemp           int16      `name:"min_temp" dclass:"temperature" unit:"°C"`
+	MinTempSensor     uint8      `name:"min_temp_sensor"`
+	State             uint8      `name:"state" values:"0:idle,1:charging,2:discharging"`
+	ChargingMOSFET    uint8      `name:"charging_mosfet" values:"0:off,1:on"`
+	DischargingMOSFET uint8      `name:"discharging_mosfet" values:"0:off,1:on"`
+	RemainingCapacity uint32     `name:"remaining_capacity" unit:"Ah" multiplier:"0.001" precision:"2"`
+	NumberOfCells     uint8      `name:"cell_num"`
+	CycleCounts       uint16     `name:"cycle_counts" icon:"mdi:battery-sync"`
+	CellVoltages      [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	CellTemps         [4]int16   `name:"cell_temp_%d" dclass:"temperature" unit:"°C"`
+	BalanceStatus     uint16     `name:"balance_status" flags:"cell 16 balancing,cell 15 balancing,cell 14 balancing,cell 13 balancing,cell 12 balancing,cell 11 balancing,cell 10 balancing,cell 9 balancing,cell 8 balancing,cell 7 balancing,cell 6 balancing,cell 5 balancing,cell 4 balancing,cell 3 balancing,cell 2 balancing,cell 1 balancing"`
+	DalyFailureInfo
+}
+
+// DalyFailureInfo has the response to the 0x98 data ID.
+type DalyFailureInfo struct {
+	VoltageAlarms    uint8 `name:"voltage_alarms" flags:"pack undervoltage level 2,pack undervoltage level 1,pack overvoltage level 2,pack overvoltage level 1,cell undervoltage level 2,cell undervoltage level 1,cell overvoltage level 2,cell overvoltage level 1"`
+	TempAlarms       uint8 `name:"temperature_alarms" flags:"discharge under temp level 2,discharge under temp level 1,discharge over temp level 2,discharge over temp level 1,charge under temp level 2,charge under temp level 1,charge over temp level 2,charge over temp level 1"`
+	CurrentAlarms    uint8 `name:"current_alarms" flags:"SOC low level 2,SOC low level 1,SOC high level 2,SOC high level 1,discharge overcurrent level 2,discharge overcurrent level 1,charge overcurrent level 2,charge overcurrent level 1"`
+	DifferenceAlarms uint8 `name:"difference_alarms" flags:"0x80,0x40,0x20,0x10,temperature difference level 2,temperature difference level 1,cell voltage difference level 2,cell voltage difference level 1"`
+	MOSFETFaults     uint8 `name:"mosfet_faults" flags:"discharge MOS open circuit,charge MOS open circuit,discharge MOS stuck,charge MOS stuck,discharge MOS temp sensor error,charge MOS temp sensor error,discharge MOS over temp,charge MOS over temp"`
+	SystemFaults     uint8 `name:"system_faults" flags:"internal communication failure,communication failure,precharge failure,RTC error,EEPROM error,cell temp sensor error,cell voltage collection dropped,AFE chip error"`
+	OtherFaults      uint8 `name:"other_faults" flags:"0x80,0x40,0x20,0x10,low voltage charging forbidden,short circuit protection fault,pack voltage detection fault,current module fault"`
+	FaultCode        uint8 `name:"fault_code"`
+}
+
+type DalyExtraBatteryInfo struct {
+	NumberOfTempSensors uint8 `name:"temp_sensor_num"`
+	ChargerStatus       uint8 `name:"charger_status" values:"0:disconnected,1:connected"`
+	LoadStatus          uint8 `name:"load_status" values:"0:disconnected,1:connected"`
+	DIOStatus           uint8 `name:"dio_status" flags:"DO4,DO3,DO2,DO1,DI4,DI3,DI2,DI1"`
+}
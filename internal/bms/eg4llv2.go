@@ -30,7 +30,7 @@ func (*EG4LLv2) InfoInstance() any {
 
 func (*EG4LLv2) DefaultProtocol(deviceType string) string {
 	switch deviceType {
-	case "tcp":
+	case "tcp", "udp":
 		return modbus.TCPProtocol
 	default:
 		return modbus.RTUProtocol
@@ -57,7 +57,7 @@ func (e *EG4LLv2) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.
 	}
 	result := EG4BatteryInfo{EG4ModbusBatteryInfo: info}
 	result.FullCapacity /= 3600 // FullCapacity is in mAs -> 3600000 == 100Ah
-	updateVoltageStats(result.CellVoltages, &result.VoltageStats)
+	updateVoltageStats(result.CellVoltages[:], &result.VoltageStats)
 	return &result, nil
 }
 
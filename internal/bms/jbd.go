@@ -0,0 +1,83 @@
+package bms
+
+import (
+	"encoding/binary"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+const (
+	jbdBasicInfoRegister    uint8 = 0x03
+	jbdCellVoltagesRegister uint8 = 0x04
+)
+
+// JBD reads JBD (Xiaoxiang, Overkill Solar) BMS using their UART/RS485 protocol.
+type JBD struct {
+}
+
+func NewJBD() BMS {
+	return &JBD{}
+}
+
+func (*JBD) InfoInstance() any {
+	return &JBDBatteryInfo{}
+}
+
+func (*JBD) DefaultProtocol(_ string) string {
+	return modbus.JBDProtocol
+}
+
+func (*JBD) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var result JBDBatteryInfo
+	data, err := readIntoStruct(&result.JBDBasicInfo, reader, timeout, id, 0, jbdBasicInfoRegister)
+	if err != nil {
+		return nil, err
+	}
+	// The NTC temperatures follow the fixed fields.
+	ntcs := data[binary.Size(result.JBDBasicInfo):]
+	for i := 0; i < int(result.NumberOfNTCs) && i < len(result.NTCTemps) && 2*i+2 <= len(ntcs); i++ {
+		result.NTCTemps[i] = binary.BigEndian.Uint16(ntcs[2*i:])
+	}
+
+	data, err = readWithTimeout(reader, timeout, id, 0, jbdCellVoltagesRegister)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(result.CellVoltages) && 2*i+2 <= len(data); i++ {
+		result.CellVoltages[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	updateVoltageStats(result.CellVoltages[:min(int(result.NumberOfCells), len(result.CellVoltages))], &result.VoltageStats)
+	return &result, nil
+}
+
+// ReadExtraInfo returns nil, as all the information is read by ReadInfo.
+func (*JBD) ReadExtraInfo(modbus.RegisterReader, uint8, time.Duration) (any, error) {
+	return nil, nil
+}
+
+type JBDBasicInfo struct {
+	// The following fields must be in the same order as the data of the 0x03 register.
+	// Reference: JBD BMS communication protocol, basic information and status.
+	Voltage           uint16 `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.01" precision:"2"`
+	Current           int16  `name:"current" dclass:"current" unit:"A" multiplier:"0.01" precision:"2" icon:"mdi:current-dc"`
+	RemainingCapacity uint16 `name:"remaining_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	NominalCapacity   uint16 `name:"nominal_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	CycleCounts       uint16 `name:"cycle_counts" icon:"mdi:battery-sync"`
+	_                 uint16 // Production date.
+	BalanceStatus     uint16 `name:"balance_status" flags:"cell 16 balancing,cell 15 balancing,cell 14 balancing,cell 13 balancing,cell 12 balancing,cell 11 balancing,cell 10 balancing,cell 9 balancing,cell 8 balancing,cell 7 balancing,cell 6 balancing,cell 5 balancing,cell 4 balancing,cell 3 balancing,cell 2 balancing,cell 1 balancing"`
+	_                 uint16 // Balance status of cells 17 to 32.
+	ProtectionStatus  uint16 `name:"protection_status" flags:"0x8000,0x4000,0x2000,software MOSFET lock,front-end IC error,short circuit,discharge overcurrent,charge overcurrent,discharge under temp,discharge over temp,charge under temp,charge over temp,pack undervoltage,pack overvoltage,cell undervoltage,cell overvoltage"`
+	SoftwareVersion   uint8  `name:"software_version"`
+	SOC               uint8  `name:"soc" dclass:"battery" unit:"%"`
+	MOSFETStatus      uint8  `name:"mosfet_status" flags:"0x80,0x40,0x20,0x10,0x08,0x04,discharge MOSFET,charge MOSFET"`
+	NumberOfCells     uint8  `name:"cell_num"`
+	NumberOfNTCs      uint8  `skip:"1"`
+}
+
+type JBDBatteryInfo struct {
+	JBDBasicInfo
+	NTCTemps     [4]uint16  `name:"ntc_temp_%d" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	CellVoltages [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	VoltageStats
+}
@@ -0,0 +1,130 @@
+package bms
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+const (
+	jkBasicInfoAddress       uint16 = 0x1200
+	jkBasicInfoRegisterCount uint8  = 97
+
+	jkExtraInfoAddress       uint16 = 0x1400
+	jkExtraInfoRegisterCount uint8  = 16
+)
+
+// JK reads the JK BMS (JK-PB and inverter BMS series) using its RS485 Modbus protocol, or the older
+// JK BMS (JK-B and JK-BD series) using the JK native protocol when the reader is for that protocol.
+type JK struct {
+}
+
+func NewJK() BMS {
+	return &JK{}
+}
+
+func (*JK) InfoInstance() any {
+	return &JKBatteryInfo{}
+}
+
+func (*JK) DefaultProtocol(deviceType string) string {
+	switch deviceType {
+	case "tcp", "udp":
+		return modbus.TCPProtocol
+	default:
+		return modbus.RTUProtocol
+	}
+}
+
+func (e *JK) readAndValidateJKModbusInfo(result any, reader modbus.RegisterReader, id uint8, timeout time.Duration, address uint16, count uint8) error {
+	data, err := readIntoStruct(result, reader, timeout, id, address, count)
+	if err != nil {
+		return err
+	}
+	expectedLen := int(count) * 2
+	if len(data) != expectedLen {
+		slog.Debug("data received", "data", hex.EncodeToString(data))
+		return fmt.Errorf("unexpected data length: got %d, want %d", len(data), expectedLen)
+	}
+	return nil
+}
+
+func (e *JK) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	if _, ok := reader.(*modbus.JK); ok {
+		return e.readNativeInfo(reader, id, timeout)
+	}
+	var info JKModbusBatteryInfo
+	if err := e.readAndValidateJKModbusInfo(&info, reader, id, timeout, jkBasicInfoAddress, jkBasicInfoRegisterCount); err != nil {
+		return nil, err
+	}
+	result := JKBatteryInfo{JKModbusBatteryInfo: info}
+	var cells []uint16 // The voltages of the missing cells are 0.
+	for i, v := range result.CellVoltages {
+		if result.CellsPresent&(1<<i) != 0 {
+			cells = append(cells, v)
+		}
+	}
+	updateVoltageStats(cells, &result.VoltageStats)
+	return &result, nil
+}
+
+func (e *JK) ReadExtraInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	if _, ok := reader.(*modbus.JK); ok {
+		return e.readNativeExtraInfo(reader, id, timeout)
+	}
+	var extra JKModbusExtraBatteryInfo
+	if err := e.readAndValidateJKModbusInfo(&extra, reader, id, timeout, jkExtraInfoAddress, jkExtraInfoRegisterCount); err != nil {
+		return nil, err
+	}
+	return &extra, nil
+}
+
+type JKModbusBatteryInfo struct {
+	// The following fields must be in the same order as the Modbus registers available
+	// starting at address 0x1200 and reading 97 registers.
+	// Reference: JK BMS RS485 Modbus communication protocol V1.0.
+	CellVoltages      [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	_                 [16]uint16 // Cells 17 to 32.
+	CellsPresent      uint32     `skip:"1"` // Bitmap of the cells present, with cell 1 in bit 0.
+	_                 uint16     // Average cell voltage, also in the voltage stats.
+	CellVoltageDiff   uint16     `name:"cell_voltage_diff" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MaxVoltageCell    uint8      `name:"max_voltage_cell"`
+	MinVoltageCell    uint8      `name:"min_voltage_cell"`
+	_                 [32]uint16 // Resistance of the balancing wires of each cell.
+	MOSFETTemp        int16      `name:"mosfet_temp" dclass:"temperature" unit:"°C" multiplier:"0.1" precision:"1"`
+	_                 uint32     // Balancing wire resistance alarms.
+	Voltage           uint32     `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"2"`
+	Power             uint32     `name:"power" dclass:"power" unit:"W" multiplier:"0.001" precision:"1"`
+	Current           int32      `name:"current" dclass:"current" unit:"A" multiplier:"0.001" precision:"2" icon:"mdi:current-dc"`
+	Temp1             int16      `name:"temp1" dclass:"temperature" unit:"°C" multiplier:"0.1" precision:"1"`
+	Temp2             int16      `name:"temp2" dclass:"temperature" unit:"°C" multiplier:"0.1" precision:"1"`
+	Alarms            uint32     `name:"alarms" flags:"0x80000000,0x40000000,0x20000000,0x10000000,0x08000000,0x04000000,0x02000000,0x01000000,PLC module error,temperature sensor error,battery over temp,discharge MOS on failed,password changed,GPS disconnected,discharge MOS error,charge MOS error,discharge over temp,discharge short circuit,discharge overcurrent,pack undervoltage,cell undervoltage,auxiliary communication error,charge under temp,charge over temp,charge short circuit,charge overcurrent,pack overvoltage,cell overvoltage,current sensor error,cell count mismatch,MOS over temp,balancing wire resistance"`
+	BalanceCurrent    int16      `name:"balance_current" dclass:"current" unit:"A" multiplier:"0.001" precision:"3"`
+	BalanceStatus     uint8      `name:"balance_status" values:"0:off,1:charging,2:discharging"`
+	SOC               uint8      `name:"soc" dclass:"battery" unit:"%"`
+	RemainingCapacity int32      `name:"remaining_capacity" unit:"Ah" multiplier:"0.001" precision:"2"`
+	FullCapacity      uint32     `name:"full_capacity" unit:"Ah" multiplier:"0.001" precision:"2"`
+	CycleCounts       uint32     `name:"cycle_counts" icon:"mdi:battery-sync"`
+	CycleCapacity     uint32     `name:"cycle_capacity" unit:"Ah" multiplier:"0.001" precision:"1"`
+	SOH               uint8      `name:"soh" unit:"%"`
+	_                 uint8      // Precharge status.
+	_                 uint16     // User alarms.
+	RunTime           uint32     `name:"run_time" dclass:"duration" unit:"s"`
+	ChargingMOSFET    uint8      `name:"charging_mosfet" values:"0:off,1:on"`
+	DischargingMOSFET uint8      `name:"discharging_mosfet" values:"0:off,1:on"`
+	// end of Modbus fields.
+}
+
+type JKBatteryInfo struct {
+	JKModbusBatteryInfo
+	VoltageStats
+}
+
+type JKModbusExtraBatteryInfo struct {
+	Model           [16]byte `name:"model" type:"string"`
+	HardwareVersion [8]byte  `name:"hardware_version" type:"string"`
+	SoftwareVersion [8]byte  `name:"firmware_version" type:"string"`
+}
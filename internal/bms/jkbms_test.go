@@ -0,0 +1,231 @@
+package bms_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bms_pkg "wombatt/internal/bms"
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
+)
+
+func TestJKBMS_ReadInfo(t *testing.T) {
+	client := new(mockModbusClient)
+	bms := bms_pkg.NewJK()
+
+	expectedInfo := bms_pkg.JKModbusBatteryInfo{
+		CellVoltages:      [16]uint16{3300, 3301, 3302, 3303, 3304, 3305, 3306, 3307, 3308, 3309, 3310, 3311, 3312, 3313, 3314, 3315},
+		CellsPresent:      0xffff,
+		CellVoltageDiff:   15,
+		MaxVoltageCell:    15,
+		MinVoltageCell:    0,
+		MOSFETTemp:        312,
+		Voltage:           52920,
+		Power:             529200,
+		Current:           -10000,
+		Temp1:             251,
+		Temp2:             -12,
+		Alarms:            0x00000030,
+		BalanceCurrent:    -120,
+		BalanceStatus:     2,
+		SOC:               87,
+		RemainingCapacity: 243600,
+		FullCapacity:      280000,
+		CycleCounts:       42,
+		CycleCapacity:     11760000,
+		SOH:               99,
+		RunTime:           3600,
+		ChargingMOSFET:    1,
+		DischargingMOSFET: 1,
+	}
+
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.BigEndian, &expectedInfo)
+	assert.NoError(t, err)
+	response := buf.Bytes()
+	assert.Len(t, response, 97*2)
+
+	client.On("ReadHoldingRegisters", uint8(0x01), uint16(0x1200), uint8(len(response)/2)).Return(response, nil)
+
+	info, err := bms.ReadInfo(client, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, info)
+
+	jInfo, ok := info.(*bms_pkg.JKBatteryInfo)
+	assert.True(t, ok)
+	assert.NotNil(t, jInfo)
+
+	// Assertions for the fields
+	assert.Equal(t, expectedInfo, jInfo.JKModbusBatteryInfo)
+	assert.Equal(t, bms_pkg.VoltageStats{MaxVoltage: 3315, MinVoltage: 3300, MeanVoltage: 3307, MedianVoltage: 3307}, jInfo.VoltageStats)
+
+	// Values as published.
+	values := make(map[string]any)
+	common.TraverseStruct(jInfo, func(info map[string]string, v any) {
+		values[info["name"]] = v
+	})
+	assert.Equal(t, 52.92, values["battery_voltage"])
+	assert.Equal(t, -10.0, values["current"])
+	assert.Equal(t, -0.12, values["balance_current"])
+	assert.Equal(t, 31.2, values["mosfet_temp"])
+	assert.Equal(t, -1.2, values["temp2"])
+	assert.Equal(t, "pack overvoltage, cell overvoltage", values["alarms"])
+	assert.Equal(t, "discharging", values["balance_status"])
+	assert.Equal(t, uint32(42), values["cycle_counts"])
+
+	client.AssertExpectations(t)
+}
+
+func TestJKBMS_ReadInfoMissingCells(t *testing.T) {
+	client := new(mockModbusClient)
+	bms := bms_pkg.NewJK()
+
+	expectedInfo := bms_pkg.JKModbusBatteryInfo{
+		CellVoltages:    [16]uint16{3300, 3310, 3290, 3305},
+		CellsPresent:    0x0f,
+		CellVoltageDiff: 20,
+		MaxVoltageCell:  1,
+		MinVoltageCell:  2,
+		Voltage:         13205,
+		SOC:             50,
+	}
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.BigEndian, &expectedInfo)
+	assert.NoError(t, err)
+	response := buf.Bytes()
+
+	client.On("ReadHoldingRegisters", uint8(0x01), uint16(0x1200), uint8(len(response)/2)).Return(response, nil)
+
+	info, err := bms.ReadInfo(client, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	jInfo, ok := info.(*bms_pkg.JKBatteryInfo)
+	assert.True(t, ok)
+	assert.Equal(t, expectedInfo, jInfo.JKModbusBatteryInfo)
+	// The 12 empty cells are not in the stats.
+	assert.Equal(t, bms_pkg.VoltageStats{MaxVoltage: 3310, MinVoltage: 3290, MeanVoltage: 3301, MedianVoltage: 3302}, jInfo.VoltageStats)
+
+	client.AssertExpectations(t)
+}
+
+func TestJKBMS_ReadExtraInfo(t *testing.T) {
+	client := new(mockModbusClient)
+	bms := bms_pkg.NewJK()
+
+	expectedExtraInfo := bms_pkg.JKModbusExtraBatteryInfo{
+		Model:           [16]byte{'J', 'K', '_', 'P', 'B', '2', 'A', '1', '6', 'S', '2', '0', 'P'},
+		HardwareVersion: [8]byte{'1', '5', 'A'},
+		SoftwareVersion: [8]byte{'1', '5', '.', '2', '4'},
+	}
+
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.BigEndian, &expectedExtraInfo)
+	assert.NoError(t, err)
+	response := buf.Bytes()
+
+	client.On("ReadHoldingRegisters", uint8(0x01), uint16(0x1400), uint8(16)).Return(response, nil)
+
+	extraInfo, err := bms.ReadExtraInfo(client, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, extraInfo)
+
+	jExtraInfo, ok := extraInfo.(*bms_pkg.JKModbusExtraBatteryInfo)
+	assert.True(t, ok)
+	assert.NotNil(t, jExtraInfo)
+	assert.Equal(t, &expectedExtraInfo, jExtraInfo)
+
+	client.AssertExpectations(t)
+}
+
+// jkNativeResponse returns the JK native protocol response to a "read all" request with 'data'.
+func jkNativeResponse(t *testing.T, data string) io.Reader {
+	b, err := hex.DecodeString("4e570000000000000600" + "01" + data + "00000000" + "68")
+	assert.NoError(t, err)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)+4-2))
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return bytes.NewReader(binary.BigEndian.AppendUint32(b, uint32(sum)))
+}
+
+func TestJKBMS_ReadInfoNative(t *testing.T) {
+	resp := jkNativeResponse(t, "790c"+"010ce4"+"020ce5"+"030ce2"+"040ce6"+ // Cell voltages.
+		"800019"+"810069"+"820014"+ // MOS, box and battery temperatures.
+		"830532"+"848190"+"8557"+"87002a"+"8900000064"+ // Voltage, current, SOC and cycles.
+		"8b0404"+"8c0003"+"aa00000118"+"b60000003c"+"c001"+ // Alarms, status, capacity and run time.
+		"ff00") // Unknown codes are ignored.
+	var req bytes.Buffer
+	reader, err := modbus.Reader(common.NewTestPort(resp, &req, 0), modbus.JKProtocol, "")
+	assert.NoError(t, err)
+
+	info, err := bms_pkg.NewJK().ReadInfo(reader, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	jInfo, ok := info.(*bms_pkg.JKBatteryInfo)
+	assert.True(t, ok)
+	assert.Equal(t, "4e5700130000000006030000000000006800000129", hex.EncodeToString(req.Bytes()))
+	assert.Equal(t, [16]uint16{3300, 3301, 3298, 3302}, jInfo.CellVoltages)
+	assert.Equal(t, uint8(3), jInfo.MaxVoltageCell)
+	assert.Equal(t, uint8(2), jInfo.MinVoltageCell)
+	assert.Equal(t, uint16(4), jInfo.CellVoltageDiff)
+	assert.Equal(t, bms_pkg.VoltageStats{MaxVoltage: 3302, MinVoltage: 3298, MeanVoltage: 3300, MedianVoltage: 3300}, jInfo.VoltageStats)
+	assert.Equal(t, int32(243600), jInfo.RemainingCapacity)
+	assert.Equal(t, uint32(100000), jInfo.CycleCapacity)
+
+	// Values as published.
+	values := make(map[string]any)
+	common.TraverseStruct(jInfo, func(info map[string]string, v any) {
+		values[info["name"]] = v
+	})
+	assert.Equal(t, 13.3, values["battery_voltage"])
+	assert.Equal(t, 4.0, values["current"])
+	assert.Equal(t, 53.2, values["power"])
+	assert.Equal(t, 25.0, values["mosfet_temp"])
+	assert.Equal(t, -5.0, values["temp1"])
+	assert.Equal(t, 20.0, values["temp2"])
+	assert.Equal(t, "pack overvoltage, cell overvoltage", values["alarms"])
+	assert.Equal(t, uint8(87), values["soc"])
+	assert.Equal(t, uint32(42), values["cycle_counts"])
+	assert.Equal(t, 280.0, values["full_capacity"])
+	assert.Equal(t, uint32(3600), values["run_time"])
+	assert.Equal(t, "on", values["charging_mosfet"])
+	assert.Equal(t, "on", values["discharging_mosfet"])
+}
+
+func TestJKBMS_ReadInfoNativeDischarging(t *testing.T) {
+	reader, err := modbus.Reader(common.NewTestPort(jkNativeResponse(t, "830532"+"8401f4"), io.Discard, 0), modbus.JKProtocol, "")
+	assert.NoError(t, err)
+	info, err := bms_pkg.NewJK().ReadInfo(reader, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(-5000), info.(*bms_pkg.JKBatteryInfo).Current)
+	assert.Equal(t, uint32(66500), info.(*bms_pkg.JKBatteryInfo).Power)
+}
+
+func TestJKBMS_ReadInfoNativeTruncated(t *testing.T) {
+	reader, err := modbus.Reader(common.NewTestPort(jkNativeResponse(t, "830532"+"89000000"), io.Discard, 0), modbus.JKProtocol, "")
+	assert.NoError(t, err)
+	_, err = bms_pkg.NewJK().ReadInfo(reader, 0x01, 1*time.Second)
+	assert.EqualError(t, err, "truncated data for identification code 0x89")
+}
+
+func TestJKBMS_ReadExtraInfoNative(t *testing.T) {
+	resp := jkNativeResponse(t, "b4"+hex.EncodeToString([]byte("JK_B2A24"))+
+		"b5"+hex.EncodeToString([]byte("2103"))+
+		"b7"+hex.EncodeToString([]byte("10.XW_S10.26___"))+
+		"ba"+hex.EncodeToString([]byte("JK-BMS-MANUFACTURER-NAME")))
+	reader, err := modbus.Reader(common.NewTestPort(resp, io.Discard, 0), modbus.JKProtocol, "")
+	assert.NoError(t, err)
+
+	extraInfo, err := bms_pkg.NewJK().ReadExtraInfo(reader, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &bms_pkg.JKNativeExtraBatteryInfo{
+		Manufacturer:    [24]byte([]byte("JK-BMS-MANUFACTURER-NAME")),
+		DeviceID:        [8]byte([]byte("JK_B2A24")),
+		ProductionDate:  [4]byte([]byte("2103")),
+		SoftwareVersion: [15]byte([]byte("10.XW_S10.26___")),
+	}, extraInfo)
+}
@@ -0,0 +1,194 @@
+package bms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+const jkNativeReadAllCommand uint8 = 0x06
+
+// Data identification codes of the JK native protocol.
+const (
+	jkNativeCellVoltages    uint8 = 0x79
+	jkNativeMOSFETTemp      uint8 = 0x80
+	jkNativeBoxTemp         uint8 = 0x81
+	jkNativeBatteryTemp     uint8 = 0x82
+	jkNativeVoltage         uint8 = 0x83
+	jkNativeCurrent         uint8 = 0x84
+	jkNativeSOC             uint8 = 0x85
+	jkNativeCycleCounts     uint8 = 0x87
+	jkNativeCycleCapacity   uint8 = 0x89
+	jkNativeAlarms          uint8 = 0x8b
+	jkNativeStatus          uint8 = 0x8c
+	jkNativeCapacity        uint8 = 0xaa
+	jkNativeDeviceID        uint8 = 0xb4
+	jkNativeProductionDate  uint8 = 0xb5
+	jkNativeRunTime         uint8 = 0xb6
+	jkNativeSoftwareVersion uint8 = 0xb7
+	jkNativeManufacturer    uint8 = 0xba
+)
+
+// jkNativeItemLengths has the data length of each item of the "read all" response. The cell voltages
+// are not included, as their data starts with its own length.
+// Reference: JK BMS RS485 communication protocol V2.5.
+var jkNativeItemLengths = map[uint8]int{
+	0x80: 2, 0x81: 2, 0x82: 2, 0x83: 2, 0x84: 2, 0x85: 1, 0x86: 1, 0x87: 2, 0x89: 4, 0x8a: 2, 0x8b: 2,
+	0x8c: 2, 0x8e: 2, 0x8f: 2, 0x90: 2, 0x91: 2, 0x92: 2, 0x93: 2, 0x94: 2, 0x95: 2, 0x96: 2, 0x97: 2,
+	0x98: 2, 0x99: 2, 0x9a: 2, 0x9b: 2, 0x9c: 2, 0x9d: 1, 0x9e: 2, 0x9f: 2, 0xa0: 2, 0xa1: 2, 0xa2: 2,
+	0xa3: 2, 0xa4: 2, 0xa5: 2, 0xa6: 2, 0xa7: 2, 0xa8: 2, 0xa9: 1, 0xaa: 4, 0xab: 1, 0xac: 1, 0xad: 2,
+	0xae: 1, 0xaf: 1, 0xb0: 2, 0xb1: 1, 0xb2: 10, 0xb3: 1, 0xb4: 8, 0xb5: 4, 0xb6: 4, 0xb7: 15, 0xb8: 1,
+	0xb9: 4, 0xba: 24, 0xbb: 1, 0xbc: 1, 0xbd: 1, 0xbe: 2, 0xbf: 2, 0xc0: 1,
+}
+
+// jkNativeAlarmBits maps the bits of the native alarms to the bits of the Modbus ones, so both
+// protocols report the same alarms. The low capacity, cell voltage difference and box over temp
+// alarms have no Modbus equivalent and are not reported.
+var jkNativeAlarmBits = map[int]int{
+	1:  1,  // MOS over temp
+	2:  5,  // pack overvoltage
+	3:  12, // pack undervoltage
+	4:  21, // battery over temp
+	5:  6,  // charge overcurrent
+	6:  13, // discharge overcurrent
+	9:  9,  // battery under temp
+	10: 4,  // cell overvoltage
+	11: 11, // cell undervoltage
+}
+
+// parseJKNativeData splits the data of a "read all" response into its items, indexed by their
+// data identification code. The items after an unknown code are ignored, as their length is unknown.
+func parseJKNativeData(data []byte) (map[uint8][]byte, error) {
+	items := make(map[uint8][]byte)
+	for len(data) > 0 {
+		id := data[0]
+		data = data[1:]
+		n, ok := jkNativeItemLengths[id]
+		if id == jkNativeCellVoltages && len(data) > 0 {
+			n, ok = 1+int(data[0]), true
+		}
+		if !ok {
+			slog.Debug("unknown JK data identification code", "code", fmt.Sprintf("0x%02x", id))
+			break
+		}
+		if len(data) < n {
+			return nil, fmt.Errorf("truncated data for identification code 0x%02x", id)
+		}
+		items[id] = data[:n]
+		data = data[n:]
+	}
+	return items, nil
+}
+
+func (*JK) readNativeItems(reader modbus.RegisterReader, id uint8, timeout time.Duration) (map[uint8][]byte, error) {
+	data, err := readWithTimeout(reader, timeout, id, 0, jkNativeReadAllCommand)
+	if err != nil {
+		return nil, err
+	}
+	return parseJKNativeData(data)
+}
+
+// jkNativeTemp returns a native temperature in tenths of °C. Values above 100 are negative temperatures.
+func jkNativeTemp(v uint16) int16 {
+	if v > 100 {
+		return -int16(v-100) * 10
+	}
+	return int16(v) * 10
+}
+
+// readNativeInfo reads the same information as the Modbus protocol, but for the balance current and
+// the SOH, which are not available. The remaining capacity is estimated from the SOC.
+func (e *JK) readNativeInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	items, err := e.readNativeItems(reader, id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	u8 := func(code uint8) uint8 {
+		if b := items[code]; len(b) == 1 {
+			return b[0]
+		}
+		return 0
+	}
+	u16 := func(code uint8) uint16 {
+		if b := items[code]; len(b) == 2 {
+			return binary.BigEndian.Uint16(b)
+		}
+		return 0
+	}
+	u32 := func(code uint8) uint32 {
+		if b := items[code]; len(b) == 4 {
+			return binary.BigEndian.Uint32(b)
+		}
+		return 0
+	}
+
+	var result JKBatteryInfo
+	cells := items[jkNativeCellVoltages]
+	numCells := 0
+	for i := 1; i+3 <= len(cells); i += 3 { // Cell number, starting at 1, and voltage.
+		if n := int(cells[i]); n >= 1 && n <= len(result.CellVoltages) {
+			result.CellVoltages[n-1] = binary.BigEndian.Uint16(cells[i+1:])
+			numCells = max(numCells, n)
+		}
+	}
+	for i := range numCells {
+		if result.CellVoltages[i] > result.CellVoltages[result.MaxVoltageCell] {
+			result.MaxVoltageCell = uint8(i)
+		}
+		if result.CellVoltages[i] < result.CellVoltages[result.MinVoltageCell] {
+			result.MinVoltageCell = uint8(i)
+		}
+	}
+	result.CellVoltageDiff = result.CellVoltages[result.MaxVoltageCell] - result.CellVoltages[result.MinVoltageCell]
+	updateVoltageStats(result.CellVoltages[:numCells], &result.VoltageStats)
+
+	result.MOSFETTemp = jkNativeTemp(u16(jkNativeMOSFETTemp))
+	result.Temp1 = jkNativeTemp(u16(jkNativeBoxTemp))
+	result.Temp2 = jkNativeTemp(u16(jkNativeBatteryTemp))
+	result.Voltage = uint32(u16(jkNativeVoltage)) * 10
+	// The highest bit of the current is set when charging.
+	if current := u16(jkNativeCurrent); current&0x8000 != 0 {
+		result.Current = int32(current&0x7fff) * 10
+	} else {
+		result.Current = -int32(current) * 10
+	}
+	result.Power = uint32(uint64(result.Voltage) * uint64(max(result.Current, -result.Current)) / 1000)
+	for native, bit := range jkNativeAlarmBits {
+		if u16(jkNativeAlarms)&(1<<native) != 0 {
+			result.Alarms |= 1 << bit
+		}
+	}
+	result.SOC = u8(jkNativeSOC)
+	result.FullCapacity = u32(jkNativeCapacity) * 1000
+	result.RemainingCapacity = int32(uint64(result.FullCapacity) * uint64(result.SOC) / 100)
+	result.CycleCounts = uint32(u16(jkNativeCycleCounts))
+	result.CycleCapacity = u32(jkNativeCycleCapacity) * 1000
+	result.RunTime = u32(jkNativeRunTime) * 60
+	status := u16(jkNativeStatus)
+	result.ChargingMOSFET = uint8(status & 1)
+	result.DischargingMOSFET = uint8(status >> 1 & 1)
+	return &result, nil
+}
+
+func (e *JK) readNativeExtraInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	items, err := e.readNativeItems(reader, id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var result JKNativeExtraBatteryInfo
+	copy(result.Manufacturer[:], items[jkNativeManufacturer])
+	copy(result.DeviceID[:], items[jkNativeDeviceID])
+	copy(result.ProductionDate[:], items[jkNativeProductionDate])
+	copy(result.SoftwareVersion[:], items[jkNativeSoftwareVersion])
+	return &result, nil
+}
+
+type JKNativeExtraBatteryInfo struct {
+	Manufacturer    [24]byte `name:"manufacturer" type:"string"`
+	DeviceID        [8]byte  `name:"device_id" type:"string"`
+	ProductionDate  [4]byte  `name:"production_date" type:"string"`
+	SoftwareVersion [15]byte `name:"firmware_version" type:"string"`
+}
@@ -30,7 +30,7 @@ func (*Pace) InfoInstance() any {
 
 func (*Pace) DefaultProtocol(deviceType string) string {
 	switch deviceType {
-	case "tcp":
+	case "tcp", "udp":
 		return modbus.TCPProtocol
 	default:
 		return modbus.RTUProtocol
@@ -56,7 +56,7 @@ func (e *Pace) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Dur
 		return nil, err
 	}
 	result := PaceBatteryInfo{PaceModbusBatteryInfo: info}
-	updateVoltageStats(result.CellVoltages, &result.VoltageStats)
+	updateVoltageStats(result.CellVoltages[:], &result.VoltageStats)
 	return &result, nil
 }
 
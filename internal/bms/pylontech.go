@@ -0,0 +1,206 @@
+package bms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+const (
+	pylontechAnalogValueCommand     uint8 = 0x42
+	pylontechAlarmInfoCommand       uint8 = 0x44
+	pylontechSystemParameterCommand uint8 = 0x47
+)
+
+// Pylontech reads Pylontech batteries (US2000, US3000, etc.) using their RS485 protocol, which has
+// the same framing as lifepower4. In a stack, each module has its own address, starting at 2 for
+// the master module.
+type Pylontech struct {
+}
+
+func NewPylontech() BMS {
+	return &Pylontech{}
+}
+
+func (*Pylontech) InfoInstance() any {
+	return &PylontechBatteryInfo{}
+}
+
+func (*Pylontech) DefaultProtocol(_ string) string {
+	return modbus.PylontechProtocol
+}
+
+// readPylontechValues reads 'values' in order from 'r', like binary.Read does for struct fields.
+func readPylontechValues(r io.Reader, values ...any) error {
+	for _, v := range values {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+	}
+	return nil
+}
+
+// readCounted reads a count byte followed by that many values of 'T'. Only the first len(dst)
+// values are kept in 'dst'.
+func readCounted[T uint8 | uint16](r io.Reader, dst []T) (uint8, error) {
+	var n uint8
+	if err := readPylontechValues(r, &n); err != nil {
+		return 0, err
+	}
+	values := make([]T, n)
+	if err := readPylontechValues(r, values); err != nil {
+		return 0, err
+	}
+	copy(dst, values)
+	return n, nil
+}
+
+func (*Pylontech) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	// The number of cells and temperatures depends on the model, so the response is decoded by hand.
+	data, err := readWithTimeout(reader, timeout, id, 0, pylontechAnalogValueCommand)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	var result PylontechBatteryInfo
+	var header struct {
+		DataFlag uint8
+		Address  uint8
+	}
+	if err := readPylontechValues(r, &header); err != nil {
+		return nil, err
+	}
+	if result.NumberOfCells, err = readCounted(r, result.CellVoltages[:]); err != nil {
+		return nil, err
+	}
+	// The first temperature is the BMS board one.
+	var temps [1 + len(result.CellTemps)]uint16
+	if _, err := readCounted(r, temps[:]); err != nil {
+		return nil, err
+	}
+	result.BMSTemp = temps[0]
+	copy(result.CellTemps[:], temps[1:])
+	var values struct {
+		Current           int16
+		Voltage           uint16
+		RemainingCapacity uint16
+		UserDefined       uint8 // 2, or 4 when the capacities don't fit in 16 bits.
+		FullCapacity      uint16
+		CycleCounts       uint16
+	}
+	if err := readPylontechValues(r, &values); err != nil {
+		return nil, err
+	}
+	result.Current = values.Current
+	result.Voltage = values.Voltage
+	result.RemainingCapacity = uint32(values.RemainingCapacity)
+	result.FullCapacity = uint32(values.FullCapacity)
+	result.CycleCounts = values.CycleCounts
+	if values.UserDefined >= 4 {
+		var capacities [6]byte // 24-bit remaining and full capacities.
+		if err := readPylontechValues(r, &capacities); err != nil {
+			return nil, err
+		}
+		result.RemainingCapacity = uint32(capacities[0])<<16 | uint32(capacities[1])<<8 | uint32(capacities[2])
+		result.FullCapacity = uint32(capacities[3])<<16 | uint32(capacities[4])<<8 | uint32(capacities[5])
+	}
+	if result.FullCapacity > 0 {
+		result.SOC = uint8(min(100, (uint64(result.RemainingCapacity)*100+uint64(result.FullCapacity)/2)/uint64(result.FullCapacity)))
+	}
+	return &result, nil
+}
+
+func (p *Pylontech) ReadExtraInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var result PylontechExtraBatteryInfo
+	if err := p.readAlarmInfo(&result.PylontechAlarmInfo, reader, id, timeout); err != nil {
+		return nil, err
+	}
+	if _, err := readIntoStruct(&result.PylontechSystemParameters, reader, timeout, id, 0, pylontechSystemParameterCommand); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (*Pylontech) readAlarmInfo(result *PylontechAlarmInfo, reader modbus.RegisterReader, id uint8, timeout time.Duration) error {
+	data, err := readWithTimeout(reader, timeout, id, 0, pylontechAlarmInfoCommand)
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	var header struct {
+		DataFlag uint8
+		Address  uint8
+	}
+	if err := readPylontechValues(r, &header); err != nil {
+		return err
+	}
+	if result.NumberOfCells, err = readCounted(r, result.CellVoltageAlarms[:]); err != nil {
+		return err
+	}
+	var temps [1 + len(result.CellTempAlarms)]uint8
+	if _, err := readCounted(r, temps[:]); err != nil {
+		return err
+	}
+	result.BMSTempAlarm = temps[0]
+	copy(result.CellTempAlarms[:], temps[1:])
+	return readPylontechValues(r, &result.ChargeCurrentAlarm, &result.ModuleVoltageAlarm, &result.DischargeCurrentAlarm,
+		&result.Status1, &result.Status2, &result.Status3, &result.Status4, &result.Status5)
+}
+
+type PylontechBatteryInfo struct {
+	// Reference: Pylontech RS485 protocol V3.3, analog value (CID2 0x42).
+	NumberOfCells     uint8      `name:"cell_num"`
+	CellVoltages      [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	BMSTemp           uint16     `name:"bms_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	CellTemps         [4]uint16  `name:"cell_temp_%d" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	Current           int16      `name:"current" dclass:"current" unit:"A" multiplier:"0.1" precision:"1" icon:"mdi:current-dc"`
+	Voltage           uint16     `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"2"`
+	RemainingCapacity uint32     `name:"remaining_capacity" unit:"Ah" multiplier:"0.001" precision:"2"`
+	FullCapacity      uint32     `name:"full_capacity" unit:"Ah" multiplier:"0.001" precision:"2"`
+	CycleCounts       uint16     `name:"cycle_counts" icon:"mdi:battery-sync"`
+	SOC               uint8      `name:"soc" dclass:"battery" unit:"%"` // Calculated from the capacities.
+}
+
+type PylontechAlarmInfo struct {
+	// Reference: Pylontech RS485 protocol V3.3, alarm info (CID2 0x44).
+	// The cell, temperature, current and voltage alarms are 0 for normal, 1 for below the lower limit,
+	// 2 for above the upper limit, and 0xF0 for other errors.
+	NumberOfCells         uint8     `skip:"1"`
+	CellVoltageAlarms     [16]uint8 `name:"cell_%d_voltage_alarm"`
+	BMSTempAlarm          uint8     `name:"bms_temp_alarm" values:"0:normal,1:below lower limit,2:above upper limit,240:other error"`
+	CellTempAlarms        [4]uint8  `name:"cell_temp_%d_alarm"`
+	ChargeCurrentAlarm    uint8     `name:"charge_current_alarm" values:"0:normal,1:below lower limit,2:above upper limit,240:other error"`
+	ModuleVoltageAlarm    uint8     `name:"module_voltage_alarm" values:"0:normal,1:below lower limit,2:above upper limit,240:other error"`
+	DischargeCurrentAlarm uint8     `name:"discharge_current_alarm" values:"0:normal,1:below lower limit,2:above upper limit,240:other error"`
+	Status1               uint8     `name:"status_1" flags:"module undervoltage,charge over temp,discharge over temp,discharge overcurrent,0x08,charge overcurrent,cell undervoltage,module overvoltage"`
+	Status2               uint8     `name:"status_2" flags:"0x80,0x40,0x20,0x10,using battery module power,discharge MOSFET,charge MOSFET,pre MOSFET"`
+	Status3               uint8     `name:"status_3" flags:"0x80,0x40,0x20,0x10,0x08,fully charged,0x02,buzzer warning"`
+	Status4               uint8     `name:"status_4" flags:"cell 8 error,cell 7 error,cell 6 error,cell 5 error,cell 4 error,cell 3 error,cell 2 error,cell 1 error"`
+	Status5               uint8     `name:"status_5" flags:"cell 16 error,cell 15 error,cell 14 error,cell 13 error,cell 12 error,cell 11 error,cell 10 error,cell 9 error"`
+}
+
+type PylontechSystemParameters struct {
+	// Reference: Pylontech RS485 protocol V3.3, system parameters (CID2 0x47).
+	_                       uint8  // INFOFLAG
+	CellHighVoltageLimit    uint16 `name:"cell_high_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	CellLowVoltageLimit     uint16 `name:"cell_low_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	CellUnderVoltageLimit   uint16 `name:"cell_under_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	ChargeHighTempLimit     uint16 `name:"charge_high_temp_limit" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	ChargeLowTempLimit      uint16 `name:"charge_low_temp_limit" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	ChargeCurrentLimit      int16  `name:"charge_current_limit" dclass:"current" unit:"A" multiplier:"0.1" precision:"1"`
+	ModuleHighVoltageLimit  uint16 `name:"module_high_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"2"`
+	ModuleLowVoltageLimit   uint16 `name:"module_low_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"2"`
+	ModuleUnderVoltageLimit uint16 `name:"module_under_voltage_limit" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"2"`
+	DischargeHighTempLimit  uint16 `name:"discharge_high_temp_limit" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	DischargeLowTempLimit   uint16 `name:"discharge_low_temp_limit" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	DischargeCurrentLimit   int16  `name:"discharge_current_limit" dclass:"current" unit:"A" multiplier:"0.1" precision:"1"`
+}
+
+type PylontechExtraBatteryInfo struct {
+	PylontechAlarmInfo
+	PylontechSystemParameters
+}
@@ -0,0 +1,198 @@
+package bms
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"wombatt/internal/modbus"
+)
+
+const (
+	seplosV2AnalogValueCommand uint8 = 0x42
+	seplosV2AlarmInfoCommand   uint8 = 0x44
+
+	seplosV3PackInfoAddress       uint16 = 0x1000
+	seplosV3PackInfoRegisterCount uint8  = 17
+	seplosV3CellInfoAddress       uint16 = 0x1100
+	seplosV3CellInfoRegisterCount uint8  = 26
+)
+
+// SeplosV2 reads Seplos BMS using the v2 protocol, which has the same framing as lifepower4.
+type SeplosV2 struct {
+}
+
+func NewSeplosV2() BMS {
+	return &SeplosV2{}
+}
+
+func (*SeplosV2) InfoInstance() any {
+	return &SeplosV2BatteryInfo{}
+}
+
+func (*SeplosV2) DefaultProtocol(_ string) string {
+	return modbus.SeplosV2Protocol
+}
+
+func (*SeplosV2) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var info SeplosV2AnalogValueInfo
+	if _, err := readIntoStruct(&info, reader, timeout, id, 0, seplosV2AnalogValueCommand); err != nil {
+		return nil, err
+	}
+	result := SeplosV2BatteryInfo{SeplosV2AnalogValueInfo: info}
+	updateVoltageStats(result.CellVoltages[:], &result.VoltageStats)
+	return &result, nil
+}
+
+func (*SeplosV2) ReadExtraInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var extra SeplosV2AlarmInfo
+	if _, err := readIntoStruct(&extra, reader, timeout, id, 0, seplosV2AlarmInfoCommand); err != nil {
+		return nil, err
+	}
+	return &extra, nil
+}
+
+type SeplosV2AnalogValueInfo struct {
+	// Reference: Seplos BMS communication protocol V2.0, telemetry (CID2 0x42).
+	DataFlag          uint8      `skip:"1"`
+	_                 uint8      // Pack group.
+	NumberOfCells     uint8      `skip:"1"` // Always 16.
+	CellVoltages      [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	_                 uint8      // Number of temperatures, always 6.
+	CellTemps         [4]uint16  `name:"cell_temp_%d" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	EnvTemp           uint16     `name:"environment_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	MOSFETTemp        uint16     `name:"mosfet_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	Current           int16      `name:"current" dclass:"current" unit:"A" multiplier:"0.01" precision:"2" icon:"mdi:current-dc"`
+	Voltage           uint16     `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.01" precision:"2"`
+	RemainingCapacity uint16     `name:"remaining_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	_                 uint8      // Number of custom values, always 10.
+	FullCapacity      uint16     `name:"full_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	SOC               uint16     `name:"soc" dclass:"battery" unit:"%" multiplier:"0.1" precision:"1"`
+	RatedCapacity     uint16     `name:"rated_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	CycleCounts       uint16     `name:"cycle_counts" icon:"mdi:battery-sync"`
+	SOH               uint16     `name:"soh" unit:"%" multiplier:"0.1" precision:"1"`
+	PortVoltage       uint16     `name:"port_voltage" dclass:"voltage" unit:"V" multiplier:"0.01" precision:"2"`
+	_                 [4]uint16  // Reserved
+}
+
+type SeplosV2BatteryInfo struct {
+	SeplosV2AnalogValueInfo
+	VoltageStats
+}
+
+type SeplosV2AlarmInfo struct {
+	// Reference: Seplos BMS communication protocol V2.0, telesignalization (CID2 0x44).
+	// The cell, temperature, current and voltage alarms are 0 for normal, 1 for below the lower limit,
+	// and 2 for above the upper limit.
+	DataFlag            uint8     `skip:"1"`
+	_                   uint8     // Pack group.
+	NumberOfCells       uint8     `skip:"1"` // Always 16.
+	CellVoltageAlarms   [16]uint8 `name:"cell_%d_voltage_alarm"`
+	_                   uint8     // Number of temperatures, always 6.
+	TempAlarms          [6]uint8  `name:"temp_%d_alarm"`
+	CurrentAlarm        uint8     `name:"current_alarm" values:"0:normal,1:below lower limit,2:above upper limit"`
+	VoltageAlarm        uint8     `name:"voltage_alarm" values:"0:normal,1:below lower limit,2:above upper limit"`
+	_                   uint8     // Number of custom alarms.
+	AlarmEvent1         uint8     `name:"alarm_event_1" flags:"current limit switch failure,discharge switch failure,charge switch failure,cell voltage difference sensing failure,key switch failure,current sensing failure,temperature sensing failure,voltage sensing failure"`
+	AlarmEvent2         uint8     `name:"alarm_event_2" flags:"pack undervoltage protection,pack low voltage alarm,pack overvoltage protection,pack high voltage alarm,cell undervoltage protection,cell low voltage alarm,cell overvoltage protection,cell high voltage alarm"`
+	AlarmEvent3         uint8     `name:"alarm_event_3" flags:"discharge under temp protection,discharge low temp alarm,discharge over temp protection,discharge high temp alarm,charge under temp protection,charge low temp alarm,charge over temp protection,charge high temp alarm"`
+	AlarmEvent4         uint8     `name:"alarm_event_4" flags:"0x80,cell heating,power high temp alarm,power over temp protection,ambient under temp protection,ambient low temp alarm,ambient over temp protection,ambient high temp alarm"`
+	AlarmEvent5         uint8     `name:"alarm_event_5" flags:"output short circuit lockout,transient overcurrent lockout,output short circuit protection,transient overcurrent protection,discharge overcurrent protection,discharge overcurrent alarm,charge overcurrent protection,charge overcurrent alarm"`
+	AlarmEvent6         uint8     `name:"alarm_event_6" flags:"0x80,output connection failure,output reverse polarity protection,cell low voltage charging forbidden,remaining capacity protection,remaining capacity alarm,intermittent charging waiting,charge high voltage protection"`
+	SwitchStatus        uint8     `name:"switch_status" flags:"0x80,0x40,0x20,0x10,heating switch,current limit switch,charge switch,discharge switch"`
+	BalanceStatus       uint16    `name:"balance_status" flags:"cell 8 balancing,cell 7 balancing,cell 6 balancing,cell 5 balancing,cell 4 balancing,cell 3 balancing,cell 2 balancing,cell 1 balancing,cell 16 balancing,cell 15 balancing,cell 14 balancing,cell 13 balancing,cell 12 balancing,cell 11 balancing,cell 10 balancing,cell 9 balancing"`
+	SystemStatus        uint8     `name:"system_status" flags:"0x80,0x40,shutdown,standby,0x08,floating charge,charging,discharging"`
+	DisconnectionStatus uint16    `name:"disconnection_status" flags:"cell 8 disconnected,cell 7 disconnected,cell 6 disconnected,cell 5 disconnected,cell 4 disconnected,cell 3 disconnected,cell 2 disconnected,cell 1 disconnected,cell 16 disconnected,cell 15 disconnected,cell 14 disconnected,cell 13 disconnected,cell 12 disconnected,cell 11 disconnected,cell 10 disconnected,cell 9 disconnected"`
+	AlarmEvent7         uint8     `name:"alarm_event_7" flags:"0x80,0x40,manual charging wait,auto charging wait,0x08,0x04,0x02,0x01"`
+	AlarmEvent8         uint8     `name:"alarm_event_8" flags:"0x80,0x40,0x20,no zero point calibration,no current calibration,no voltage calibration,RTC failure,EEPROM failure"`
+}
+
+// SeplosV3 reads Seplos BMS using the v3 protocol, which is Modbus with the information in input registers.
+type SeplosV3 struct {
+}
+
+func NewSeplosV3() BMS {
+	return &SeplosV3{}
+}
+
+func (*SeplosV3) InfoInstance() any {
+	return &SeplosV3BatteryInfo{}
+}
+
+func (*SeplosV3) DefaultProtocol(deviceType string) string {
+	switch deviceType {
+	case "tcp", "udp":
+		return modbus.TCPProtocol
+	default:
+		return modbus.RTUProtocol
+	}
+}
+
+func (*SeplosV3) readAndValidateSeplosModbusInfo(result any, reader modbus.RegisterReader, id uint8, timeout time.Duration, address uint16, count uint8) error {
+	data, err := readIntoStruct(result, inputReader{reader}, timeout, id, address, count)
+	if err != nil {
+		return err
+	}
+	expectedLen := int(count) * 2
+	if len(data) != expectedLen {
+		slog.Debug("data received", "data", hex.EncodeToString(data))
+		return fmt.Errorf("unexpected data length: got %d, want %d", len(data), expectedLen)
+	}
+	return nil
+}
+
+func (e *SeplosV3) ReadInfo(reader modbus.RegisterReader, id uint8, timeout time.Duration) (any, error) {
+	var result SeplosV3BatteryInfo
+	if err := e.readAndValidateSeplosModbusInfo(&result.SeplosV3PackInfo, reader, id, timeout, seplosV3PackInfoAddress, seplosV3PackInfoRegisterCount); err != nil {
+		return nil, err
+	}
+	if err := e.readAndValidateSeplosModbusInfo(&result.SeplosV3CellInfo, reader, id, timeout, seplosV3CellInfoAddress, seplosV3CellInfoRegisterCount); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReadExtraInfo returns nil, as all the information is read by ReadInfo.
+func (*SeplosV3) ReadExtraInfo(modbus.RegisterReader, uint8, time.Duration) (any, error) {
+	return nil, nil
+}
+
+type SeplosV3PackInfo struct {
+	// The following fields must be in the same order as the input registers available
+	// starting at address 0x1000 and reading 17 registers.
+	// Reference: Seplos BMS 10C/10E Modbus protocol V1.0, pack information A.
+	Voltage                uint16 `name:"battery_voltage" dclass:"voltage" unit:"V" multiplier:"0.01" precision:"2"`
+	Current                int16  `name:"current" dclass:"current" unit:"A" multiplier:"0.01" precision:"2" icon:"mdi:current-dc"`
+	RemainingCapacity      uint16 `name:"remaining_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	FullCapacity           uint16 `name:"full_capacity" unit:"Ah" multiplier:"0.01" precision:"2"`
+	TotalDischargeCapacity uint16 `name:"total_discharge_capacity" unit:"Ah" multiplier:"10"`
+	SOC                    uint16 `name:"soc" dclass:"battery" unit:"%" multiplier:"0.1" precision:"1"`
+	SOH                    uint16 `name:"soh" unit:"%" multiplier:"0.1" precision:"1"`
+	CycleCounts            uint16 `name:"cycle_counts" icon:"mdi:battery-sync"`
+	MeanCellVoltage        uint16 `name:"mean_cell_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MeanCellTemp           uint16 `name:"mean_cell_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	MaxCellVoltage         uint16 `name:"max_cell_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MinCellVoltage         uint16 `name:"min_cell_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	MaxCellTemp            uint16 `name:"max_cell_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	MinCellTemp            uint16 `name:"min_cell_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	_                      uint16 // Reserved
+	MaxDischargeCurrent    uint16 `name:"max_discharging_current" dclass:"current" unit:"A"`
+	MaxChargeCurrent       uint16 `name:"max_charging_current" dclass:"current" unit:"A"`
+}
+
+type SeplosV3CellInfo struct {
+	// The following fields must be in the same order as the input registers available
+	// starting at address 0x1100 and reading 26 registers.
+	// Reference: Seplos BMS 10C/10E Modbus protocol V1.0, pack information B.
+	CellVoltages [16]uint16 `name:"cell_%d_voltage" dclass:"voltage" unit:"V" multiplier:"0.001" precision:"3"`
+	CellTemps    [4]uint16  `name:"cell_temp_%d" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	_            [4]uint16  // Reserved
+	EnvTemp      uint16     `name:"environment_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+	MOSFETTemp   uint16     `name:"mosfet_temp" dclass:"temperature" unit:"K" multiplier:"0.1" precision:"1"`
+}
+
+type SeplosV3BatteryInfo struct {
+	SeplosV3PackInfo
+	SeplosV3CellInfo
+}
@@ -0,0 +1,61 @@
+package bms_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bms_pkg "wombatt/internal/bms"
+)
+
+func TestSeplosV3BMS_ReadInfo(t *testing.T) {
+	client := new(mockModbusClient)
+	bms := bms_pkg.NewSeplosV3()
+
+	expectedInfo := bms_pkg.SeplosV3BatteryInfo{
+		SeplosV3PackInfo: bms_pkg.SeplosV3PackInfo{
+			Voltage:                5312,
+			Current:                -1050,
+			RemainingCapacity:      15300,
+			FullCapacity:           28000,
+			TotalDischargeCapacity: 12,
+			SOC:                    546,
+			SOH:                    1000,
+			CycleCounts:            35,
+			MeanCellVoltage:        3320,
+			MeanCellTemp:           2981,
+			MaxCellVoltage:         3328,
+			MinCellVoltage:         3313,
+			MaxCellTemp:            2984,
+			MinCellTemp:            2978,
+			MaxDischargeCurrent:    200,
+			MaxChargeCurrent:       140,
+		},
+		SeplosV3CellInfo: bms_pkg.SeplosV3CellInfo{
+			CellVoltages: [16]uint16{3313, 3314, 3315, 3316, 3317, 3318, 3319, 3320, 3321, 3322, 3323, 3324, 3325, 3326, 3327, 3328},
+			CellTemps:    [4]uint16{2978, 2980, 2982, 2984},
+			EnvTemp:      2991,
+			MOSFETTemp:   3001,
+		},
+	}
+
+	var pack, cells bytes.Buffer
+	assert.NoError(t, binary.Write(&pack, binary.BigEndian, &expectedInfo.SeplosV3PackInfo))
+	assert.NoError(t, binary.Write(&cells, binary.BigEndian, &expectedInfo.SeplosV3CellInfo))
+
+	// The information is in input registers.
+	client.On("ReadInputRegisters", uint8(0x01), uint16(0x1000), uint8(17)).Return(pack.Bytes(), nil)
+	client.On("ReadInputRegisters", uint8(0x01), uint16(0x1100), uint8(26)).Return(cells.Bytes(), nil)
+
+	info, err := bms.ReadInfo(client, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, &expectedInfo, info)
+
+	extra, err := bms.ReadExtraInfo(client, 0x01, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Nil(t, extra)
+
+	client.AssertExpectations(t)
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// ParseAddress returns a copy of 'opts' with the settings in opts.Address when it is a URL like
+// serial:///dev/ttyUSB0?baud=9600&parity=E or tcp://10.0.0.5:502?proto=rtu.
+// The scheme is the device type, and the query can have these parameters:
+//
+//	baud      baud rate
+//	databits  data bits
+//	parity    N, E, O, M or S
+//	stopbits  1, 1.5 or 2
+//	proto     protocol, e.g., rtu, tcp, rtuovertcp, ascii, lifepower4, auto or ModbusRTU
+//	timeout   read timeout, e.g., 500ms
+//
+// The settings not in the URL are kept from 'opts'. Other addresses are returned as they are.
+func ParseAddress(opts *PortOptions) (*PortOptions, error) {
+	o := *opts
+	if !strings.Contains(opts.Address, "://") {
+		return &o, nil
+	}
+	u, err := url.Parse(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	dtype, ok := DeviceTypeFromString[strings.ToLower(u.Scheme)]
+	if !ok || dtype == TestByteDevice {
+		return nil, fmt.Errorf("invalid device type in address: %s", u.Scheme)
+	}
+	o.Type = dtype
+	switch dtype {
+	case TCPDevice, UDPDevice, RFC2217Device:
+		if u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid %s address '%s': want %s://<host>:<port>", u.Scheme, opts.Address, u.Scheme)
+		}
+		o.Address = u.Host
+	default:
+		o.Address = u.Host + u.Path // The host is only used for names like COM3.
+	}
+	if o.Mode != nil {
+		mode := *o.Mode
+		o.Mode = &mode
+	} else {
+		o.Mode = &serial.Mode{}
+	}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		if err := setAddressParameter(&o, key, value); err != nil {
+			return nil, fmt.Errorf("invalid '%s' in address '%s': %w", key, opts.Address, err)
+		}
+	}
+	return &o, nil
+}
+
+func setAddressParameter(o *PortOptions, key, value string) error {
+	var err error
+	switch key {
+	case "baud":
+		o.Mode.BaudRate, err = strconv.Atoi(value)
+	case "databits":
+		o.Mode.DataBits, err = strconv.Atoi(value)
+	case "parity":
+		parity, ok := map[string]serial.Parity{
+			"N": serial.NoParity,
+			"O": serial.OddParity,
+			"E": serial.EvenParity,
+			"M": serial.MarkParity,
+			"S": serial.SpaceParity,
+		}[strings.ToUpper(value)]
+		if !ok {
+			return fmt.Errorf("want N, E, O, M or S")
+		}
+		o.Mode.Parity = parity
+	case "stopbits":
+		stopBits, ok := map[string]serial.StopBits{
+			"1":   serial.OneStopBit,
+			"1.5": serial.OnePointFiveStopBits,
+			"2":   serial.TwoStopBits,
+		}[value]
+		if !ok {
+			return fmt.Errorf("want 1, 1.5 or 2")
+		}
+		o.Mode.StopBits = stopBits
+	case "proto":
+		o.Protocol = value
+	case "timeout":
+		o.ReadTimeout, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown parameter")
+	}
+	return err
+}
+
+// PortProtocol returns the protocol set in the address 'port' was opened with, if any.
+func PortProtocol(port Port) string {
+	if bp, ok := port.(*busPort); ok {
+		port = bp.Port
+	}
+	if cp, ok := port.(*capturePort); ok {
+		port = cp.Port
+	}
+	if ip, ok := port.(*internalPort); ok && ip.PortOptions != nil {
+		return ip.PortOptions.Protocol
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial"
+)
+
+func TestParseAddress(t *testing.T) {
+	defaults := &PortOptions{
+		Address:     "",
+		Mode:        &serial.Mode{BaudRate: 9600},
+		Type:        SerialDevice,
+		ReadTimeout: time.Second,
+	}
+	tests := []struct {
+		address string
+		want    PortOptions
+		errstr  string
+	}{
+		{
+			address: "/dev/ttyUSB0",
+			want:    PortOptions{Address: "/dev/ttyUSB0", Mode: &serial.Mode{BaudRate: 9600}, Type: SerialDevice, ReadTimeout: time.Second},
+		},
+		{
+			address: "serial:///dev/ttyUSB1?baud=2400&parity=E&databits=7&stopbits=2",
+			want: PortOptions{
+				Address:     "/dev/ttyUSB1",
+				Mode:        &serial.Mode{BaudRate: 2400, DataBits: 7, Parity: serial.EvenParity, StopBits: serial.TwoStopBits},
+				Type:        SerialDevice,
+				ReadTimeout: time.Second,
+			},
+		},
+		{
+			address: "serial://COM3?baud=19200",
+			want:    PortOptions{Address: "COM3", Mode: &serial.Mode{BaudRate: 19200}, Type: SerialDevice, ReadTimeout: time.Second},
+		},
+		{
+			address: "tcp://10.0.0.5:502?proto=rtu&timeout=250ms",
+			want:    PortOptions{Address: "10.0.0.5:502", Mode: &serial.Mode{BaudRate: 9600}, Type: TCPDevice, ReadTimeout: 250 * time.Millisecond, Protocol: "rtu"},
+		},
+		{
+			address: "RFC2217://host:4001/",
+			want:    PortOptions{Address: "host:4001", Mode: &serial.Mode{BaudRate: 9600}, Type: RFC2217Device, ReadTimeout: time.Second},
+		},
+		{
+			address: "pty://",
+			want:    PortOptions{Address: "", Mode: &serial.Mode{BaudRate: 9600}, Type: PTYDevice, ReadTimeout: time.Second},
+		},
+		{
+			address: "usb:///dev/ttyUSB0",
+			errstr:  "invalid device type in address: usb",
+		},
+		{
+			address: "tcp:///dev/ttyUSB0",
+			errstr:  "want tcp://<host>:<port>",
+		},
+		{
+			address: "serial:///dev/ttyUSB0?parity=X",
+			errstr:  "invalid 'parity' in address 'serial:///dev/ttyUSB0?parity=X': want N, E, O, M or S",
+		},
+		{
+			address: "serial:///dev/ttyUSB0?stopbits=3",
+			errstr:  "want 1, 1.5 or 2",
+		},
+		{
+			address: "serial:///dev/ttyUSB0?baud=fast",
+			errstr:  "invalid 'baud'",
+		},
+		{
+			address: "udp://10.0.0.5:502?speed=9600",
+			errstr:  "invalid 'speed' in address 'udp://10.0.0.5:502?speed=9600': unknown parameter",
+		},
+	}
+	for _, tt := range tests {
+		opts := *defaults
+		opts.Address = tt.address
+		got, err := ParseAddress(&opts)
+		if tt.errstr != "" {
+			assert.ErrorContains(t, err, tt.errstr, tt.address)
+			continue
+		}
+		if assert.NoError(t, err, tt.address) {
+			assert.Equal(t, tt.want, *got, tt.address)
+		}
+	}
+	// The defaults are not modified.
+	assert.Equal(t, &serial.Mode{BaudRate: 9600}, defaults.Mode)
+}
+
+func TestDeviceTypeString(t *testing.T) {
+	for name, dtype := range DeviceTypeFromString {
+		assert.Equal(t, name, dtype.String())
+	}
+	assert.Equal(t, "DeviceType(100)", DeviceType(100).String())
+}
@@ -0,0 +1,297 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFailedTurns is the number of turns in a row without reading anything after which a shared
+	// port is reconnected.
+	MaxFailedTurns = 3
+	// MaxNetworkIdle is how long a shared network port can go without reading anything before it is
+	// considered stale and reconnected. Many gateways and Wi-Fi dongles drop idle sessions silently.
+	MaxNetworkIdle = 5 * time.Minute
+)
+
+// bus is a port shared by everything in the process that uses the same address. The users take
+// turns in the order they asked for the port, with an inter-frame gap between turns, and the port
+// is kept open between turns. It is reconnected when it fails or looks stale.
+type bus struct {
+	opts *PortOptions
+	gap  time.Duration
+
+	mu      sync.Mutex
+	port    Port
+	busy    bool
+	waiters []chan struct{}
+	last    time.Time // When the last turn ended.
+
+	// Connection health.
+	broken   bool      // A read or write failed with an error other than a timeout.
+	gen      int       // Incremented every time the port is opened again.
+	failures int       // Turns in a row with read timeouts and nothing read.
+	lastRead time.Time // When data was last read.
+	turnRead bool      // Whether something was read in the current turn.
+	turnFail bool      // Whether a read timed out in the current turn.
+}
+
+var (
+	busesMu sync.Mutex
+	buses   = make(map[string]*bus)
+)
+
+// AcquirePort waits for the turn to use the port at opts.Address, and returns it. Closing the port
+// returned ends the turn, and leaves the port open for the next user. The port is opened with the
+// options of the first user of the address, and its ReadTimeout is set again in every turn. It is
+// reconnected with ReopenWithBackoff after a read or write error, after MaxFailedTurns turns with
+// nothing read, or when a network port was idle for longer than MaxNetworkIdle.
+func AcquirePort(ctx context.Context, opts *PortOptions) (Port, error) {
+	opts, err := ParseAddress(opts)
+	if err != nil {
+		return nil, err
+	}
+	busesMu.Lock()
+	b := buses[opts.Address]
+	if b == nil {
+		b = &bus{opts: opts, gap: interFrameGap(opts)}
+		buses[opts.Address] = b
+	}
+	busesMu.Unlock()
+
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	port := b.port
+	reason := b.recycleReason()
+	b.turnRead, b.turnFail = false, false
+	b.mu.Unlock()
+	switch {
+	case port == nil:
+		port, err = OpenPort(b.opts)
+	case reason != "":
+		slog.Info("reconnecting shared port", "address", b.opts.Address, "reason", reason)
+		err = port.ReopenWithBackoff()
+	}
+	b.mu.Lock()
+	b.port = port
+	if reason != "" {
+		b.gen++
+	}
+	if err == nil && (reason != "" || b.lastRead.IsZero()) {
+		b.broken = false
+		b.failures = 0
+		b.lastRead = time.Now()
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.done()
+		return nil, err
+	}
+	if b.opts.ReadTimeout > 0 {
+		// The previous user may have changed it, and reads on network connections without it
+		// can block forever.
+		_ = port.SetReadTimeout(b.opts.ReadTimeout)
+	}
+	return &busPort{Port: port, bus: b}, nil
+}
+
+// AbandonRead is called when a read on 'port' was given up while it could still be blocked, like
+// when the caller times out waiting for it. The turn counts as failed, and a port returned by
+// AcquirePort is reconnected, which ends the abandoned read before it can take the responses to the
+// next requests. Other ports get their input buffer reset.
+func AbandonRead(port Port) error {
+	p, ok := port.(*busPort)
+	if !ok {
+		return port.ResetInputBuffer()
+	}
+	p.bus.mu.Lock()
+	p.bus.turnFail = true
+	p.bus.mu.Unlock()
+	slog.Info("reconnecting shared port", "address", p.bus.opts.Address, "reason", "read abandoned")
+	return p.ReopenWithBackoff()
+}
+
+// CloseSharedPorts closes the ports kept open by AcquirePort. They are opened again when needed.
+func CloseSharedPorts() {
+	busesMu.Lock()
+	defer busesMu.Unlock()
+	for address, b := range buses {
+		b.mu.Lock()
+		if b.port != nil {
+			_ = b.port.Close()
+		}
+		b.mu.Unlock()
+		delete(buses, address)
+	}
+}
+
+// wait blocks until it is the turn of the caller, with the inter-frame gap after the previous turn.
+func (b *bus) wait(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.busy {
+		b.busy = true
+		b.mu.Unlock()
+	} else {
+		ch := make(chan struct{})
+		b.waiters = append(b.waiters, ch)
+		b.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			b.mu.Lock()
+			for i, w := range b.waiters {
+				if w == ch {
+					b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+					b.mu.Unlock()
+					return ctx.Err()
+				}
+			}
+			b.mu.Unlock()
+			b.done() // The turn was given to us while giving up.
+			return ctx.Err()
+		}
+	}
+	b.mu.Lock()
+	gap := b.gap - time.Since(b.last)
+	b.mu.Unlock()
+	if gap > 0 {
+		time.Sleep(gap)
+	}
+	return nil
+}
+
+// recycleReason returns why the port has to be reconnected before the next turn, or "" if it looks healthy.
+func (b *bus) recycleReason() string {
+	switch {
+	case b.port == nil:
+		return ""
+	case b.broken:
+		return "read or write error"
+	case b.failures >= MaxFailedTurns:
+		return fmt.Sprintf("nothing read in %d turns", b.failures)
+	}
+	switch b.opts.Type {
+	case TCPDevice, UDPDevice, RFC2217Device:
+		if time.Since(b.lastRead) > MaxNetworkIdle {
+			return "idle for too long"
+		}
+	}
+	return ""
+}
+
+// done ends a turn, giving the port to the user that has been waiting for longer.
+func (b *bus) done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = time.Now()
+	if b.turnRead {
+		b.failures = 0
+	} else if b.turnFail {
+		b.failures++
+	}
+	b.turnRead, b.turnFail = false, false
+	if len(b.waiters) == 0 {
+		b.busy = false
+		return
+	}
+	ch := b.waiters[0]
+	b.waiters = b.waiters[1:]
+	close(ch)
+}
+
+// interFrameGap returns the time the line is kept idle between turns. Serial lines use the Modbus RTU
+// gap of 3.5 characters, with a minimum of 1.75ms.
+func interFrameGap(opts *PortOptions) time.Duration {
+	switch opts.Type {
+	case SerialDevice, HidRawDevice, PTYDevice, RFC2217Device:
+	default:
+		return 0
+	}
+	gap := 1750 * time.Microsecond
+	if opts.Mode != nil && opts.Mode.BaudRate > 0 {
+		// 11 bits per character: start, 8 data bits, parity or a second stop bit, and stop.
+		if g := time.Duration(3.5 * 11 * float64(time.Second) / float64(opts.Mode.BaudRate)); g > gap {
+			gap = g
+		}
+	}
+	return gap
+}
+
+// busPort is the port handed out for a turn.
+type busPort struct {
+	Port
+	bus   *bus
+	once  sync.Once
+	ended bool // Set when the turn ends, protected by bus.mu.
+}
+
+func (p *busPort) Read(b []byte) (int, error) {
+	p.bus.mu.Lock()
+	gen := p.bus.gen
+	p.bus.mu.Unlock()
+	n, err := p.Port.Read(b)
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	if p.ended || gen != p.bus.gen {
+		// An abandoned read that finished after its turn, or after the port was opened again,
+		// doesn't tell anything about the port now.
+		return n, err
+	}
+	if n > 0 {
+		p.bus.turnRead = true
+		p.bus.lastRead = time.Now()
+	}
+	if errors.Is(err, ErrReadTimeout) || errors.Is(err, os.ErrDeadlineExceeded) {
+		p.bus.turnFail = true
+	} else if err != nil {
+		p.bus.broken = true
+	}
+	return n, err
+}
+
+func (p *busPort) Write(b []byte) (int, error) {
+	n, err := p.Port.Write(b)
+	if err != nil {
+		p.bus.mu.Lock()
+		p.bus.broken = true
+		p.bus.mu.Unlock()
+	}
+	return n, err
+}
+
+// ReopenWithBackoff reconnects the shared port, for all its users.
+func (p *busPort) ReopenWithBackoff() error {
+	err := p.Port.ReopenWithBackoff()
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	p.bus.gen++
+	p.bus.broken = err != nil
+	if err == nil {
+		p.bus.failures = 0
+		p.bus.lastRead = time.Now()
+	}
+	return err
+}
+
+// Unwrap returns the shared port, which is the same in every turn until it is opened again.
+func (p *busPort) Unwrap() Port {
+	return p.Port
+}
+
+// Close ends the turn. The port is not closed.
+func (p *busPort) Close() error {
+	p.once.Do(func() {
+		p.bus.mu.Lock()
+		p.ended = true
+		p.bus.mu.Unlock()
+		p.bus.done()
+	})
+	return nil
+}
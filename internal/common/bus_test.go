@@ -0,0 +1,222 @@
+package common
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial"
+)
+
+// acceptCounter accepts connections on a local port, and closes them if 'hangUp' is set.
+func acceptCounter(t *testing.T, hangUp bool) (string, func() int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { l.Close() })
+	var mu sync.Mutex
+	accepted := 0
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			accepted++
+			mu.Unlock()
+			if hangUp {
+				conn.Close()
+			} else {
+				t.Cleanup(func() { conn.Close() })
+			}
+		}
+	}()
+	return l.Addr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return accepted
+	}
+}
+
+func TestAcquirePortKeepsPortOpen(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, accepted := acceptCounter(t, false)
+	opts := &PortOptions{Address: "tcp://" + address}
+	for range 3 {
+		port, err := AcquirePort(context.Background(), opts)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = port.Write([]byte{1})
+		assert.NoError(t, err)
+		assert.Equal(t, TCPDevice, port.Type())
+		assert.NoError(t, port.Close())
+		assert.NoError(t, port.Close()) // A second close does not end the turn of the next user.
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, accepted())
+}
+
+func TestAcquirePortReopensAfterError(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, accepted := acceptCounter(t, true)
+	opts := &PortOptions{Address: address, Type: TCPDevice, ReadTimeout: time.Second}
+	for range 2 {
+		port, err := AcquirePort(context.Background(), opts)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = port.Read(make([]byte, 1))
+		assert.Error(t, err)
+		port.Close()
+	}
+	assert.Equal(t, 2, accepted())
+}
+
+func TestAcquirePortTurns(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, _ := acceptCounter(t, false)
+	opts := &PortOptions{Address: address, Type: TCPDevice}
+	first, err := AcquirePort(context.Background(), opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Go(func() {
+			port, err := AcquirePort(context.Background(), opts)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			port.Close()
+		})
+		time.Sleep(20 * time.Millisecond) // So that they wait in order.
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = AcquirePort(ctx, opts)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	first.Close()
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2}, order)
+}
+
+func TestInterFrameGap(t *testing.T) {
+	tests := []struct {
+		opts *PortOptions
+		want time.Duration
+	}{
+		{&PortOptions{Type: SerialDevice, Mode: &serial.Mode{BaudRate: 9600}}, 4010416 * time.Nanosecond},
+		{&PortOptions{Type: RFC2217Device, Mode: &serial.Mode{BaudRate: 115200}}, 1750 * time.Microsecond},
+		{&PortOptions{Type: SerialDevice}, 1750 * time.Microsecond},
+		{&PortOptions{Type: TCPDevice, Mode: &serial.Mode{BaudRate: 9600}}, 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, interFrameGap(tt.opts), "%v", tt.opts.Type)
+	}
+}
+
+func TestAcquirePortHealth(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, accepted := acceptCounter(t, false)
+	opts := &PortOptions{Address: address, Type: TCPDevice}
+	turn := func(f func(Port)) {
+		port, err := AcquirePort(context.Background(), opts)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		f(port)
+		port.Close()
+	}
+	timeout := func(port Port) {
+		_ = port.SetReadTimeout(5 * time.Millisecond)
+		_, err := port.Read(make([]byte, 1))
+		assert.Error(t, err)
+	}
+
+	for range MaxFailedTurns {
+		turn(timeout)
+	}
+	assert.Equal(t, 1, accepted())
+	turn(func(Port) {}) // Reconnects after too many turns with read timeouts.
+	assert.Eventually(t, func() bool { return accepted() == 2 }, time.Second, 5*time.Millisecond)
+
+	busesMu.Lock()
+	b := buses[address]
+	busesMu.Unlock()
+	b.mu.Lock()
+	b.lastRead = time.Now().Add(-MaxNetworkIdle - time.Second)
+	b.mu.Unlock()
+	turn(func(Port) {}) // Reconnects a stale network port.
+	turn(func(Port) {})
+	assert.Eventually(t, func() bool { return accepted() == 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAcquirePortSetsReadTimeout(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, _ := acceptCounter(t, false)
+	opts := &PortOptions{Address: address, Type: TCPDevice, ReadTimeout: 20 * time.Millisecond}
+	port, err := AcquirePort(context.Background(), opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_ = port.SetReadTimeout(time.Hour)
+	port.Close()
+
+	port, err = AcquirePort(context.Background(), opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	start := time.Now()
+	_, err = port.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestAbandonRead(t *testing.T) {
+	t.Cleanup(CloseSharedPorts)
+	address, accepted := acceptCounter(t, false)
+	opts := &PortOptions{Address: address, Type: TCPDevice}
+	port, err := AcquirePort(context.Background(), opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := port.Read(make([]byte, 1)) // Blocks, as the port has no read timeout.
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, AbandonRead(port))
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the abandoned read is still blocked")
+	}
+	port.Close()
+	assert.Eventually(t, func() bool { return accepted() == 2 }, time.Second, 5*time.Millisecond)
+
+	busesMu.Lock()
+	b := buses[address]
+	busesMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The error of the abandoned read doesn't count against the new connection.
+	assert.False(t, b.broken)
+	assert.Equal(t, 1, b.failures)
+}
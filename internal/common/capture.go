@@ -0,0 +1,160 @@
+package common
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptureFormat is the format of the records written by a Capture.
+type CaptureFormat int
+
+const (
+	// JSONLCapture writes one JSON object per line with the time, port, direction and data in hexadecimal.
+	JSONLCapture CaptureFormat = iota
+	// PcapCapture writes a pcap file with the LINKTYPE_USER0 link type. Each packet starts
+	// with the direction (0 for reads, 1 for writes), the length of the port address and
+	// the address, followed by the data.
+	PcapCapture
+)
+
+const pcapLinkTypeUser0 = 147
+
+// Capture records the data read from and written to ports. It is safe for concurrent use.
+type Capture struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format CaptureFormat
+	now    func() time.Time
+}
+
+// NewCapture returns a Capture writing to 'w' in 'format'. For pcap, the file header is written first.
+func NewCapture(w io.Writer, format CaptureFormat) (*Capture, error) {
+	c := &Capture{w: w, format: format, now: time.Now}
+	if format == PcapCapture {
+		header := struct {
+			Magic        uint32
+			VersionMajor uint16
+			VersionMinor uint16
+			ThisZone     int32
+			SigFigs      uint32
+			SnapLen      uint32
+			LinkType     uint32
+		}{0xa1b2c3d4, 2, 4, 0, 0, 65535, pcapLinkTypeUser0}
+		if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// CreateCapture creates the file 'name' and returns a Capture writing to it.
+// Files ending in .pcap use PcapCapture and any other JSONLCapture.
+func CreateCapture(name string) (*Capture, io.Closer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := JSONLCapture
+	if strings.EqualFold(filepath.Ext(name), ".pcap") {
+		format = PcapCapture
+	}
+	c, err := NewCapture(f, format)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return c, f, nil
+}
+
+type captureRecord struct {
+	Time      time.Time `json:"time"`
+	Port      string    `json:"port"`
+	Direction string    `json:"direction"`
+	Data      string    `json:"data"`
+}
+
+// record writes a record for 'data' read from or written to the port at 'address'.
+func (c *Capture) record(address string, write bool, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.format == JSONLCapture {
+		dir := "read"
+		if write {
+			dir = "write"
+		}
+		b, _ := json.Marshal(&captureRecord{Time: now, Port: address, Direction: dir, Data: hex.EncodeToString(data)})
+		_, _ = c.w.Write(append(b, '\n'))
+		return
+	}
+	if len(address) > 255 {
+		address = address[:255]
+	}
+	var dir byte
+	if write {
+		dir = 1
+	}
+	packet := append([]byte{dir, byte(len(address))}, address...)
+	packet = append(packet, data...)
+	header := []uint32{uint32(now.Unix()), uint32(now.Nanosecond() / 1000), uint32(len(packet)), uint32(len(packet))}
+	_ = binary.Write(c.w, binary.LittleEndian, header)
+	_, _ = c.w.Write(packet)
+}
+
+var (
+	captureMu sync.Mutex
+	capture   *Capture
+)
+
+// SetCapture makes all the ports opened afterwards record their data in 'c'. A nil 'c'
+// disables capturing for new ports.
+func SetCapture(c *Capture) {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	capture = c
+}
+
+func currentCapture() *Capture {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	return capture
+}
+
+// capturePort records all the data read from and written to the embedded Port.
+type capturePort struct {
+	Port
+	address string
+	capture *Capture
+}
+
+// NewCapturePort returns a Port that records the data read from and written to 'port' in 'c'.
+// 'address' identifies the port in the records.
+func NewCapturePort(port Port, address string, c *Capture) Port {
+	return &capturePort{Port: port, address: address, capture: c}
+}
+
+func (p *capturePort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	if n > 0 {
+		p.capture.record(p.address, false, b[:n])
+	}
+	return n, err
+}
+
+func (p *capturePort) Write(b []byte) (int, error) {
+	n, err := p.Port.Write(b)
+	if n > 0 {
+		p.capture.record(p.address, true, b[:n])
+	}
+	return n, err
+}
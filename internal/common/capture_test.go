@@ -0,0 +1,47 @@
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureJSONL(t *testing.T) {
+	var out bytes.Buffer
+	c, err := NewCapture(&out, JSONLCapture)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC) }
+
+	port := NewCapturePort(NewTestPort(bytes.NewReader([]byte{0x01, 0x02}), &bytes.Buffer{}, TestByteDevice), "/dev/ttyUSB0", c)
+	_, err = port.Write([]byte{0xaa, 0xbb})
+	assert.NoError(t, err)
+	b := make([]byte, 10)
+	n, err := port.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, _ = port.Read(b) // EOF, not recorded.
+
+	want := `{"time":"2024-01-02T03:04:05.006Z","port":"/dev/ttyUSB0","direction":"write","data":"aabb"}
+{"time":"2024-01-02T03:04:05.006Z","port":"/dev/ttyUSB0","direction":"read","data":"0102"}
+`
+	assert.Equal(t, want, out.String())
+}
+
+func TestCapturePcap(t *testing.T) {
+	var out bytes.Buffer
+	c, err := NewCapture(&out, PcapCapture)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return time.Unix(0x01020304, 5000) }
+
+	port := NewCapturePort(NewTestPort(nil, &bytes.Buffer{}, TestByteDevice), "p1", c)
+	_, err = port.Write([]byte{0xaa, 0xbb})
+	assert.NoError(t, err)
+
+	want := "d4c3b2a1" + "0200" + "0400" + "00000000" + "00000000" + "ffff0000" + "93000000" + // Header
+		"04030201" + "05000000" + "06000000" + "06000000" + // Packet header
+		"01" + "02" + "7031" + "aabb" // Direction, address and data
+	assert.Equal(t, want, hex.EncodeToString(out.Bytes()))
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -67,3 +69,24 @@ func TestInternalPortLockConcurrentIO(t *testing.T) {
 		t.Fatal("deadlock detected! Read/Write blocked while Lock is held")
 	}
 }
+
+func TestInternalPortRestoreReadTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	p := &internalPort{ReadWriteCloser: client, PortOptions: &PortOptions{Type: TCPDevice, ReadTimeout: 20 * time.Millisecond}}
+	defer p.Close()
+
+	// Zero restores the ReadTimeout of the port instead of removing the deadline.
+	assert.NoError(t, p.SetReadTimeout(0))
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(2 * time.Second):
+		t.Fatal("read blocked with no deadline")
+	}
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pty is the master side of a pseudo-terminal. The slave side is kept open so that reading from
+// the master does not fail while no other process has the slave open.
+type pty struct {
+	*os.File
+	slave   *os.File
+	link    string // Symbolic link to the slave, if any.
+	timeout time.Duration
+}
+
+// OpenPTY creates a pseudo-terminal pair in raw mode. It returns a Port for the master side and
+// the path of the slave side, which other processes can open as a serial port.
+// Reads from the master have no timeout.
+func OpenPTY() (Port, string, error) {
+	p, err := newPTY()
+	if err != nil {
+		return nil, "", err
+	}
+	return &internalPort{ReadWriteCloser: p, PortOptions: &PortOptions{Type: PTYDevice}}, p.slave.Name(), nil
+}
+
+// openPTY creates a pseudo-terminal pair and returns the master side. If opts.Address is not
+// empty, a symbolic link to the slave side is created there, replacing any existing one.
+func openPTY(opts *PortOptions) (Port, error) {
+	p, err := newPTY()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Address != "" {
+		if fi, err := os.Lstat(opts.Address); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			_ = os.Remove(opts.Address)
+		}
+		if err := os.Symlink(p.slave.Name(), opts.Address); err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.link = opts.Address
+	}
+	p.timeout = opts.ReadTimeout
+	slog.Info("created pseudo-terminal", "address", opts.Address, "slave", p.slave.Name())
+	o := *opts
+	return &internalPort{ReadWriteCloser: p, PortOptions: &o}, nil
+}
+
+func newPTY() (*pty, error) {
+	// The master is non-blocking so that it uses the runtime poller, and reads are
+	// interrupted when it is closed.
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err == nil {
+		err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	if err := makeRaw(slave); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+	return &pty{File: master, slave: slave}, nil
+}
+
+// PTYPath returns the path of the slave side of a port opened with OpenPTY or as a PTYDevice,
+// or an empty string for other ports.
+func PTYPath(port Port) string {
+	if cp, ok := port.(*capturePort); ok {
+		port = cp.Port
+	}
+	ip, ok := port.(*internalPort)
+	if !ok {
+		return ""
+	}
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	if p, ok := ip.ReadWriteCloser.(*pty); ok {
+		return p.slave.Name()
+	}
+	return ""
+}
+
+// makeRaw disables all the input and output processing in the terminal 'f'.
+func makeRaw(f *os.File) error {
+	fd := int(f.Fd())
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
+
+// Read reads from the master side. As in serial ports, it returns 0 bytes and no error
+// when the read timeout expires.
+func (p *pty) Read(b []byte) (int, error) {
+	if p.timeout > 0 {
+		_ = p.File.SetReadDeadline(time.Now().Add(p.timeout))
+	}
+	n, err := p.File.Read(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, nil
+	}
+	return n, err
+}
+
+// SetReadTimeout sets the timeout for each read. Zero means no timeout.
+func (p *pty) SetReadTimeout(d time.Duration) error {
+	p.timeout = d
+	if d <= 0 {
+		return p.File.SetReadDeadline(time.Time{})
+	}
+	return nil
+}
+
+// ResetInputBuffer discards the data written to the slave side that was not read yet.
+func (p *pty) ResetInputBuffer() error {
+	rc, err := p.File.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	if err := rc.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetInt(int(fd), unix.TCFLSH, unix.TCIFLUSH)
+	}); err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func (p *pty) Close() error {
+	if p.link != "" {
+		_ = os.Remove(p.link)
+	}
+	p.slave.Close()
+	return p.File.Close()
+}
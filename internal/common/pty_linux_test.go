@@ -0,0 +1,98 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial"
+)
+
+func TestPTYDevice(t *testing.T) {
+	link := filepath.Join(t.TempDir(), "tty")
+	master, err := OpenPort(&PortOptions{Address: link, Type: PTYDevice, ReadTimeout: 100 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+	slavePath := PTYPath(master)
+	assert.NotEmpty(t, slavePath)
+	target, err := os.Readlink(link)
+	assert.NoError(t, err)
+	assert.Equal(t, slavePath, target)
+
+	slave, err := OpenPort(&PortOptions{Address: link, Mode: &serial.Mode{BaudRate: 9600}, Type: SerialDevice, ReadTimeout: 100 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer slave.Close()
+	assert.Empty(t, PTYPath(slave))
+
+	buf := make([]byte, 16)
+	_, err = slave.Write([]byte("ping"))
+	assert.NoError(t, err)
+	n, err := master.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(buf[:n]))
+
+	_, err = master.Write([]byte("pong"))
+	assert.NoError(t, err)
+	n, err = slave.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(buf[:n]))
+
+	// Nothing to read.
+	_, err = master.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+
+	// Data not read yet is discarded.
+	_, err = slave.Write([]byte("stale"))
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, master.ResetInputBuffer())
+	_, err = master.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+
+	// A shorter timeout.
+	assert.NoError(t, master.SetReadTimeout(10*time.Millisecond))
+	start := time.Now()
+	_, err = master.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// Reopening creates a new pseudo-terminal, and updates the link.
+	assert.NoError(t, master.ReopenWithBackoff())
+	target, err = os.Readlink(link)
+	assert.NoError(t, err)
+	assert.Equal(t, PTYPath(master), target)
+
+	assert.NoError(t, master.Close())
+	_, err = os.Lstat(link)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpenPTY(t *testing.T) {
+	master, name, err := OpenPTY()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer master.Close()
+	assert.Equal(t, name, PTYPath(master))
+	assert.Equal(t, PTYDevice, master.Type())
+
+	// No read timeout by default.
+	slave, err := os.OpenFile(name, os.O_RDWR, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer slave.Close()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = slave.Write([]byte("late"))
+	}()
+	buf := make([]byte, 16)
+	n, err := master.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "late", string(buf[:n]))
+}
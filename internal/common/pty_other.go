@@ -0,0 +1,21 @@
+//go:build !linux
+
+package common
+
+import "fmt"
+
+var errPTYUnsupported = fmt.Errorf("pseudo-terminals are only supported on Linux")
+
+// OpenPTY creates a pseudo-terminal pair. It is only supported on Linux.
+func OpenPTY() (Port, string, error) {
+	return nil, "", errPTYUnsupported
+}
+
+func openPTY(*PortOptions) (Port, error) {
+	return nil, errPTYUnsupported
+}
+
+// PTYPath returns the path of the slave side of a pseudo-terminal. It is only supported on Linux.
+func PTYPath(Port) string {
+	return ""
+}
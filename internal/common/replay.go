@@ -0,0 +1,229 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// captureEntry is a chunk of data read from or written to a port in a capture.
+type captureEntry struct {
+	port  string
+	write bool
+	data  []byte
+}
+
+// readCapture reads all the entries in a capture written by Capture, in either format.
+func readCapture(r io.Reader) ([]captureEntry, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	if len(magic) == 4 && binary.LittleEndian.Uint32(magic) == 0xa1b2c3d4 {
+		return readPcapCapture(br)
+	}
+	var entries []captureEntry
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec captureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		data, err := hex.DecodeString(rec.Data)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, captureEntry{port: rec.Port, write: rec.Direction == "write", data: data})
+	}
+	return entries, scanner.Err()
+}
+
+func readPcapCapture(r io.Reader) ([]captureEntry, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if lt := binary.LittleEndian.Uint32(header[20:]); lt != pcapLinkTypeUser0 {
+		return nil, fmt.Errorf("unsupported pcap link type: %d", lt)
+	}
+	var entries []captureEntry
+	for {
+		var ph [4]uint32
+		if err := binary.Read(r, binary.LittleEndian, &ph); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, err
+		}
+		packet := make([]byte, ph[2])
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return nil, err
+		}
+		if len(packet) < 2 || len(packet) < 2+int(packet[1]) {
+			return nil, fmt.Errorf("invalid packet of %d bytes", len(packet))
+		}
+		n := 2 + int(packet[1])
+		entries = append(entries, captureEntry{port: string(packet[2:n]), write: packet[0] == 1, data: packet[n:]})
+	}
+}
+
+// replayResponses has all the responses captured for the same request.
+type replayResponses struct {
+	responses [][]byte
+	next      int
+}
+
+func (r *replayResponses) add(resp []byte) {
+	r.responses = append(r.responses, resp)
+}
+
+// get returns the responses in the order they were captured, starting over after the last one.
+func (r *replayResponses) get() []byte {
+	resp := r.responses[r.next%len(r.responses)]
+	r.next++
+	return resp
+}
+
+// replay answers the requests written to it with the responses in a capture.
+// Each write in the capture is a request, and the reads that follow, until the next write to the
+// same port, its response.
+// Modbus TCP requests not found are looked up again ignoring the transaction ID.
+type replay struct {
+	mu        sync.Mutex
+	responses map[string]*replayResponses
+	mbap      map[string]*replayResponses // Keyed without the transaction ID.
+	req       []byte
+	resp      []byte
+}
+
+func newReplay(entries []captureEntry) *replay {
+	r := &replay{responses: make(map[string]*replayResponses), mbap: make(map[string]*replayResponses)}
+	type exchange struct{ req, resp []byte }
+	pending := make(map[string]*exchange)
+	flush := func(e *exchange) {
+		if len(e.req) > 0 {
+			r.add(e.req, e.resp)
+		}
+		e.req, e.resp = nil, nil
+	}
+	var ports []string
+	for _, entry := range entries {
+		e := pending[entry.port]
+		if e == nil {
+			e = &exchange{}
+			pending[entry.port] = e
+			ports = append(ports, entry.port)
+		}
+		if entry.write {
+			flush(e)
+			e.req = entry.data
+		} else if len(e.req) > 0 {
+			e.resp = append(e.resp, entry.data...)
+		}
+	}
+	for _, port := range ports {
+		flush(pending[port])
+	}
+	return r
+}
+
+func (r *replay) add(req, resp []byte) {
+	addResponse(r.responses, string(req), resp)
+	if key := mbapKey(req); key != "" {
+		addResponse(r.mbap, key, resp)
+	}
+}
+
+func addResponse(m map[string]*replayResponses, key string, resp []byte) {
+	rr := m[key]
+	if rr == nil {
+		rr = &replayResponses{}
+		m[key] = rr
+	}
+	rr.add(resp)
+}
+
+// mbapKey returns the key for a Modbus TCP request without its transaction ID, or "" if 'req'
+// is not a Modbus TCP frame.
+func mbapKey(req []byte) string {
+	if len(req) < 8 || binary.BigEndian.Uint16(req[2:]) != 0 || int(binary.BigEndian.Uint16(req[4:])) != len(req)-6 {
+		return ""
+	}
+	return string(req[2:])
+}
+
+// lookup returns the response for 'req', or nil if there is none.
+func (r *replay) lookup(req []byte) []byte {
+	if rr := r.responses[string(req)]; rr != nil {
+		return rr.get()
+	}
+	key := mbapKey(req)
+	if rr := r.mbap[key]; key != "" && rr != nil {
+		resp := bytes.Clone(rr.get())
+		if len(resp) >= 2 {
+			copy(resp, req[:2]) // Transaction ID.
+		}
+		return resp
+	}
+	return nil
+}
+
+func (r *replay) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.req = bytes.Clone(b)
+	return len(b), nil
+}
+
+// Read returns the response to the last write. It returns no data
+// if there is no response, which is reported as a read timeout.
+func (r *replay) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.req) > 0 {
+		r.resp = r.lookup(r.req)
+		if r.resp == nil {
+			slog.Debug("no response captured for request", "request", hex.EncodeToString(r.req))
+		}
+		r.req = nil
+	}
+	n := copy(b, r.resp)
+	r.resp = r.resp[n:]
+	return n, nil
+}
+
+// ResetInputBuffer discards the rest of the current response.
+func (r *replay) ResetInputBuffer() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resp = nil
+	return nil
+}
+
+func (*replay) Close() error {
+	return nil
+}
+
+// openReplay opens a capture file written with --capture and replays its responses.
+func openReplay(opts *PortOptions) (Port, error) {
+	f, err := os.Open(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := readCapture(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture: %w", err)
+	}
+	o := *opts
+	return &internalPort{ReadWriteCloser: newReplay(entries), PortOptions: &o}, nil
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCapture writes a capture with the request/response pairs in 'exchanges' to 'name'.
+func writeCapture(t *testing.T, name string, exchanges ...string) {
+	t.Helper()
+	c, f, err := CreateCapture(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	for i := 0; i < len(exchanges); i += 2 {
+		req, _ := hex.DecodeString(exchanges[i])
+		resp, _ := hex.DecodeString(exchanges[i+1])
+		port := NewCapturePort(NewTestPort(bytes.NewReader(resp), &bytes.Buffer{}, TestByteDevice), "/dev/ttyUSB0", c)
+		_, _ = port.Write(req)
+		// Read the response in two chunks, as a real device would.
+		b := make([]byte, len(resp)/2+1)
+		for {
+			n, _ := port.Read(b)
+			if n == 0 {
+				break
+			}
+		}
+	}
+}
+
+// exchange writes 'req' to 'port' and returns all the data read until a read fails.
+func exchange(port Port, req string) (string, error) {
+	b, _ := hex.DecodeString(req)
+	if _, err := port.Write(b); err != nil {
+		return "", err
+	}
+	var resp []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := port.Read(buf)
+		resp = append(resp, buf[:n]...)
+		if err != nil {
+			return hex.EncodeToString(resp), err
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	for _, name := range []string{"capture.jsonl", "capture.pcap"} {
+		file := filepath.Join(t.TempDir(), name)
+		writeCapture(t, file,
+			"1103006b00037687", "110306ae415652434049ad",
+			"1103006b00037687", "110306ae415652434149ad",
+			"0001000000061103006b0003", "000100000009110306ae4156524340",
+			"010300000001840a", "",
+		)
+
+		port, err := OpenPort(&PortOptions{Address: file, Type: DeviceTypeFromString["replay"]})
+		assert.NoError(t, err)
+		tests := []struct {
+			req  string
+			resp string
+		}{
+			{"1103006b00037687", "110306ae415652434049ad"},
+			{"1103006b00037687", "110306ae415652434149ad"},
+			{"1103006b00037687", "110306ae415652434049ad"}, // Starts over
+			{"0001000000061103006b0003", "000100000009110306ae4156524340"},
+			{"0007000000061103006b0003", "000700000009110306ae4156524340"}, // Different TID
+			{"010300000001840a", ""},                                       // No response captured
+			{"1104006b0003c347", ""},                                       // Unknown request
+		}
+		for i, tt := range tests {
+			resp, err := exchange(port, tt.req)
+			assert.EqualError(t, err, "read timeout", "%s/%d", name, i)
+			assert.Equal(t, tt.resp, resp, "%s/%d", name, i)
+		}
+		assert.NoError(t, port.Close())
+	}
+}
+
+func TestReplayInvalidCapture(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte("{\"data\": \"zz\"}\n"), 0644))
+	_, err := OpenPort(&PortOptions{Address: file, Type: ReplayDevice})
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -0,0 +1,293 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// RFC 2217 extends Telnet to set up the serial port of a remote serial server, like ser2net or
+// Moxa NPort, over the same TCP connection used for the data.
+// See https://datatracker.ietf.org/doc/html/rfc2217
+
+// Telnet commands.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+)
+
+// Telnet options.
+const (
+	telnetBinary  = 0
+	telnetSGA     = 3 // Suppress go ahead.
+	telnetComPort = 44
+)
+
+// COM-PORT-OPTION commands sent by the client. The server answers with the same command plus 100.
+const (
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+	comPortSetControl  = 5
+	comPortPurgeData   = 12
+
+	comPortServerOffset = 100
+)
+
+const (
+	comPortNoFlowControl     = 1
+	comPortPurgeReceiveQueue = 1 // The buffer with the data received by the serial server.
+)
+
+// telnet parser states.
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSB
+	stateSBIAC
+)
+
+// rfc2217Conn is a Telnet connection to a serial server. Reads return only the serial port data,
+// and writes escape it.
+type rfc2217Conn struct {
+	net.Conn
+
+	wmu sync.Mutex // Negotiation replies are written while reading.
+
+	state   int
+	command byte   // WILL, WONT, DO or DONT being parsed.
+	sb      []byte // Subnegotiation being parsed.
+
+	comPort    bool // The server accepted COM-PORT-OPTION.
+	comPortErr error
+}
+
+// openRFC2217 connects to a serial server and sets up its serial port with opts.Mode.
+func openRFC2217(opts *PortOptions) (Port, error) {
+	slog.Debug("dialing RFC 2217 server", "address", opts.Address)
+	timeout := 3 * time.Second
+	if opts.ReadTimeout > 0 {
+		timeout = opts.ReadTimeout
+	}
+	conn, err := net.DialTimeout("tcp", opts.Address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &rfc2217Conn{Conn: conn}
+	if err := c.negotiate(opts.Mode, timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	o := *opts
+	return &internalPort{ReadWriteCloser: c, PortOptions: &o, readTimeout: opts.ReadTimeout}, nil
+}
+
+// negotiate asks the server to use COM-PORT-OPTION, waits until it agrees, and then sends the
+// serial port settings.
+func (c *rfc2217Conn) negotiate(mode *serial.Mode, timeout time.Duration) error {
+	if err := c.writeCommand(
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetDO, telnetSGA,
+		telnetIAC, telnetWILL, telnetComPort,
+	); err != nil {
+		return err
+	}
+	_ = c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 64)
+	for !c.comPort && c.comPortErr == nil {
+		n, err := c.Conn.Read(buf)
+		c.filter(buf[:n]) // Any data received before the server agrees is discarded.
+		if err != nil {
+			return fmt.Errorf("error negotiating RFC 2217: %w", err)
+		}
+	}
+	if c.comPortErr != nil {
+		return c.comPortErr
+	}
+	if mode == nil {
+		return nil
+	}
+	dataBits := mode.DataBits
+	if dataBits == 0 {
+		dataBits = 8
+	}
+	var stopSize byte
+	switch mode.StopBits {
+	case serial.OneStopBit:
+		stopSize = 1
+	case serial.TwoStopBits:
+		stopSize = 2
+	case serial.OnePointFiveStopBits:
+		stopSize = 3
+	}
+	var b []byte
+	b = append(b, comPortCommand(comPortSetBaudRate, binary.BigEndian.AppendUint32(nil, uint32(mode.BaudRate))...)...)
+	b = append(b, comPortCommand(comPortSetDataSize, byte(dataBits))...)
+	b = append(b, comPortCommand(comPortSetParity, byte(mode.Parity)+1)...) // NoParity is 0, and 1 in RFC 2217.
+	b = append(b, comPortCommand(comPortSetStopSize, stopSize)...)
+	b = append(b, comPortCommand(comPortSetControl, comPortNoFlowControl)...)
+	return c.writeCommand(b...)
+}
+
+// comPortCommand returns the subnegotiation for a COM-PORT-OPTION command, escaping 'value'.
+func comPortCommand(command byte, value ...byte) []byte {
+	b := []byte{telnetIAC, telnetSB, telnetComPort, command}
+	b = append(b, escapeIAC(value)...)
+	return append(b, telnetIAC, telnetSE)
+}
+
+func escapeIAC(data []byte) []byte {
+	var b []byte
+	for _, c := range data {
+		b = append(b, c)
+		if c == telnetIAC {
+			b = append(b, telnetIAC)
+		}
+	}
+	return b
+}
+
+func (c *rfc2217Conn) writeCommand(b ...byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+// Write sends 'b' to the serial port, escaping the IAC bytes.
+func (c *rfc2217Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.Conn.Write(escapeIAC(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read reads data from the serial port, processing any Telnet command found.
+func (c *rfc2217Conn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(b)
+		n = c.filter(b[:n])
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// filter removes the Telnet commands from 'b', and returns the number of data bytes left.
+func (c *rfc2217Conn) filter(b []byte) int {
+	n := 0
+	for _, v := range b {
+		switch c.state {
+		case stateData:
+			if v == telnetIAC {
+				c.state = stateIAC
+				continue
+			}
+			b[n] = v
+			n++
+		case stateIAC:
+			switch v {
+			case telnetIAC: // Escaped 0xff.
+				b[n] = v
+				n++
+				c.state = stateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.command = v
+				c.state = stateOption
+			case telnetSB:
+				c.sb = c.sb[:0]
+				c.state = stateSB
+			default: // Other commands have no meaning for serial data.
+				c.state = stateData
+			}
+		case stateOption:
+			c.handleOption(c.command, v)
+			c.state = stateData
+		case stateSB:
+			if v == telnetIAC {
+				c.state = stateSBIAC
+			} else {
+				c.sb = append(c.sb, v)
+			}
+		case stateSBIAC:
+			switch v {
+			case telnetSE:
+				c.handleSubnegotiation(c.sb)
+				c.state = stateData
+			case telnetIAC:
+				c.sb = append(c.sb, v)
+				c.state = stateSB
+			default:
+				c.state = stateData
+			}
+		}
+	}
+	return n
+}
+
+// handleOption answers the option negotiation from the server. Only the options requested by the
+// client are accepted, and they are not acknowledged again to avoid negotiation loops.
+func (c *rfc2217Conn) handleOption(command, option byte) {
+	switch command {
+	case telnetDO:
+		switch option {
+		case telnetComPort:
+			c.comPort = true
+		case telnetBinary:
+		default:
+			_ = c.writeCommand(telnetIAC, telnetWONT, option)
+		}
+	case telnetDONT:
+		if option == telnetComPort {
+			c.comPortErr = fmt.Errorf("the server does not support RFC 2217")
+		}
+	case telnetWILL:
+		switch option {
+		case telnetBinary, telnetSGA:
+		default:
+			_ = c.writeCommand(telnetIAC, telnetDONT, option)
+		}
+	}
+}
+
+func (c *rfc2217Conn) handleSubnegotiation(sb []byte) {
+	if len(sb) < 2 || sb[0] != telnetComPort {
+		return
+	}
+	if sb[1] > comPortServerOffset {
+		slog.Debug("RFC 2217 server response", "address", c.RemoteAddr(), "command", sb[1]-comPortServerOffset, "value", sb[2:])
+	}
+}
+
+// ResetInputBuffer asks the server to discard the data received from the serial port, and
+// discards the data already sent by the server.
+func (c *rfc2217Conn) ResetInputBuffer() error {
+	if err := c.writeCommand(comPortCommand(comPortPurgeData, comPortPurgeReceiveQueue)...); err != nil {
+		return err
+	}
+	_ = c.Conn.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+	buf := make([]byte, 256)
+	for {
+		n, err := c.Read(buf)
+		if n == 0 || err != nil {
+			break
+		}
+	}
+	return c.Conn.SetReadDeadline(time.Time{}) // internalPort sets the deadline of each read.
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial"
+)
+
+// expect reads len(want) bytes from 'conn' and checks they are 'want'.
+func expect(t *testing.T, conn net.Conn, what string, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Errorf("%s: %v", what, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: got % x, want % x", what, got, want)
+	}
+}
+
+func TestRFC2217(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		expect(t, conn, "negotiation", []byte{0xff, 0xfb, 0x00, 0xff, 0xfd, 0x00, 0xff, 0xfd, 0x03, 0xff, 0xfb, 0x2c})
+		// Ask for ECHO, send some data that should be discarded, and then accept the options.
+		_, _ = conn.Write([]byte{0xff, 0xfd, 0x01, 'j', 'u', 'n', 'k', 0xff, 0xfb, 0x00, 0xff, 0xfd, 0x2c})
+		expect(t, conn, "refused option", []byte{0xff, 0xfc, 0x01})
+		expect(t, conn, "settings", []byte{
+			0xff, 0xfa, 0x2c, 0x01, 0x00, 0x00, 0x09, 0x60, 0xff, 0xf0, // 2400 baud
+			0xff, 0xfa, 0x2c, 0x02, 0x07, 0xff, 0xf0, // 7 data bits
+			0xff, 0xfa, 0x2c, 0x03, 0x03, 0xff, 0xf0, // even parity
+			0xff, 0xfa, 0x2c, 0x04, 0x02, 0xff, 0xf0, // 2 stop bits
+			0xff, 0xfa, 0x2c, 0x05, 0x01, 0xff, 0xf0, // no flow control
+		})
+		expect(t, conn, "escaped data", []byte{0x01, 0xff, 0xff, 0x02})
+		// Data with an escaped 0xff and a server response in the middle.
+		_, _ = conn.Write([]byte{0x10, 0xff, 0xff, 0x20, 0xff, 0xfa, 0x2c, 0x65, 0x00, 0x00, 0x09, 0x60, 0xff, 0xf0, 0x30})
+		expect(t, conn, "purge", []byte{0xff, 0xfa, 0x2c, 0x0c, 0x01, 0xff, 0xf0})
+	}()
+
+	mode := &serial.Mode{BaudRate: 2400, DataBits: 7, Parity: serial.EvenParity, StopBits: serial.TwoStopBits}
+	port, err := OpenPort(&PortOptions{Address: l.Addr().String(), Mode: mode, Type: RFC2217Device, ReadTimeout: time.Second})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	n, err := port.Write([]byte{0x01, 0xff, 0x02})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(port, got)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x10, 0xff, 0x20, 0x30}, got)
+	assert.NoError(t, port.ResetInputBuffer())
+	<-done
+}
+
+// TestRFC2217ReadTimeout checks that the read timeout applies to each read, with or without
+// purging the input first.
+func TestRFC2217ReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	send := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		expect(t, conn, "negotiation", []byte{0xff, 0xfb, 0x00, 0xff, 0xfd, 0x00, 0xff, 0xfd, 0x03, 0xff, 0xfb, 0x2c})
+		_, _ = conn.Write([]byte{0xff, 0xfb, 0x00, 0xff, 0xfd, 0x2c})
+		<-send
+		_, _ = conn.Write([]byte{0x42})
+		<-send
+	}()
+
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8}
+	port, err := OpenPort(&PortOptions{Address: l.Addr().String(), Mode: mode, Type: RFC2217Device, ReadTimeout: 50 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	b := make([]byte, 1)
+	start := time.Now()
+	_, err = port.Read(b)
+	assert.Error(t, err, "read with no data")
+	assert.Less(t, time.Since(start), time.Second)
+
+	assert.NoError(t, port.ResetInputBuffer())
+	time.Sleep(100 * time.Millisecond) // Longer than the read timeout.
+	send <- struct{}{}
+	n, err := port.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x42}, b[:n])
+	close(send)
+	<-done
+}
+
+func TestRFC2217Unsupported(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte{0xff, 0xfe, 0x2c})
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+	_, err = OpenPort(&PortOptions{Address: l.Addr().String(), Type: RFC2217Device, ReadTimeout: time.Second})
+	assert.ErrorContains(t, err, "does not support RFC 2217")
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -69,16 +70,41 @@ const (
 	HidRawDevice
 	// TCPDevice represents a TCP network device.
 	TCPDevice
+	// ReplayDevice answers requests with the responses recorded in a capture file.
+	ReplayDevice
+	// PTYDevice is the master side of a pseudo-terminal. Other processes open the slave side as a serial port.
+	PTYDevice
+	// RFC2217Device is a remote serial server that supports RFC 2217 to set up the serial port.
+	RFC2217Device
+	// UDPDevice represents a network device that receives and sends each frame in a UDP datagram.
+	UDPDevice
 
 	DefaultMaxBackoffInterval = 20 * time.Second
 )
 
+// ErrReadTimeout is returned when reading from a port gets no data before the read timeout.
+var ErrReadTimeout = errors.New("read timeout")
+
 // DeviceTypeFromString maps string representations of device types to their DeviceType constants.
 var DeviceTypeFromString = map[string]DeviceType{
-	"test":   TestByteDevice,
-	"serial": SerialDevice,
-	"hidraw": HidRawDevice,
-	"tcp":    TCPDevice,
+	"test":    TestByteDevice,
+	"serial":  SerialDevice,
+	"hidraw":  HidRawDevice,
+	"tcp":     TCPDevice,
+	"replay":  ReplayDevice,
+	"pty":     PTYDevice,
+	"rfc2217": RFC2217Device,
+	"udp":     UDPDevice,
+}
+
+// String returns the name of the device type used in flags and addresses.
+func (t DeviceType) String() string {
+	for name, dt := range DeviceTypeFromString {
+		if dt == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("DeviceType(%d)", int(t))
 }
 
 // PortOptions contains the port name and the settings used when opening it.
@@ -87,8 +113,9 @@ type PortOptions struct {
 	*serial.Mode // Mode contains serial port settings like BaudRate, DataBits, etc.
 
 	Type        DeviceType    // Type specifies the kind of device (e.g., SerialDevice, TCPDevice).
-	Address     string        // Address is the port name (e.g., "/dev/ttyUSB0") or network address (e.g., "192.168.1.1:8080").
+	Address     string        // Address is the port name (e.g., "/dev/ttyUSB0"), network address (e.g., "192.168.1.1:8080"), or where to link a pseudo-terminal.
 	ReadTimeout time.Duration // ReadTimeout specifies the timeout when reading from the device.
+	Protocol    string        // Protocol is the protocol set in an address URL, if any.
 }
 
 var deviceOpen = map[DeviceType]func(*PortOptions) (Port, error){
@@ -96,11 +123,16 @@ var deviceOpen = map[DeviceType]func(*PortOptions) (Port, error){
 	SerialDevice:   openSerial,
 	HidRawDevice:   openHidRaw,
 	TCPDevice:      openTCP,
+	ReplayDevice:   openReplay,
+	PTYDevice:      openPTY,
+	RFC2217Device:  openRFC2217,
+	UDPDevice:      openUDP,
 }
 
 type internalPort struct {
 	ReadWriteCloser io.ReadWriteCloser
 	*PortOptions
+	readTimeout time.Duration // Timeout of each read for TCP connections, protected by mu.
 
 	lock sync.Mutex // For high-level client locking (Lock/Unlock)
 	mu   sync.Mutex // For protecting ReadWriteCloser pointer access
@@ -117,13 +149,17 @@ func (p *internalPort) Unlock() {
 func (p *internalPort) Read(b []byte) (n int, err error) {
 	p.mu.Lock()
 	rwc := p.ReadWriteCloser
+	timeout := p.readTimeout
 	p.mu.Unlock()
 	if rwc == nil {
 		return 0, fmt.Errorf("port is closed")
 	}
+	if conn, ok := rwc.(net.Conn); ok && timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	}
 	n, err = rwc.Read(b)
 	if n == 0 && err == nil && len(b) > 0 {
-		return 0, fmt.Errorf("read timeout")
+		return 0, ErrReadTimeout
 	}
 	return n, err
 }
@@ -194,7 +230,7 @@ func openTCP(opts *PortOptions) (Port, error) {
 		return nil, err
 	}
 	o := *opts
-	return &internalPort{ReadWriteCloser: conn, PortOptions: &o}, nil
+	return &internalPort{ReadWriteCloser: conn, PortOptions: &o, readTimeout: opts.ReadTimeout}, nil
 }
 
 // Port adds one more functions opening a port with retries and exponential backoff.
@@ -207,6 +243,8 @@ type Port interface {
 	// ResetInputBuffer flushes/clears any unread data in the input buffer.
 	ResetInputBuffer() error
 	// SetReadTimeout sets the timeout for reading operations on the underlying device connection.
+	// For TCP and UDP connections, a zero duration restores the ReadTimeout the port was opened
+	// with. TCP connections opened without one have no timeout.
 	SetReadTimeout(d time.Duration) error
 	// Type returns the DeviceType of the port.
 	Type() DeviceType
@@ -216,8 +254,13 @@ type Port interface {
 	Unlock()
 }
 
-// OpenPort opens a device.
+// OpenPort opens a device. The address can be a URL with the device type and its settings, as
+// described in ParseAddress.
 func OpenPort(opts *PortOptions) (Port, error) {
+	opts, err := ParseAddress(opts)
+	if err != nil {
+		return nil, err
+	}
 	open := deviceOpen[opts.Type]
 	if open == nil {
 		return nil, fmt.Errorf("invalid device type: %v", opts.Type)
@@ -226,6 +269,9 @@ func OpenPort(opts *PortOptions) (Port, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error opening '%s': %v", opts.Address, err)
 	}
+	if capture := currentCapture(); capture != nil {
+		return NewCapturePort(c, opts.Address, capture), nil
+	}
 	return c, nil
 }
 
@@ -267,6 +313,10 @@ func (p *internalPort) ReopenWithBackoff() error {
 		p.mu.Lock()
 		// OpenPortWithBackoff might return a Port interface.
 		// Since OpenPort returns an *internalPort, we need to extract the ReadWriteCloser from it.
+		// This port is already being captured if needed.
+		if cp, ok := port.(*capturePort); ok {
+			port = cp.Port
+		}
 		if ip, ok := port.(*internalPort); ok {
 			p.ReadWriteCloser = ip.ReadWriteCloser
 		} else {
@@ -296,11 +346,7 @@ func (p *internalPort) ResetInputBuffer() error {
 				break
 			}
 		}
-		if p.PortOptions != nil && p.PortOptions.ReadTimeout > 0 {
-			_ = conn.SetReadDeadline(time.Now().Add(p.PortOptions.ReadTimeout))
-		} else {
-			_ = conn.SetReadDeadline(time.Time{})
-		}
+		_ = conn.SetReadDeadline(time.Time{}) // Read sets the deadline of each read.
 	}
 	return nil
 }
@@ -312,11 +358,17 @@ func (p *internalPort) SetReadTimeout(d time.Duration) error {
 	if rwc == nil {
 		return fmt.Errorf("port is closed")
 	}
-	if sp, ok := rwc.(serial.Port); ok {
+	if sp, ok := rwc.(interface{ SetReadTimeout(time.Duration) error }); ok { // Serial ports and pseudo-terminals.
 		return sp.SetReadTimeout(d)
 	}
 	if conn, ok := rwc.(net.Conn); ok {
-		return conn.SetReadDeadline(time.Now().Add(d))
+		if d <= 0 && p.PortOptions != nil {
+			d = p.PortOptions.ReadTimeout
+		}
+		p.mu.Lock()
+		p.readTimeout = max(d, 0)
+		p.mu.Unlock()
+		return conn.SetReadDeadline(time.Time{}) // Read sets the deadline of each read.
 	}
 	return nil
 }
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// MaxDatagramSize is the size of the largest datagram read from UDP devices.
+const MaxDatagramSize = 1500
+
+// udpConn is a connected UDP socket. Each read returns a single datagram, and the part of it that
+// does not fit in the buffer is lost. As datagrams can be lost too, reads always have a timeout.
+type udpConn struct {
+	net.Conn
+	defaultTimeout time.Duration
+	timeout        time.Duration
+}
+
+// openUDP opens a UDP socket that sends datagrams to opts.Address and only receives datagrams
+// from it.
+func openUDP(opts *PortOptions) (Port, error) {
+	slog.Debug("dialing UDP server", "address", opts.Address)
+	conn, err := net.Dial("udp", opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	timeout := 5 * time.Second
+	if opts.ReadTimeout > 0 {
+		timeout = opts.ReadTimeout
+	}
+	o := *opts
+	return &internalPort{ReadWriteCloser: &udpConn{Conn: conn, defaultTimeout: timeout, timeout: timeout}, PortOptions: &o}, nil
+}
+
+// Read reads the next datagram. As in serial ports, it returns 0 bytes and no error when the
+// read timeout expires.
+func (c *udpConn) Read(b []byte) (int, error) {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	n, err := c.Conn.Read(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, nil
+	}
+	return n, err
+}
+
+// SetReadTimeout sets the timeout for each read. Zero restores the ReadTimeout the port was
+// opened with, instead of removing the timeout.
+func (c *udpConn) SetReadTimeout(d time.Duration) error {
+	if d <= 0 {
+		d = c.defaultTimeout
+	}
+	c.timeout = d
+	return nil
+}
+
+// ResetInputBuffer discards the datagrams received and not read yet, like late responses to
+// previous requests.
+func (c *udpConn) ResetInputBuffer() error {
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+		if _, err := c.Conn.Read(buf); err != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPDevice(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer server.Close()
+	port, err := OpenPort(&PortOptions{Address: server.LocalAddr().String(), Type: UDPDevice, ReadTimeout: 50 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+
+	_, err = port.Write([]byte("request"))
+	assert.NoError(t, err)
+	buf := make([]byte, 16)
+	n, client, err := server.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "request", string(buf[:n]))
+
+	// Each read returns one datagram.
+	_, _ = server.WriteTo([]byte("first"), client)
+	_, _ = server.WriteTo([]byte("second"), client)
+	n, err = port.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(buf[:n]))
+	n, err = port.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(buf[:n]))
+
+	// No datagram.
+	_, err = port.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+
+	// Datagrams not read yet are discarded.
+	_, _ = server.WriteTo([]byte("stale"), client)
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, port.ResetInputBuffer())
+	_, err = port.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+
+	// A zero timeout restores the original one instead of blocking forever.
+	assert.NoError(t, port.SetReadTimeout(0))
+	start := time.Now()
+	_, err = port.Read(buf)
+	assert.EqualError(t, err, "read timeout")
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,602 @@
+// Package config reads the files that describe the buses and devices monitored by the monitor command.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wombatt/internal/bms"
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
+
+	"github.com/BurntSushi/toml"
+	"go.bug.st/serial"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BatteryKind  = "battery"
+	InverterKind = "inverter"
+
+	MQTTOutput         = "mqtt"
+	WebOutput          = "web"
+	ModbusServerOutput = "modbus_server"
+	StdoutOutput       = "stdout"
+
+	DefaultPollInterval = 10 * time.Second
+)
+
+// InverterCommands has the commands supported by each inverter model. PI30 inverters accept any command.
+var InverterCommands = map[string][]string{
+	"pi30":       nil,
+	"solark":     {"RealtimeData", "IntrinsicAttributes"},
+	"eg4_18kpv":  {"RealtimeData"},
+	"eg4_6000xp": {"RealtimeData"},
+}
+
+// Config is the contents of a configuration file.
+type Config struct {
+	PollInterval time.Duration `yaml:"poll_interval"` // Default for the devices.
+	MQTT         *MQTT         `yaml:"mqtt"`
+	Web          *Web          `yaml:"web"`
+	ModbusServer *ModbusServer `yaml:"modbus_server"`
+	Buses        []*Bus        `yaml:"buses"`
+	Devices      []*Device     `yaml:"devices"`
+}
+
+// MQTT has the settings for publishing to an MQTT broker.
+type MQTT struct {
+	Broker      string `yaml:"broker"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	TopicPrefix string `yaml:"topic_prefix"`
+}
+
+// Web has the settings for the web dashboard and prometheus metrics.
+type Web struct {
+	Address string `yaml:"address"`
+}
+
+// ModbusServer has the settings for serving the registers read from the devices.
+type ModbusServer struct {
+	Address    string `yaml:"address"`
+	DeviceType string `yaml:"device_type"`
+	BaudRate   int    `yaml:"baud_rate"`
+}
+
+// Connection has the settings used to open a port.
+type Connection struct {
+	Address     string        `yaml:"address"`
+	DeviceType  string        `yaml:"device_type"`
+	BaudRate    int           `yaml:"baud_rate"`
+	DataBits    int           `yaml:"data_bits"`
+	StopBits    int           `yaml:"stop_bits"`
+	Parity      string        `yaml:"parity"`
+	Protocol    string        `yaml:"protocol"`
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+}
+
+// Bus is a port shared by several devices, like an RS485 bus or a Modbus TCP gateway.
+type Bus struct {
+	Name       string `yaml:"name"`
+	Connection `yaml:",inline"`
+}
+
+// Device is a battery bank or an inverter. Its connection settings override the ones of its bus.
+// After loading, the connection has the settings of the bus and the defaults for its kind, and
+// every other field not set in the file has its default value.
+type Device struct {
+	Name         string `yaml:"name"`
+	Kind         string `yaml:"kind"`  // battery or inverter
+	Model        string `yaml:"model"` // BMS type or inverter type
+	Bus          string `yaml:"bus"`
+	Connection   `yaml:",inline"`
+	IDs          []uint8       `yaml:"ids"` // Battery IDs, or the Modbus ID of the inverter.
+	Commands     []string      `yaml:"commands"`
+	MQTTPrefix   string        `yaml:"mqtt_prefix"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Outputs      []string      `yaml:"outputs"`
+}
+
+// Error is an error in a configuration file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.File == "" {
+		return e.Msg
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Errors has all the errors found in a configuration file, in the order of their lines.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Load reads and validates the configuration file at 'path', which is a TOML file if it has the
+// .toml extension and a YAML file otherwise.
+func Load(path string) (*Config, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case "", ".yaml", ".yml", ".toml":
+	default:
+		return nil, Errors{{File: path, Msg: fmt.Sprintf("unsupported file extension '%s': the configuration must be a YAML (.yaml or .yml) or TOML (.toml) file", ext)}}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".toml" {
+		return ParseTOML(path, data)
+	}
+	return Parse(path, data)
+}
+
+// ParseTOML decodes and validates a TOML configuration file, which has the same settings as the
+// YAML ones. Only the syntax errors have a line, as the settings are validated once converted to YAML.
+func ParseTOML(file string, data []byte) (*Config, error) {
+	var settings map[string]any
+	if _, err := toml.Decode(string(data), &settings); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, Errors{{File: file, Line: parseErr.Position.Line, Msg: parseErr.Message}}
+		}
+		return nil, Errors{{File: file, Msg: err.Error()}}
+	}
+	if len(settings) == 0 {
+		return nil, Errors{{File: file, Msg: "empty configuration"}}
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, Errors{{File: file, Msg: err.Error()}}
+	}
+	cfg, err := Parse(file, data)
+	var errs Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			e.Line = 0 // The line in the YAML version of the file.
+		}
+	}
+	return cfg, err
+}
+
+// Parse decodes and validates a configuration file. The errors returned are of type Errors,
+// unless the file could not be read.
+func Parse(file string, data []byte) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(file, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, Errors{{File: file, Msg: "empty configuration"}}
+	}
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, yamlErrors(file, err)
+	}
+	if err := cfg.check(&validator{file: file, root: root.Content[0]}); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks a configuration that was not read from a file, and sets the defaults in it like Load.
+// The errors returned are of type Errors, with no file or line.
+func (cfg *Config) Validate() error {
+	return cfg.check(&validator{})
+}
+
+func (cfg *Config) check(v *validator) error {
+	cfg.validate(v)
+	if len(v.errs) > 0 {
+		slices.SortStableFunc(v.errs, func(a, b *Error) int { return a.Line - b.Line })
+		return v.errs
+	}
+	return nil
+}
+
+var (
+	yamlLine       = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlFieldError = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// yamlErrors converts the errors from the YAML decoder, which have the line in their text.
+func yamlErrors(file string, err error) error {
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	var errs Errors
+	for _, msg := range msgs {
+		e := &Error{File: file, Msg: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Msg = m[2]
+		}
+		if m := yamlFieldError.FindStringSubmatch(e.Msg); m != nil {
+			e.Msg = fmt.Sprintf("unknown setting '%s'", m[1])
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// validator collects the errors found, with the line of the setting that has each of them.
+type validator struct {
+	file string
+	root *yaml.Node
+	errs Errors
+}
+
+// errorf adds an error for the setting named 'key' in 'node', or for 'node' itself if it has no such setting.
+func (v *validator) errorf(node *yaml.Node, key string, format string, args ...any) {
+	line := 0
+	if node != nil {
+		line = node.Line
+		if value := lookup(node, key); value != nil {
+			line = value.Line
+		}
+	}
+	v.errs = append(v.errs, &Error{File: v.file, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// lookup returns the value for 'key' in the mapping 'node', or the element at the index in 'key' in
+// the sequence 'node'. It returns nil if there is no such value.
+func lookup(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validate(v *validator) {
+	if cfg.PollInterval < 0 {
+		v.errorf(v.root, "poll_interval", "poll_interval must be positive")
+	} else if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MQTT != nil {
+		cfg.MQTT.validate(v, lookup(v.root, "mqtt"))
+	}
+	if cfg.Web != nil && cfg.Web.Address == "" {
+		v.errorf(lookup(v.root, "web"), "address", "missing web server address")
+	}
+	if cfg.ModbusServer != nil {
+		cfg.ModbusServer.validate(v, lookup(v.root, "modbus_server"))
+	}
+
+	buses := make(map[string]*Bus)
+	busNodes := lookup(v.root, "buses")
+	for i, b := range cfg.Buses {
+		node := lookup(busNodes, strconv.Itoa(i))
+		if b == nil {
+			v.errorf(node, "", "empty bus")
+			continue
+		}
+		if b.Name == "" {
+			v.errorf(node, "name", "missing bus name")
+		} else if buses[b.Name] != nil {
+			v.errorf(node, "name", "duplicate bus name '%s'", b.Name)
+		} else {
+			buses[b.Name] = b
+		}
+		if b.Address == "" {
+			v.errorf(node, "address", "missing address for bus '%s'", b.Name)
+		}
+		b.Connection.validate(v, node)
+	}
+
+	names := make(map[string]bool)
+	deviceNodes := lookup(v.root, "devices")
+	if len(cfg.Devices) == 0 {
+		v.errorf(v.root, "devices", "no devices to monitor")
+	}
+	for i, d := range cfg.Devices {
+		node := lookup(deviceNodes, strconv.Itoa(i))
+		if d == nil {
+			v.errorf(node, "", "empty device")
+			continue
+		}
+		if d.Name == "" {
+			v.errorf(node, "name", "missing device name")
+		} else if names[d.Name] {
+			v.errorf(node, "name", "duplicate device name '%s'", d.Name)
+		}
+		names[d.Name] = true
+		d.Connection.validate(v, node)
+		if d.Bus != "" {
+			b := buses[d.Bus]
+			if b == nil {
+				v.errorf(node, "bus", "unknown bus '%s'", d.Bus)
+			} else if d.Address != "" {
+				v.errorf(node, "address", "device '%s' has both a bus and an address", d.Name)
+			} else {
+				d.Connection = d.Connection.merge(b.Connection)
+			}
+		} else if d.Address == "" {
+			v.errorf(node, "address", "device '%s' needs a bus or an address", d.Name)
+		}
+		d.validate(v, node, cfg)
+	}
+
+	// The devices at the same address share its port, which is opened with the settings of the first one.
+	first := make(map[string]*Device)
+	for i, d := range cfg.Devices {
+		if d == nil || d.Address == "" {
+			continue
+		}
+		f := first[d.Address]
+		if f == nil {
+			first[d.Address] = d
+			continue
+		}
+		if d.DeviceType != f.DeviceType || d.BaudRate != f.BaudRate || d.DataBits != f.DataBits || d.StopBits != f.StopBits || !strings.EqualFold(d.Parity, f.Parity) {
+			v.errorf(lookup(deviceNodes, strconv.Itoa(i)), "address", "device '%s' has the address of '%s' with different connection settings", d.Name, f.Name)
+		}
+	}
+}
+
+func (m *MQTT) validate(v *validator, node *yaml.Node) {
+	if m.Broker == "" {
+		v.errorf(node, "broker", "missing MQTT broker")
+	}
+	if (m.User == "") != (m.Password == "") {
+		v.errorf(node, "user", "both MQTT user and password are needed")
+	}
+	if m.TopicPrefix == "" {
+		m.TopicPrefix = "homeassistant"
+	}
+}
+
+func (s *ModbusServer) validate(v *validator, node *yaml.Node) {
+	if s.Address == "" {
+		v.errorf(node, "address", "missing Modbus server address")
+	}
+	switch s.DeviceType {
+	case "":
+		s.DeviceType = "tcp"
+	case "serial", "tcp":
+	default:
+		v.errorf(node, "device_type", "invalid Modbus server device type '%s': want serial or tcp", s.DeviceType)
+	}
+	if s.BaudRate == 0 {
+		s.BaudRate = 9600
+	}
+}
+
+// merge returns 'c' with the settings not set taken from 'base'.
+func (c Connection) merge(base Connection) Connection {
+	if c.Address == "" {
+		c.Address = base.Address
+	}
+	if c.DeviceType == "" {
+		c.DeviceType = base.DeviceType
+	}
+	if c.BaudRate == 0 {
+		c.BaudRate = base.BaudRate
+	}
+	if c.DataBits == 0 {
+		c.DataBits = base.DataBits
+	}
+	if c.StopBits == 0 {
+		c.StopBits = base.StopBits
+	}
+	if c.Parity == "" {
+		c.Parity = base.Parity
+	}
+	if c.Protocol == "" {
+		c.Protocol = base.Protocol
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = base.ReadTimeout
+	}
+	return c
+}
+
+var protocols = []string{modbus.AutoProtocol, modbus.RTUProtocol, modbus.TCPProtocol, modbus.RTUoverTCPProtocol, modbus.ASCIIProtocol, modbus.Lifepower4Protocol, modbus.DalyProtocol, modbus.SeplosV2Protocol, modbus.PylontechProtocol, modbus.JBDProtocol, modbus.JKProtocol}
+
+// batteryProtocols are the protocols only used by batteries.
+var batteryProtocols = []string{modbus.Lifepower4Protocol, modbus.DalyProtocol, modbus.SeplosV2Protocol, modbus.PylontechProtocol, modbus.JBDProtocol, modbus.JKProtocol}
+
+// validate checks the settings in 'c'. The errors are reported for the settings in 'node'.
+func (c *Connection) validate(v *validator, node *yaml.Node) {
+	if t, ok := common.DeviceTypeFromString[c.DeviceType]; c.DeviceType != "" && (!ok || t == common.TestByteDevice) {
+		v.errorf(node, "device_type", "invalid device type '%s'", c.DeviceType)
+	}
+	if c.Parity != "" {
+		if _, err := parity(c.Parity); err != nil {
+			v.errorf(node, "parity", "%v", err)
+		}
+	}
+	if c.StopBits != 0 && c.StopBits != 1 && c.StopBits != 2 {
+		v.errorf(node, "stop_bits", "invalid stop bits %d: want 1 or 2", c.StopBits)
+	}
+	if c.DataBits != 0 && (c.DataBits < 5 || c.DataBits > 8) {
+		v.errorf(node, "data_bits", "invalid data bits %d: want 5 to 8", c.DataBits)
+	}
+	if c.BaudRate < 0 {
+		v.errorf(node, "baud_rate", "invalid baud rate %d", c.BaudRate)
+	}
+	if c.ReadTimeout < 0 {
+		v.errorf(node, "read_timeout", "read_timeout must be positive")
+	}
+	if c.Protocol != "" && !slices.Contains(protocols, c.Protocol) {
+		v.errorf(node, "protocol", "invalid protocol '%s': want one of %s", c.Protocol, strings.Join(protocols, ", "))
+	}
+	if _, err := common.ParseAddress(&common.PortOptions{Address: c.Address}); err != nil {
+		v.errorf(node, "address", "%v", err)
+	}
+}
+
+func (d *Device) validate(v *validator, node *yaml.Node, cfg *Config) {
+	switch d.Kind {
+	case BatteryKind:
+		if _, err := bms.Instance(d.Model); err != nil {
+			v.errorf(node, "model", "invalid battery model '%s'", d.Model)
+		}
+		if len(d.IDs) == 0 {
+			v.errorf(node, "ids", "missing battery IDs for device '%s'", d.Name)
+		}
+		if len(d.Commands) > 0 {
+			v.errorf(node, "commands", "batteries have no commands")
+		}
+		d.Connection = d.Connection.merge(Connection{BaudRate: 9600, ReadTimeout: 500 * time.Millisecond})
+	case InverterKind:
+		valid, ok := InverterCommands[d.Model]
+		if !ok {
+			v.errorf(node, "model", "invalid inverter model '%s'", d.Model)
+		}
+		if len(d.Commands) == 0 {
+			v.errorf(node, "commands", "missing commands for device '%s'", d.Name)
+		}
+		commands := lookup(node, "commands")
+		for i, c := range d.Commands {
+			if c == "" || (ok && valid != nil && !slices.Contains(valid, c)) {
+				v.errorf(commands, strconv.Itoa(i), "invalid %s command '%s'", d.Model, c)
+			}
+		}
+		switch len(d.IDs) {
+		case 0:
+			d.IDs = []uint8{1}
+		case 1:
+		default:
+			v.errorf(node, "ids", "inverters have a single Modbus ID")
+		}
+		if slices.Contains(batteryProtocols, d.Protocol) {
+			v.errorf(node, "protocol", "inverters do not use the %s protocol", d.Protocol)
+		}
+		d.Connection = d.Connection.merge(Connection{BaudRate: 2400, ReadTimeout: 5 * time.Second})
+	case "":
+		v.errorf(node, "kind", "missing kind for device '%s': want battery or inverter", d.Name)
+	default:
+		v.errorf(node, "kind", "invalid kind '%s': want battery or inverter", d.Kind)
+	}
+	d.Connection = d.Connection.merge(Connection{DeviceType: "serial", DataBits: 8, StopBits: 1, Parity: "N", Protocol: modbus.AutoProtocol})
+
+	if d.MQTTPrefix == "" {
+		d.MQTTPrefix = d.Name
+	}
+	if d.PollInterval < 0 {
+		v.errorf(node, "poll_interval", "poll_interval must be positive")
+	} else if d.PollInterval == 0 {
+		d.PollInterval = cfg.PollInterval
+	}
+
+	if d.Outputs == nil {
+		if cfg.MQTT != nil {
+			d.Outputs = append(d.Outputs, MQTTOutput)
+		}
+		if cfg.Web != nil {
+			d.Outputs = append(d.Outputs, WebOutput)
+		}
+		if cfg.ModbusServer != nil {
+			d.Outputs = append(d.Outputs, ModbusServerOutput)
+		}
+		if d.Outputs == nil {
+			d.Outputs = []string{StdoutOutput}
+		}
+	}
+	outputs := lookup(node, "outputs")
+	for i, o := range d.Outputs {
+		configured := true
+		switch o {
+		case MQTTOutput:
+			configured = cfg.MQTT != nil
+		case WebOutput:
+			configured = cfg.Web != nil
+		case ModbusServerOutput:
+			configured = cfg.ModbusServer != nil
+		case StdoutOutput:
+		default:
+			v.errorf(outputs, strconv.Itoa(i), "invalid output '%s': want mqtt, web, modbus_server or stdout", o)
+			continue
+		}
+		if !configured {
+			v.errorf(outputs, strconv.Itoa(i), "output '%s' is not configured", o)
+		}
+	}
+	if d.HasOutput(StdoutOutput) && (d.HasOutput(MQTTOutput) || d.HasOutput(WebOutput)) {
+		v.errorf(node, "outputs", "output 'stdout' can't be used with mqtt or web")
+	}
+}
+
+// HasOutput returns whether the information read from the device is sent to 'output'.
+func (d *Device) HasOutput(output string) bool {
+	return slices.Contains(d.Outputs, output)
+}
+
+// PortOptions returns the options to open the port for 'c'. The address can be a URL, as in
+// common.ParseAddress, and its settings take precedence over the ones in 'c'.
+func (c *Connection) PortOptions() (*common.PortOptions, error) {
+	p, err := parity(c.Parity)
+	if err != nil {
+		return nil, err
+	}
+	stopBits := serial.OneStopBit
+	if c.StopBits == 2 {
+		stopBits = serial.TwoStopBits
+	}
+	return common.ParseAddress(&common.PortOptions{
+		Address: c.Address,
+		Mode: &serial.Mode{
+			BaudRate: c.BaudRate,
+			DataBits: c.DataBits,
+			StopBits: stopBits,
+			Parity:   p,
+		},
+		Type:        common.DeviceTypeFromString[c.DeviceType],
+		ReadTimeout: c.ReadTimeout,
+	})
+}
+
+func parity(s string) (serial.Parity, error) {
+	switch strings.ToUpper(s) {
+	case "", "N":
+		return serial.NoParity, nil
+	case "E":
+		return serial.EvenParity, nil
+	case "O":
+		return serial.OddParity, nil
+	default:
+		return serial.NoParity, fmt.Errorf("invalid parity '%s': want N, E or O", s)
+	}
+}
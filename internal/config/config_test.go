@@ -0,0 +1,299 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wombatt/internal/common"
+
+	"go.bug.st/serial"
+)
+
+const site = `
+poll_interval: 30s
+mqtt:
+  broker: tcp://127.0.0.1:1883
+web:
+  address: :8080
+buses:
+  - name: batteries
+    address: /dev/ttyUSB0
+    read_timeout: 1s
+  - name: gateway
+    address: tcp://192.168.1.40:502
+devices:
+  - name: eg4
+    kind: battery
+    model: EG4LLv2
+    bus: batteries
+    ids: [1, 2, 3]
+  - name: eg4_1
+    kind: inverter
+    model: eg4_18kpv
+    bus: gateway
+    ids: [2]
+    commands: [RealtimeData]
+    poll_interval: 5s
+    outputs: [web]
+  - name: pi30_1
+    kind: inverter
+    model: pi30
+    address: /dev/ttyS0
+    parity: E
+    commands: [Q1, QPIGS]
+    mqtt_prefix: pi30
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse("site.yaml", []byte(site))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.MQTT.TopicPrefix != "homeassistant" {
+		t.Errorf("MQTT.TopicPrefix = %q, want homeassistant", cfg.MQTT.TopicPrefix)
+	}
+	if len(cfg.Devices) != 3 {
+		t.Fatalf("got %d devices, want 3", len(cfg.Devices))
+	}
+
+	battery := cfg.Devices[0]
+	wantConn := Connection{
+		Address:     "/dev/ttyUSB0",
+		DeviceType:  "serial",
+		BaudRate:    9600,
+		DataBits:    8,
+		StopBits:    1,
+		Parity:      "N",
+		Protocol:    "auto",
+		ReadTimeout: time.Second,
+	}
+	if battery.Connection != wantConn {
+		t.Errorf("battery connection = %+v, want %+v", battery.Connection, wantConn)
+	}
+	if battery.PollInterval != 30*time.Second || battery.MQTTPrefix != "eg4" {
+		t.Errorf("battery poll interval = %v, MQTT prefix = %q", battery.PollInterval, battery.MQTTPrefix)
+	}
+	if !reflect.DeepEqual(battery.Outputs, []string{MQTTOutput, WebOutput}) {
+		t.Errorf("battery outputs = %v", battery.Outputs)
+	}
+
+	inverter := cfg.Devices[1]
+	if inverter.PollInterval != 5*time.Second || inverter.ReadTimeout != 5*time.Second || inverter.BaudRate != 2400 {
+		t.Errorf("inverter settings = %+v", inverter)
+	}
+	if !inverter.HasOutput(WebOutput) || inverter.HasOutput(MQTTOutput) {
+		t.Errorf("inverter outputs = %v", inverter.Outputs)
+	}
+	opts, err := inverter.PortOptions()
+	if err != nil {
+		t.Fatalf("PortOptions() error = %v", err)
+	}
+	if opts.Type != common.TCPDevice || opts.Address != "192.168.1.40:502" {
+		t.Errorf("inverter port = %v %s", opts.Type, opts.Address)
+	}
+
+	pi30 := cfg.Devices[2]
+	if !reflect.DeepEqual(pi30.IDs, []uint8{1}) || pi30.MQTTPrefix != "pi30" {
+		t.Errorf("pi30 IDs = %v, MQTT prefix = %q", pi30.IDs, pi30.MQTTPrefix)
+	}
+	opts, err = pi30.PortOptions()
+	if err != nil {
+		t.Fatalf("PortOptions() error = %v", err)
+	}
+	if opts.Mode.Parity != serial.EvenParity || opts.Mode.StopBits != serial.OneStopBit || opts.Mode.BaudRate != 2400 {
+		t.Errorf("pi30 mode = %+v", opts.Mode)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "empty",
+			config: "",
+			want:   []string{"f.yaml: empty configuration"},
+		},
+		{
+			name:   "syntax",
+			config: "devices:\n  - name: a\n    kind: battery: 1\n",
+			want:   []string{"f.yaml:3: mapping values are not allowed in this context"},
+		},
+		{
+			name:   "unknown setting",
+			config: "devices:\n  - name: a\n    baud: 9600\n",
+			want:   []string{"f.yaml:3: unknown setting 'baud'"},
+		},
+		{
+			name:   "wrong type",
+			config: "poll_interval: soon\ndevices: []\n",
+			want:   []string{"f.yaml:1: cannot unmarshal !!str `soon` into time.Duration"},
+		},
+		{
+			name: "devices",
+			config: `mqtt:
+  broker: tcp://127.0.0.1:1883
+  user: me
+buses:
+  - name: rs485
+    address: /dev/ttyUSB0
+    parity: X
+devices:
+  - name: a
+    kind: battery
+    model: EG4LLv3
+    bus: rs485
+  - name: a
+    kind: inverter
+    model: solark
+    bus: rs486
+    commands: [RealtimeData, QPIGS]
+    ids: [1, 2]
+  - name: c
+    kind: charger
+    address: udp:///dev/ttyS0
+    outputs: [web, email]
+`,
+			want: []string{
+				"f.yaml:3: both MQTT user and password are needed",
+				"f.yaml:7: invalid parity 'X': want N, E or O",
+				"f.yaml:9: missing battery IDs for device 'a'",
+				"f.yaml:11: invalid battery model 'EG4LLv3'",
+				"f.yaml:13: duplicate device name 'a'",
+				"f.yaml:16: unknown bus 'rs486'",
+				"f.yaml:17: invalid solark command 'QPIGS'",
+				"f.yaml:18: inverters have a single Modbus ID",
+				"f.yaml:20: invalid kind 'charger': want battery or inverter",
+				"f.yaml:21: invalid udp address 'udp:///dev/ttyS0': want udp://<host>:<port>",
+				"f.yaml:22: output 'web' is not configured",
+				"f.yaml:22: invalid output 'email': want mqtt, web, modbus_server or stdout",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("f.yaml", []byte(tt.config))
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Parse() error = %v, want Errors", err)
+			}
+			got := strings.Split(errs.Error(), "\n")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoadFormat(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"site.yaml", "site.YML", "site"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(site), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err != nil {
+			t.Errorf("Load(%s) error = %v", name, err)
+		}
+	}
+	path := filepath.Join(dir, "site.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	want := path + ": unsupported file extension '.json': the configuration must be a YAML (.yaml or .yml) or TOML (.toml) file"
+	if err == nil || err.Error() != want {
+		t.Errorf("Load() error = %v, want %s", err, want)
+	}
+}
+
+const siteTOML = `
+poll_interval = "30s"
+
+[mqtt]
+broker = "tcp://127.0.0.1:1883"
+
+[[buses]]
+name = "batteries"
+address = "/dev/ttyUSB0"
+read_timeout = "1s"
+
+[[devices]]
+name = "eg4"
+kind = "battery"
+model = "EG4LLv2"
+bus = "batteries"
+ids = [1, 2, 3]
+
+[[devices]]
+name = "pi30_1"
+kind = "inverter"
+model = "pi30"
+address = "/dev/ttyS0"
+commands = ["Q1", "QPIGS"]
+`
+
+func TestLoadTOML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "site.toml")
+	if err := os.WriteFile(path, []byte(siteTOML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.PollInterval != 30*time.Second || len(cfg.Devices) != 2 {
+		t.Fatalf("got poll interval %v and %d devices, want 30s and 2", cfg.PollInterval, len(cfg.Devices))
+	}
+	if d := cfg.Devices[0]; d.Address != "/dev/ttyUSB0" || d.ReadTimeout != time.Second || len(d.IDs) != 3 {
+		t.Errorf("Devices[0] = %+v", d)
+	}
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"", "site.toml: empty configuration"},
+		{"poll_interval = \"30s\"\nmqtt = [", "site.toml:2: unexpected EOF; expected value"},
+		{"pollinterval = \"30s\"\n", "site.toml: unknown setting 'pollinterval'"},
+		{siteTOML + "\n[[devices]]\nname = \"b2\"\nkind = \"battery\"\nmodel = \"EG4LLv3\"\nbus = \"batteries\"\nids = [4]\n",
+			"site.toml: invalid battery model 'EG4LLv3'"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTOML("site.toml", []byte(tt.data))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("ParseTOML(%q) error = %v, want %s", tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		Devices: []*Device{
+			{Name: "b1", Kind: BatteryKind, Model: "EG4LLv2", Connection: Connection{Address: "/dev/ttyUSB0"}, IDs: []uint8{1}},
+			{Name: "b2", Kind: BatteryKind, Model: "EG4LLv2", Connection: Connection{Address: "/dev/ttyUSB0", BaudRate: 19200}, IDs: []uint8{2}},
+			{Name: "i1", Kind: InverterKind, Model: "pi30", Connection: Connection{Address: "/dev/ttyS0"}, Commands: []string{"Q1"}},
+		},
+	}
+	err := cfg.Validate()
+	want := "device 'b2' has the address of 'b1' with different connection settings"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Validate() error = %v, want %q", err, want)
+	}
+
+	cfg.Devices[1].BaudRate = 0
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if cfg.PollInterval != DefaultPollInterval || cfg.Devices[2].BaudRate != 2400 || !cfg.Devices[2].HasOutput(StdoutOutput) {
+		t.Errorf("defaults not set: %+v %+v", cfg, cfg.Devices[2])
+	}
+}
@@ -18,6 +18,7 @@ func RunCommands(ctx context.Context, port common.Port, protocol string, id uint
 		}
 		return nil, errors
 	}
+	reader = modbus.NewImageReader(reader, modbus.ImageFromContext(ctx))
 	var results []any
 	var errors []error
 
@@ -0,0 +1,192 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"wombatt/internal/common"
+)
+
+// MaxASCIIFrameLength is the maximum length of a Modbus ASCII frame, including ':' and CRLF.
+const MaxASCIIFrameLength = 513
+
+// ASCII reads and writes registers using the Modbus ASCII protocol: a ':' start character,
+// the hex-encoded ID, function code, data and LRC, and a CRLF end sequence.
+type ASCII struct {
+	port common.Port
+}
+
+func NewASCII(port common.Port) RegisterReader {
+	return &ASCII{port: port}
+}
+
+// LRC returns the longitudinal redundancy check for the given bytes.
+func LRC(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// buildASCIIFrame converts an RTU frame, including its CRC, into an ASCII frame.
+func buildASCIIFrame(raw []byte) []byte {
+	msg := raw[:len(raw)-2] // Exclude the CRC
+	var b bytes.Buffer
+	b.WriteByte(':')
+	b.WriteString(strings.ToUpper(hex.EncodeToString(msg)))
+	b.WriteString(fmt.Sprintf("%02X", LRC(msg)))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// readASCIIResponse reads an entire ASCII frame and returns it in the same layout as an RTU frame,
+// with two zero bytes in place of the CRC.
+func readASCIIResponse(port io.Reader) ([]byte, error) {
+	line, err := readASCIILine(port)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.IndexByte(line, ':')
+	if start == -1 {
+		return nil, fmt.Errorf("missing start of frame: '%s'", strings.TrimSpace(string(line)))
+	}
+	line = line[start:]
+	if len(line) < 9 || line[len(line)-2] != '\r' {
+		// Minimum frame: ':', 2 chars each for ID, function code and LRC, and CRLF.
+		return nil, fmt.Errorf("short frame: '%s'", strings.TrimSpace(string(line)))
+	}
+	msg, err := hex.DecodeString(string(line[1 : len(line)-2]))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding ascii data: %w", err)
+	}
+	data := msg[:len(msg)-1]
+	if lrc := LRC(data); lrc != msg[len(msg)-1] {
+		return nil, fmt.Errorf("invalid lrc: got %02x, want %02x", msg[len(msg)-1], lrc)
+	}
+	if (data[1] & 0x80) == 0x80 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("short exception frame: '%s'", strings.TrimSpace(string(line)))
+		}
+		return nil, protocolError(data[2])
+	}
+	return append(data, 0, 0), nil
+}
+
+// readASCIILine reads from 'port' up to and including the first LF. It reads a byte at a time so
+// that nothing after the LF is consumed.
+func readASCIILine(port io.Reader) ([]byte, error) {
+	line := make([]byte, 0, MaxASCIIFrameLength)
+	b := make([]byte, 1)
+	for len(line) < MaxASCIIFrameLength {
+		if _, err := io.ReadFull(port, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+		if b[0] == '\n' {
+			return line, nil
+		}
+	}
+	return nil, fmt.Errorf("frame too long: want at most %d bytes", MaxASCIIFrameLength)
+}
+
+// ReadHoldingRegisters requests 'count' holding registers from unit 'id' from the 'start' memory address.
+// and reads the response back.
+func (a *ASCII) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return a.readRegisters(id, ReadHoldingRegisters, start, count)
+}
+
+// ReadInputRegisters requests 'count' input registers from unit 'id' from the 'start' memory address.
+// and reads the response back.
+func (a *ASCII) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return a.readRegisters(id, ReadInputRegisters, start, count)
+}
+
+func (a *ASCII) readRegisters(id uint8, functionCode RTUFunction, start uint16, count uint8) ([]byte, error) {
+	raw, err := a.send(buildReadRequestRTUFrame(id, functionCode, start, uint16(count)))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 5 {
+		return nil, fmt.Errorf("short frame: got %d, want at least 3 bytes", len(raw)-2)
+	}
+	return NewRTUFrame(raw).Data(), nil
+}
+
+// ReadCoils requests 'count' coils from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (a *ASCII) ReadCoils(id uint8, start uint16, count uint16) ([]bool, error) {
+	return a.readBits(id, ReadCoils, start, count)
+}
+
+// ReadDiscreteInputs requests 'count' discrete inputs from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (a *ASCII) ReadDiscreteInputs(id uint8, start uint16, count uint16) ([]bool, error) {
+	return a.readBits(id, ReadDiscreteInputs, start, count)
+}
+
+func (a *ASCII) readBits(id uint8, functionCode RTUFunction, start uint16, count uint16) ([]bool, error) {
+	if err := checkBitCount(count); err != nil {
+		return nil, err
+	}
+	raw, err := a.send(buildReadRequestRTUFrame(id, functionCode, start, count))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 5 {
+		return nil, fmt.Errorf("short frame: got %d, want at least 3 bytes", len(raw)-2)
+	}
+	return unpackBits(NewRTUFrame(raw).Data(), count)
+}
+
+// WriteSingleCoil turns the coil at 'address' in unit 'id' on or off and verifies the response.
+func (a *ASCII) WriteSingleCoil(id uint8, address uint16, value bool) error {
+	return a.write(id, WriteSingleCoil, writeSingleData(address, coilValue(value)))
+}
+
+// WriteSingleRegister writes 'value' to the register at 'address' in unit 'id' and verifies the response.
+func (a *ASCII) WriteSingleRegister(id uint8, address uint16, value uint16) error {
+	return a.write(id, WriteSingleRegister, writeSingleData(address, value))
+}
+
+// WriteMultipleCoils writes 'values' to the coils in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (a *ASCII) WriteMultipleCoils(id uint8, start uint16, values []bool) error {
+	data, err := writeMultipleCoilsData(start, values)
+	if err != nil {
+		return err
+	}
+	return a.write(id, WriteMultipleCoil, data)
+}
+
+// WriteMultipleRegisters writes 'values' to the registers in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (a *ASCII) WriteMultipleRegisters(id uint8, start uint16, values []uint16) error {
+	data, err := writeMultipleRegistersData(start, values)
+	if err != nil {
+		return err
+	}
+	return a.write(id, WriteMultipleRegisters, data)
+}
+
+func (a *ASCII) write(id uint8, functionCode RTUFunction, data []byte) error {
+	f := buildRTUFrame(id, functionCode, data)
+	raw, err := a.send(f)
+	if err != nil {
+		return err
+	}
+	return checkWriteResponse(f, raw)
+}
+
+// send sends the RTU frame 'raw' as an ASCII frame and returns the response in the same
+// layout as an RTU frame, with two zero bytes in place of the CRC.
+func (a *ASCII) send(raw []byte) ([]byte, error) {
+	_ = a.port.ResetInputBuffer()
+	if _, err := a.port.Write(buildASCIIFrame(raw)); err != nil {
+		return nil, err
+	}
+	return readASCIIResponse(a.port)
+}
@@ -0,0 +1,163 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+func TestLRC(t *testing.T) {
+	tests := []struct {
+		data string
+		lrc  uint8
+	}{
+		{data: "1103006b0003", lrc: 0x7e},
+		{data: "110306ae4156524340", lrc: 0xcc},
+		{data: "", lrc: 0},
+	}
+
+	for _, tt := range tests {
+		data, err := hex.DecodeString(tt.data)
+		if err != nil {
+			t.Fatalf("malformed data string in test: %s", tt.data)
+		}
+		if got := LRC(data); got != tt.lrc {
+			t.Errorf("wrong LRC for %s: got %02x; want %02x", tt.data, got, tt.lrc)
+		}
+	}
+}
+
+func TestASCIIReadHoldingRegisters(t *testing.T) {
+	tests := []struct {
+		resp   string
+		data   string
+		errstr string
+	}{
+		{
+			resp: ":110306AE4156524340CC\r\n",
+			data: "ae4156524340",
+		},
+		{ // Leading garbage before the start of frame
+			resp: "\x00:110306AE4156524340CC\r\n",
+			data: "ae4156524340",
+		},
+		{
+			resp:   ":1183026A\r\n",
+			errstr: "illegal data address",
+		},
+		{
+			resp:   ":110306AE4156524340CD\r\n",
+			errstr: "invalid lrc",
+		},
+		{
+			resp:   "110306AE4156524340CC\r\n",
+			errstr: "missing start of frame",
+		},
+		{
+			resp:   ":1103\r\n",
+			errstr: "short frame",
+		},
+		{
+			resp:   ":110306AE4156524340CC",
+			errstr: "EOF",
+		},
+		{
+			resp:   ":110306AE41565243ZZCC\r\n",
+			errstr: "error decoding ascii data",
+		},
+		{
+			resp:   ":" + strings.Repeat("0", MaxASCIIFrameLength) + "\r\n",
+			errstr: "frame too long",
+		},
+	}
+
+	for tid, tt := range tests {
+		var req bytes.Buffer
+		port := common.NewTestPort(strings.NewReader(tt.resp), &req, 0)
+		reader := NewASCII(port)
+		data, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3)
+		if got, want := req.String(), ":1103006B00037E\r\n"; got != want {
+			t.Errorf("wrong request (%d): got %q; want %q", tid, got, want)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("read failed (%d): got %v; want no error", tid, err)
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("read succeded, but it should fail (%d): got no error; want %v", tid, tt.errstr)
+		} else if err != nil && !strings.Contains(err.Error(), tt.errstr) {
+			t.Errorf("unkown error (%d): got '%s'; want error with '%s'", tid, err, tt.errstr)
+		}
+		if got := hex.EncodeToString(data); got != tt.data {
+			t.Errorf("wrong data (%d): got %s; want %s", tid, got, tt.data)
+		}
+	}
+}
+
+func TestASCIIConsecutiveResponses(t *testing.T) {
+	// The bytes after the first frame must not be consumed while reading it.
+	port := common.NewTestPort(strings.NewReader(":110306AE4156524340CC\r\n:110306AE4156524341CB\r\n"), &bytes.Buffer{}, 0)
+	reader := NewASCII(port)
+	for _, want := range []string{"ae4156524340", "ae4156524341"} {
+		data, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if got := hex.EncodeToString(data); got != want {
+			t.Errorf("wrong data: got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestASCIIReadCoils(t *testing.T) {
+	var req bytes.Buffer
+	port := common.NewTestPort(strings.NewReader(":110105CD6BB20E1BD6\r\n"), &req, 0)
+	reader := NewASCII(port).(BitReader)
+	bits, err := reader.ReadCoils(0x11, 0x13, 0x25)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got, want := req.String(), ":110100130025B6\r\n"; got != want {
+		t.Errorf("wrong request: got %q; want %q", got, want)
+	}
+	if len(bits) != 0x25 || !bits[0] || bits[1] || !bits[2] || !bits[3] {
+		t.Errorf("wrong coils: got %v", bits)
+	}
+}
+
+func TestASCIIWrite(t *testing.T) {
+	tests := []struct {
+		resp   string
+		errstr string
+	}{
+		{
+			resp: ":110600010003E5\r\n",
+		},
+		{
+			resp:   ":11860267\r\n",
+			errstr: "illegal data address",
+		},
+		{
+			resp:   ":110600010004E4\r\n",
+			errstr: "unexpected write response",
+		},
+	}
+
+	for tid, tt := range tests {
+		var req bytes.Buffer
+		port := common.NewTestPort(strings.NewReader(tt.resp), &req, 0)
+		w, _ := Writer(port, ASCIIProtocol)
+		err := w.WriteSingleRegister(0x11, 1, 3)
+		if got, want := req.String(), ":110600010003E5\r\n"; got != want {
+			t.Errorf("wrong request (%d): got %q; want %q", tid, got, want)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("write failed (%d): got %v; want no error", tid, err)
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("write succeded, but it should fail (%d): got no error; want %v", tid, tt.errstr)
+		} else if err != nil && !strings.Contains(err.Error(), tt.errstr) {
+			t.Errorf("unkown error (%d): got '%s'; want error with '%s'", tid, err, tt.errstr)
+		}
+	}
+}
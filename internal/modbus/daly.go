@@ -0,0 +1,99 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+
+	"wombatt/internal/common"
+)
+
+const (
+	dalyStartFlag   = 0xa5
+	dalyAddressBase = 0x3f // Requests to the BMS with address 1 are sent to 0x40, and so on.
+	dalyDataLength  = 8
+	dalyFrameSize   = 4 + dalyDataLength + 1 // Start flag, address, data ID, length, data and checksum.
+)
+
+// Daly is the protocol of the UART and RS485 ports of Daly BMS. It is NOT Modbus.
+// Every request and response frame has 13 bytes: the 0xA5 start flag, the address, the data ID,
+// the data length (always 8), the data, and a checksum with the lowest byte of the sum of the
+// previous bytes. Some data IDs, like the cell voltages, are answered with several frames.
+// Requests are sent to 0x3F plus the address of the BMS, and responses come from the address of the BMS.
+type Daly struct {
+	port common.Port
+}
+
+func NewDaly(port common.Port) RegisterReader {
+	return &Daly{port: port}
+}
+
+func buildDalyRequestFrame(id, dataID uint8) []byte {
+	f := make([]byte, dalyFrameSize)
+	f[0] = dalyStartFlag
+	f[1] = dalyAddressBase + id
+	f[2] = dataID
+	f[3] = dalyDataLength
+	f[dalyFrameSize-1] = dalyChecksum(f[:dalyFrameSize-1])
+	return f
+}
+
+// ReadHoldingRegisters sends the data ID in 'count' to the BMS with address 'id' and returns the
+// data of the 'start' frames of the response, or of a single frame if 'start' is 0.
+// For Daly, this is the same as ReadInputRegisters.
+func (d *Daly) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return d.readRegisters(id, start, count)
+}
+
+// ReadInputRegisters sends the data ID in 'count' to the BMS with address 'id' and returns the
+// data of the 'start' frames of the response, or of a single frame if 'start' is 0.
+// For Daly, this is the same as ReadHoldingRegisters.
+func (d *Daly) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return d.readRegisters(id, start, count)
+}
+
+func (d *Daly) readRegisters(id uint8, frames uint16, dataID uint8) ([]byte, error) {
+	_ = d.port.ResetInputBuffer()
+	if _, err := d.port.Write(buildDalyRequestFrame(id, dataID)); err != nil {
+		return nil, err
+	}
+	frames = max(frames, 1)
+	data := make([]byte, 0, int(frames)*dalyDataLength)
+	for range frames {
+		f, err := d.ReadResponse(id, dataID)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, f[4:4+dalyDataLength]...)
+	}
+	return data, nil
+}
+
+// ReadResponse reads a response frame for 'dataID' from the BMS with address 'id'.
+func (d *Daly) ReadResponse(id uint8, dataID uint8) ([]byte, error) {
+	f := make([]byte, dalyFrameSize)
+	if _, err := io.ReadFull(d.port, f); err != nil {
+		return nil, err
+	}
+	switch {
+	case f[0] != dalyStartFlag:
+		return nil, fmt.Errorf("wrong start flag: got 0x%02x, want 0x%02x", f[0], dalyStartFlag)
+	case f[1] != id:
+		return nil, fmt.Errorf("response from the wrong address: got %d, want %d", f[1], id)
+	case f[2] != dataID:
+		return nil, fmt.Errorf("wrong data ID: got 0x%02x, want 0x%02x", f[2], dataID)
+	case f[3] != dalyDataLength:
+		return nil, fmt.Errorf("wrong data length: got %d, want %d", f[3], dalyDataLength)
+	}
+	if sum := dalyChecksum(f[:dalyFrameSize-1]); sum != f[dalyFrameSize-1] {
+		return nil, fmt.Errorf("checksum error: got %02X, want %02X", sum, f[dalyFrameSize-1])
+	}
+	return f, nil
+}
+
+func dalyChecksum(b []byte) uint8 {
+	var sum uint8
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
@@ -0,0 +1,132 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+func TestDalyRequest(t *testing.T) {
+	tests := []struct {
+		id     uint8
+		dataID uint8
+		req    string
+	}{
+		{
+			id:     1,
+			dataID: 0x90, // SOC, total voltage and current
+			req:    "a5409008" + "0000000000000000" + "7d",
+		},
+		{
+			id:     1,
+			dataID: 0x95, // Cell voltages
+			req:    "a5409508" + "0000000000000000" + "82",
+		},
+		{
+			id:     2,
+			dataID: 0x90,
+			req:    "a5419008" + "0000000000000000" + "7e",
+		},
+		{
+			id:     5,
+			dataID: 0x95,
+			req:    "a5449508" + "0000000000000000" + "86",
+		},
+	}
+	for tid, tt := range tests {
+		data := buildDalyRequestFrame(tt.id, tt.dataID)
+		if got := hex.EncodeToString(data); got != tt.req {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.req)
+		}
+	}
+}
+
+func TestDalyResponse(t *testing.T) {
+	tests := []struct {
+		id     uint8
+		dataID uint8
+		frames uint16
+		resp   string
+		want   string // hex-encoded data
+		err    string
+	}{
+		{
+			id:     1,
+			dataID: 0x90,
+			resp:   "a5019008" + "02140000754803e8" + "fc",
+			want:   "02140000754803e8",
+		},
+		{
+			id:     1,
+			dataID: 0x95,
+			frames: 2,
+			resp:   "a5019508" + "010ce40ce50ce600" + "17" + "a5019508" + "020ce70ce80ce900" + "21",
+			want:   "010ce40ce50ce600" + "020ce70ce80ce900",
+		},
+		{
+			id:     2,
+			dataID: 0x90,
+			resp:   "a5029008" + "02140000754803e8" + "fd",
+			want:   "02140000754803e8",
+		},
+		{
+			id:     2,
+			dataID: 0x90,
+			resp:   "a5019008" + "02140000754803e8" + "fc",
+			err:    "response from the wrong address: got 1, want 2",
+		},
+		{
+			id:     1,
+			dataID: 0x90,
+			resp:   "a5019008" + "02140000754803e8" + "fd",
+			err:    "checksum error: got FC, want FD",
+		},
+		{
+			id:     1,
+			dataID: 0x91,
+			resp:   "a5019008" + "02140000754803e8" + "fc",
+			err:    "wrong data ID: got 0x90, want 0x91",
+		},
+	}
+	for tid, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test %d: %s", tid, tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		reader, _ := Reader(port, DalyProtocol, "")
+		if _, ok := reader.(*Daly); !ok {
+			t.Fatalf("wrong reader type: got %T want *Daly", reader)
+		}
+		data, err := reader.ReadHoldingRegisters(tt.id, tt.frames, tt.dataID)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("test %d got error %v; want %s", tid, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d got error %v", tid, err)
+		} else if got := hex.EncodeToString(data); got != tt.want {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.want)
+		}
+		if !bytes.Equal(req.Bytes(), buildDalyRequestFrame(tt.id, tt.dataID)) {
+			t.Errorf("test %d sent '%s'", tid, hex.EncodeToString(req.Bytes()))
+		}
+	}
+}
+
+func TestDalyAutoProtocol(t *testing.T) {
+	port := common.NewTestPort(bytes.NewReader(nil), io.Discard, common.SerialDevice)
+	reader, err := Reader(port, AutoProtocol, "daly")
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	if _, ok := reader.(*Daly); !ok {
+		t.Errorf("wrong reader type: got %T want *Daly", reader)
+	}
+}
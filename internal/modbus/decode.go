@@ -0,0 +1,260 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The Split functions find the frame at the start of 'data'. They return the length of the frame,
+// 0 if more data is needed, or -1 if 'data' does not start with a frame for that protocol.
+// 'ok' is true if the checksum of the frame is valid.
+
+var functionNames = map[RTUFunction]string{
+	ReadCoils:              "read coils",
+	ReadDiscreteInputs:     "read discrete inputs",
+	ReadHoldingRegisters:   "read holding registers",
+	ReadInputRegisters:     "read input registers",
+	WriteSingleCoil:        "write single coil",
+	WriteSingleRegister:    "write single register",
+	WriteMultipleCoil:      "write multiple coils",
+	WriteMultipleRegisters: "write multiple registers",
+}
+
+// String returns the name of the function code.
+func (f RTUFunction) String() string {
+	if s, ok := functionNames[f&0x7f]; ok {
+		return s
+	}
+	return fmt.Sprintf("function 0x%02x", uint8(f))
+}
+
+// SplitRTU finds the RTU request or response at the start of 'data'.
+func SplitRTU(data []byte, request bool) (n int, ok bool) {
+	if len(data) < 3 {
+		return 0, false
+	}
+	function := RTUFunction(data[1])
+	var pending int
+	if request {
+		if expectedRequestLength(function, 0) == -1 {
+			return -1, false
+		}
+		if len(data) < 7 {
+			return 0, false
+		}
+		pending = 2 + expectedRequestLength(function, uint16(data[6]))
+	} else {
+		if expectedResponseLength(function, 0) == -1 {
+			return -1, false
+		}
+		pending = 3 + expectedResponseLength(function, data[2])
+	}
+	n = pending + 2 // CRC
+	if len(data) < n {
+		return 0, false
+	}
+	return n, NewRTUFrame(data[:n]).CRC() == CRC(data[:n-2])
+}
+
+// DescribeRTU returns a description of the RTU frame, including the CRC status.
+// For responses, 'req' is the request frame, if known.
+func DescribeRTU(frame []byte, req []byte, request bool) string {
+	f := NewRTUFrame(frame)
+	checksum := CRC(frame[:len(frame)-2])
+	status := "CRC ok"
+	if checksum != f.CRC() {
+		status = fmt.Sprintf("CRC error: got %04x, want %04x", f.CRC(), checksum)
+	}
+	return fmt.Sprintf("%s (%s)", describePDU(frame[:len(frame)-2], req, request), status)
+}
+
+// SplitTCP finds the Modbus TCP request or response, including the MBAP header, at the start of 'data'.
+// There is no checksum in Modbus TCP, and 'ok' is true for any complete frame.
+func SplitTCP(data []byte, request bool) (n int, ok bool) {
+	if len(data) >= 4 && binary.BigEndian.Uint16(data[2:]) != 0 {
+		return -1, false // Protocol ID must be 0.
+	}
+	if len(data) < 8 {
+		return 0, false
+	}
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	if length < 2 || length > MaxRTUFrameLength-2 {
+		return -1, false
+	}
+	function := RTUFunction(data[7])
+	if (request && expectedRequestLength(function, 0) == -1) || (!request && expectedResponseLength(function, 0) == -1) {
+		return -1, false
+	}
+	n = 6 + length
+	if len(data) < n {
+		return 0, false
+	}
+	return n, true
+}
+
+// DescribeTCP returns a description of the Modbus TCP frame. For responses, 'req' is the
+// request frame, if known.
+func DescribeTCP(frame []byte, req []byte, request bool) string {
+	if req != nil {
+		req = req[6:]
+	}
+	return fmt.Sprintf("TID %d %s", binary.BigEndian.Uint16(frame), describePDU(frame[6:], req, request))
+}
+
+// describePDU returns a description of 'data': the unit ID, function code and data, with no CRC.
+// 'req' has the request in the same layout, if known.
+func describePDU(data []byte, req []byte, request bool) string {
+	id := data[0]
+	function := RTUFunction(data[1])
+	pdu := data[2:]
+	if len(pdu) < minPDUDataLength(function, request) {
+		return fmt.Sprintf("ID %d %v: short frame", id, function)
+	}
+	var s string
+	switch {
+	case function&0x80 != 0:
+		s = fmt.Sprintf("exception: %v", RTUProtocolError(data[2]))
+	case request:
+		s = describeRequest(function, pdu)
+	default:
+		s = describeResponse(function, pdu, req)
+	}
+	return fmt.Sprintf("ID %d %v: %s", id, function, s)
+}
+
+// minPDUDataLength returns the minimum length of the data after the function code.
+func minPDUDataLength(function RTUFunction, request bool) int {
+	switch {
+	case function&0x80 != 0:
+		return 1
+	case request && (function == WriteMultipleCoil || function == WriteMultipleRegisters):
+		return 5
+	case request:
+		return 4
+	case function == ReadCoils || function == ReadDiscreteInputs || function == ReadHoldingRegisters || function == ReadInputRegisters:
+		return 1
+	default:
+		return 4
+	}
+}
+
+func describeRequest(function RTUFunction, pdu []byte) string {
+	address := binary.BigEndian.Uint16(pdu)
+	value := binary.BigEndian.Uint16(pdu[2:])
+	switch function {
+	case WriteSingleCoil:
+		return fmt.Sprintf("address %d, value %s", address, onOff(value == 0xff00))
+	case WriteSingleRegister:
+		return fmt.Sprintf("address %d, value 0x%04x", address, value)
+	case WriteMultipleCoil:
+		bits, _ := unpackBits(pdu[5:], value)
+		return fmt.Sprintf("address %d, count %d, values %s", address, value, describeBits(bits))
+	case WriteMultipleRegisters:
+		return fmt.Sprintf("address %d, count %d, values %s", address, value, describeRegisters(pdu[5:], nil))
+	default:
+		return fmt.Sprintf("address %d, count %d", address, value)
+	}
+}
+
+func describeResponse(function RTUFunction, pdu []byte, req []byte) string {
+	var address, count uint16
+	known := len(req) >= 6 && RTUFunction(req[1]) == function
+	if known {
+		address = binary.BigEndian.Uint16(req[2:])
+		count = binary.BigEndian.Uint16(req[4:])
+	}
+	switch function {
+	case ReadCoils, ReadDiscreteInputs:
+		if !known {
+			return fmt.Sprintf("%d bytes: %s", pdu[0], hex.EncodeToString(pdu[1:]))
+		}
+		bits, err := unpackBits(pdu[1:], count)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("address %d, values %s", address, describeBits(bits))
+	case ReadHoldingRegisters, ReadInputRegisters:
+		if !known {
+			return fmt.Sprintf("%d bytes: %s", pdu[0], describeRegisters(pdu[1:], nil))
+		}
+		return describeRegisters(pdu[1:], &address)
+	default:
+		// Write responses echo the address and the value or count.
+		return fmt.Sprintf("address %d, value/count %d", binary.BigEndian.Uint16(pdu), binary.BigEndian.Uint16(pdu[2:]))
+	}
+}
+
+// describeRegisters returns the registers in 'data' in hexadecimal, prefixed by their address
+// when 'address' is not nil.
+func describeRegisters(data []byte, address *uint16) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(data); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if address != nil {
+			fmt.Fprintf(&b, "%d=", *address+uint16(i/2))
+		}
+		fmt.Fprintf(&b, "0x%04x", binary.BigEndian.Uint16(data[i:]))
+	}
+	return b.String()
+}
+
+func describeBits(bits []bool) string {
+	s := make([]string, len(bits))
+	for i, b := range bits {
+		s[i] = onOff(b)
+	}
+	return strings.Join(s, " ")
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// SplitLFP4 finds the LFP4 request or response at the start of 'data'.
+func SplitLFP4(data []byte, _ bool) (n int, ok bool) {
+	if len(data) == 0 {
+		return 0, false
+	}
+	if data[0] != 0x7e {
+		return -1, false
+	}
+	eoi := bytes.IndexByte(data, 0x0d)
+	if eoi == -1 {
+		if len(data) > 18+0x0fff {
+			return -1, false // Longer than the maximum length.
+		}
+		return 0, false
+	}
+	n = eoi + 1
+	if n < 18 { // SOI, VER, ADR, CID1, CID2/RTN, LENGTH, CHKSUM and EOI
+		return -1, false
+	}
+	return n, verifyChecksum(data[:n]) == nil
+}
+
+// DescribeLFP4 returns a description of the LFP4 frame, including the CHKSUM status.
+func DescribeLFP4(frame []byte, request bool) string {
+	status := "CHKSUM ok"
+	if err := verifyChecksum(frame); err != nil {
+		status = err.Error()
+	}
+	adr, _ := asciiToBin(frame[3:5])
+	code, _ := asciiToBin(frame[7:9])
+	info := frame[13 : len(frame)-5]
+	if request {
+		return fmt.Sprintf("ADR %d CID2 0x%02x: info '%s' (%s)", adr, code, info, status)
+	}
+	rtn := lfp4ErrorString(LFP4ReturnCode(code))
+	if rtn == "" {
+		rtn = "normal"
+	}
+	return fmt.Sprintf("ADR %d RTN %s: info '%s' (%s)", adr, rtn, info, status)
+}
@@ -0,0 +1,73 @@
+package modbus
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"wombatt/internal/common"
+)
+
+// Gateway forwards Modbus TCP requests to devices in an RTU bus and sends their responses back.
+// Requests are sent one at a time, holding the port lock, so multiple TCP clients and other
+// users of the same port can share the bus.
+type Gateway struct {
+	port common.Port
+}
+
+func NewGateway(port common.Port) *Gateway {
+	return &Gateway{port: port}
+}
+
+// ServeTCP accepts Modbus TCP connections from 'l' and forwards their requests until ctx is done.
+// 'l' is closed when ctx is done.
+func (g *Gateway) ServeTCP(ctx context.Context, l net.Listener) error {
+	return serveMBAP(ctx, l, g.forward)
+}
+
+// forward sends the request PDU 'pdu' to the unit in the header as an RTU frame and returns the
+// response PDU. Errors talking to the device are returned as GWTargetFailedToRespond exceptions.
+func (g *Gateway) forward(header TCPRTUHeader, pdu []byte) []byte {
+	function := RTUFunction(pdu[0])
+	if expectedResponseLength(function, 0) == -1 {
+		return exceptionPDU(function, IllegalFunction)
+	}
+	resp, err := g.exchange(header, function, pdu)
+	if err != nil {
+		slog.Error("error writing request", "unit-id", header.UnitID, "error", err)
+		// The port is reopened once the lock is released, as reopening takes it too.
+		if err := g.port.ReopenWithBackoff(); err != nil {
+			slog.Error("error reopening", "error", err)
+		}
+		return exceptionPDU(function, GWTargetFailedToRespond)
+	}
+	return resp
+}
+
+// exchange sends the request to the device and reads its response PDU, holding the port lock.
+// Only errors writing the request are returned, as they need the port to be reopened.
+func (g *Gateway) exchange(header TCPRTUHeader, function RTUFunction, pdu []byte) ([]byte, error) {
+	g.port.Lock()
+	defer g.port.Unlock()
+
+	_ = g.port.ResetInputBuffer()
+	if _, err := g.port.Write(buildRTUFrame(header.UnitID, function, pdu[1:])); err != nil {
+		return nil, err
+	}
+	if header.UnitID == 0 {
+		// Broadcast requests have no response.
+		return nil, nil
+	}
+	frame, err := readRTUResponse(g.port)
+	if frame == nil || frame.ID() != header.UnitID || frame.Function()&0x7f != function {
+		slog.Debug("no valid response", "unit-id", header.UnitID, "function", function, "error", err)
+		return exceptionPDU(function, GWTargetFailedToRespond), nil
+	}
+	raw := frame.RawData()
+	if CRC(raw[:len(raw)-2]) != frame.CRC() {
+		slog.Debug("invalid response", "unit-id", header.UnitID, "function", function, "error", err)
+		return exceptionPDU(function, GWTargetFailedToRespond), nil
+	}
+	// Exception responses are forwarded as they are.
+	return raw[1 : len(raw)-2], nil
+}
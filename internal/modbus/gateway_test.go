@@ -0,0 +1,103 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wombatt/internal/common"
+)
+
+func TestGateway(t *testing.T) {
+	resp, _ := hex.DecodeString("110306ae415652434049ad" + "118302c134" + "110306ae415652434049ae")
+	var req bytes.Buffer
+	rtuPort := common.NewTestPort(bytes.NewReader(resp), &req, common.SerialDevice)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewGateway(rtuPort).ServeTCP(ctx, l) }()
+
+	port, err := common.OpenPort(&common.PortOptions{Address: l.Addr().String(), Type: common.TCPDevice})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer port.Close()
+	reader := NewTCP(port)
+
+	data, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got, want := hex.EncodeToString(data), "ae4156524340"; got != want {
+		t.Errorf("wrong data: got %s; want %s", got, want)
+	}
+	errs := []string{"illegal data address", "gateway target failed to respond", "gateway target failed to respond"}
+	for i, want := range errs {
+		if _, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("wrong error (%d): got %v; want %s", i, err, want)
+		}
+	}
+	if got, want := hex.EncodeToString(req.Bytes()), strings.Repeat("1103006b00037687", 4); got != want {
+		t.Errorf("wrong RTU requests: got %s; want %s", got, want)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("ServeTCP failed: %v", err)
+	}
+}
+
+// failingPort fails every write, and takes its lock to reopen like the ports opened with OpenPort.
+type failingPort struct {
+	*common.TestPort
+	mu      sync.Mutex
+	reopens int
+}
+
+func (p *failingPort) Lock()   { p.mu.Lock() }
+func (p *failingPort) Unlock() { p.mu.Unlock() }
+
+func (p *failingPort) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func (p *failingPort) ReopenWithBackoff() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reopens++
+	return nil
+}
+
+func TestGatewayWriteError(t *testing.T) {
+	port := &failingPort{TestPort: common.NewTestPort(bytes.NewReader(nil), nil, common.SerialDevice)}
+	g := NewGateway(port)
+	done := make(chan []byte)
+	go func() {
+		for range 2 {
+			done <- g.forward(TCPRTUHeader{UnitID: 0x11}, []byte{byte(ReadHoldingRegisters), 0x00, 0x6b, 0x00, 0x03})
+		}
+	}()
+	for i := range 2 {
+		select {
+		case got := <-done:
+			if want := exceptionPDU(ReadHoldingRegisters, GWTargetFailedToRespond); !bytes.Equal(got, want) {
+				t.Errorf("wrong response (%d): got %x; want %x", i, got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("forward blocked after a write error (%d)", i)
+		}
+	}
+	if port.reopens != 2 {
+		t.Errorf("got %d reopens; want 2", port.reopens)
+	}
+}
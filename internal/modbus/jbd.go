@@ -0,0 +1,97 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"wombatt/internal/common"
+)
+
+const (
+	jbdStartFlag = 0xdd
+	jbdEndFlag   = 0x77
+	jbdRead      = 0xa5
+	jbdStatusOK  = 0x00
+)
+
+// JBD is the protocol of the UART and RS485 ports of JBD (Xiaoxiang, Overkill Solar) BMS. It is NOT Modbus.
+// Requests have the 0xDD start flag, 0xA5 for reads, the register, the data length, the data,
+// a 16-bit checksum and the 0x77 end flag. Responses have the start flag, the register, a status,
+// the data length, the data, the checksum and the end flag. The checksum is the two's complement of
+// the sum of the bytes between the register (request) or status (response) and the data.
+// The BMS have no address, so the unit id is ignored.
+type JBD struct {
+	port common.Port
+}
+
+func NewJBD(port common.Port) RegisterReader {
+	return &JBD{port: port}
+}
+
+func buildJBDRequestFrame(register uint8) []byte {
+	f := []byte{jbdStartFlag, jbdRead, register, 0, 0, 0, jbdEndFlag}
+	binary.BigEndian.PutUint16(f[4:], jbdChecksum(f[2:4]))
+	return f
+}
+
+// ReadHoldingRegisters reads the register in 'count' and returns its data. 'id' and 'start' are ignored.
+// For JBD, this is the same as ReadInputRegisters.
+func (j *JBD) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return j.readRegisters(count)
+}
+
+// ReadInputRegisters reads the register in 'count' and returns its data. 'id' and 'start' are ignored.
+// For JBD, this is the same as ReadHoldingRegisters.
+func (j *JBD) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return j.readRegisters(count)
+}
+
+func (j *JBD) readRegisters(register uint8) ([]byte, error) {
+	_ = j.port.ResetInputBuffer()
+	if _, err := j.port.Write(buildJBDRequestFrame(register)); err != nil {
+		return nil, err
+	}
+	f, err := j.ReadResponse(register)
+	if err != nil {
+		return nil, err
+	}
+	return f[4 : len(f)-3], nil
+}
+
+// ReadResponse reads the response frame for 'register'.
+func (j *JBD) ReadResponse(register uint8) ([]byte, error) {
+	header := make([]byte, 4) // Start flag, register, status and data length.
+	if _, err := io.ReadFull(j.port, header); err != nil {
+		return nil, err
+	}
+	switch {
+	case header[0] != jbdStartFlag:
+		return nil, fmt.Errorf("wrong start flag: got 0x%02x, want 0x%02x", header[0], jbdStartFlag)
+	case header[1] != register:
+		return nil, fmt.Errorf("wrong register: got 0x%02x, want 0x%02x", header[1], register)
+	}
+	f := append(header, make([]byte, int(header[3])+3)...) // Data, checksum and end flag.
+	if _, err := io.ReadFull(j.port, f[4:]); err != nil {
+		return nil, err
+	}
+	if header[2] != jbdStatusOK {
+		return nil, fmt.Errorf("error status 0x%02x", header[2])
+	}
+	if f[len(f)-1] != jbdEndFlag {
+		return nil, fmt.Errorf("wrong end flag: got 0x%02x, want 0x%02x", f[len(f)-1], jbdEndFlag)
+	}
+	sum := jbdChecksum(f[2 : len(f)-3])
+	if want := binary.BigEndian.Uint16(f[len(f)-3:]); sum != want {
+		return nil, fmt.Errorf("checksum error: got %04X, want %04X", sum, want)
+	}
+	return f, nil
+}
+
+func jbdChecksum(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return ^sum + 1
+}
@@ -0,0 +1,105 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+func TestJBDRequest(t *testing.T) {
+	tests := []struct {
+		register uint8
+		req      string
+	}{
+		{
+			register: 0x03, // Basic information
+			req:      "dda50300fffd77",
+		},
+		{
+			register: 0x04, // Cell voltages
+			req:      "dda50400fffc77",
+		},
+	}
+	for tid, tt := range tests {
+		data := buildJBDRequestFrame(tt.register)
+		if got := hex.EncodeToString(data); got != tt.req {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.req)
+		}
+	}
+}
+
+func TestJBDResponse(t *testing.T) {
+	tests := []struct {
+		register uint8
+		resp     string
+		want     string // hex-encoded data
+		err      string
+	}{
+		{
+			register: 0x03,
+			resp:     "dd0300030102" + "03" + "fff7" + "77",
+			want:     "010203",
+		},
+		{
+			register: 0x04,
+			resp:     "dd0300030102" + "03" + "fff7" + "77",
+			err:      "wrong register: got 0x03, want 0x04",
+		},
+		{
+			register: 0x03,
+			resp:     "dd0300030102" + "03" + "fff8" + "77",
+			err:      "checksum error: got FFF7, want FFF8",
+		},
+		{
+			register: 0x03,
+			resp:     "dd0380000000" + "77",
+			err:      "error status 0x80",
+		},
+		{
+			register: 0x03,
+			resp:     "dd0300030102" + "03" + "fff7" + "78",
+			err:      "wrong end flag: got 0x78, want 0x77",
+		},
+	}
+	for tid, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test %d: %s", tid, tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		reader, _ := Reader(port, JBDProtocol, "")
+		if _, ok := reader.(*JBD); !ok {
+			t.Fatalf("wrong reader type: got %T want *JBD", reader)
+		}
+		data, err := reader.ReadHoldingRegisters(1, 0, tt.register)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("test %d got error %v; want %s", tid, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d got error %v", tid, err)
+		} else if got := hex.EncodeToString(data); got != tt.want {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.want)
+		}
+		if !bytes.Equal(req.Bytes(), buildJBDRequestFrame(tt.register)) {
+			t.Errorf("test %d sent '%s'", tid, hex.EncodeToString(req.Bytes()))
+		}
+	}
+}
+
+func TestJBDAutoProtocol(t *testing.T) {
+	port := common.NewTestPort(bytes.NewReader(nil), io.Discard, common.SerialDevice)
+	reader, err := Reader(port, AutoProtocol, "jbd")
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	if _, ok := reader.(*JBD); !ok {
+		t.Errorf("wrong reader type: got %T want *JBD", reader)
+	}
+}
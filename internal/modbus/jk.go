@@ -0,0 +1,107 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"wombatt/internal/common"
+)
+
+const (
+	jkStartFlag0     = 0x4e
+	jkStartFlag1     = 0x57
+	jkEndFlag        = 0x68
+	jkSourcePC       = 0x03
+	jkRequest        = 0x00
+	jkHeaderLength   = 11 // Start flag, length, terminal number, command, frame source and transport type.
+	jkTrailerLength  = 9  // Record number, end flag and checksum.
+	jkMaxFrameLength = 1024
+)
+
+// JK is the native protocol of the RS485 and UART ports of older JK BMS (JK-B and JK-BD series). It is NOT Modbus.
+// Frames have the 0x4E 0x57 start flag, a 16-bit length that counts all the bytes but the start flag,
+// a 4-byte terminal number, the command, the frame source, the transport type (0 for requests and 1
+// for responses), the data, a 4-byte record number, the 0x68 end flag and a 4-byte checksum whose low
+// 16 bits are the sum of all the previous bytes.
+// The terminal number is always 0, so the unit id is ignored.
+type JK struct {
+	port common.Port
+}
+
+func NewJK(port common.Port) RegisterReader {
+	return &JK{port: port}
+}
+
+// buildJKRequestFrame builds the request for 'command' with a single byte of data, which is
+// the data identification code for reads of a single item and 0 to read all the data.
+func buildJKRequestFrame(command, dataID uint8) []byte {
+	f := []byte{jkStartFlag0, jkStartFlag1, 0, 0, 0, 0, 0, 0, command, jkSourcePC, jkRequest, dataID, 0, 0, 0, 0, jkEndFlag, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(f[2:], uint16(len(f)-2))
+	binary.BigEndian.PutUint16(f[len(f)-2:], jkChecksum(f[:len(f)-4]))
+	return f
+}
+
+// ReadHoldingRegisters sends the command in 'count' with the data identification code in 'start'
+// and returns the data of the response. 'id' is ignored.
+// For JK, this is the same as ReadInputRegisters.
+func (j *JK) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return j.readRegisters(uint8(start), count)
+}
+
+// ReadInputRegisters sends the command in 'count' with the data identification code in 'start'
+// and returns the data of the response. 'id' is ignored.
+// For JK, this is the same as ReadHoldingRegisters.
+func (j *JK) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return j.readRegisters(uint8(start), count)
+}
+
+func (j *JK) readRegisters(dataID, command uint8) ([]byte, error) {
+	_ = j.port.ResetInputBuffer()
+	if _, err := j.port.Write(buildJKRequestFrame(command, dataID)); err != nil {
+		return nil, err
+	}
+	f, err := j.ReadResponse(command)
+	if err != nil {
+		return nil, err
+	}
+	return f[jkHeaderLength : len(f)-jkTrailerLength], nil
+}
+
+// ReadResponse reads the response frame for 'command'.
+func (j *JK) ReadResponse(command uint8) ([]byte, error) {
+	header := make([]byte, 4) // Start flag and length.
+	if _, err := io.ReadFull(j.port, header); err != nil {
+		return nil, err
+	}
+	if header[0] != jkStartFlag0 || header[1] != jkStartFlag1 {
+		return nil, fmt.Errorf("wrong start flag: got 0x%02x%02x, want 0x%02x%02x", header[0], header[1], jkStartFlag0, jkStartFlag1)
+	}
+	length := int(binary.BigEndian.Uint16(header[2:])) + 2
+	if length < jkHeaderLength+jkTrailerLength || length > jkMaxFrameLength {
+		return nil, fmt.Errorf("invalid frame length %d", length)
+	}
+	f := append(header, make([]byte, length-len(header))...)
+	if _, err := io.ReadFull(j.port, f[len(header):]); err != nil {
+		return nil, err
+	}
+	if f[len(f)-5] != jkEndFlag {
+		return nil, fmt.Errorf("wrong end flag: got 0x%02x, want 0x%02x", f[len(f)-5], jkEndFlag)
+	}
+	sum := jkChecksum(f[:len(f)-4])
+	if want := binary.BigEndian.Uint16(f[len(f)-2:]); sum != want {
+		return nil, fmt.Errorf("checksum error: got %04X, want %04X", sum, want)
+	}
+	if f[8] != command {
+		return nil, fmt.Errorf("wrong command: got 0x%02x, want 0x%02x", f[8], command)
+	}
+	return f, nil
+}
+
+func jkChecksum(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return sum
+}
@@ -0,0 +1,100 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+func TestJKRequest(t *testing.T) {
+	tests := []struct {
+		command uint8
+		dataID  uint8
+		req     string
+	}{
+		{
+			command: 0x06, // Read all the data
+			req:     "4e5700130000000006030000000000006800000129",
+		},
+		{
+			command: 0x03, // Read the total voltage
+			dataID:  0x83,
+			req:     "4e57001300000000030300830000000068000001a9",
+		},
+	}
+	for tid, tt := range tests {
+		data := buildJKRequestFrame(tt.command, tt.dataID)
+		if got := hex.EncodeToString(data); got != tt.req {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.req)
+		}
+	}
+}
+
+func TestJKResponse(t *testing.T) {
+	tests := []struct {
+		command uint8
+		resp    string
+		want    string // hex-encoded data
+		err     string
+	}{
+		{
+			command: 0x06,
+			resp:    "4e57001500000000060001" + "831450" + "00000000" + "68" + "00000210",
+			want:    "831450",
+		},
+		{
+			command: 0x03,
+			resp:    "4e57001500000000060001" + "831450" + "00000000" + "68" + "00000210",
+			err:     "wrong command: got 0x06, want 0x03",
+		},
+		{
+			command: 0x06,
+			resp:    "4e57001500000000060001" + "831450" + "00000000" + "68" + "00000211",
+			err:     "checksum error: got 0210, want 0211",
+		},
+		{
+			command: 0x06,
+			resp:    "4e57001500000000060001" + "831450" + "00000000" + "69" + "00000211",
+			err:     "wrong end flag: got 0x69, want 0x68",
+		},
+		{
+			command: 0x06,
+			resp:    "4e560015",
+			err:     "wrong start flag: got 0x4e56, want 0x4e57",
+		},
+		{
+			command: 0x06,
+			resp:    "4e570002",
+			err:     "invalid frame length 4",
+		},
+	}
+	for tid, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test %d: %s", tid, tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		reader, _ := Reader(port, JKProtocol, "")
+		if _, ok := reader.(*JK); !ok {
+			t.Fatalf("wrong reader type: got %T want *JK", reader)
+		}
+		data, err := reader.ReadHoldingRegisters(1, 0, tt.command)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("test %d got error %v; want %s", tid, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d got error %v", tid, err)
+		} else if got := hex.EncodeToString(data); got != tt.want {
+			t.Errorf("test %d got '%s'; want '%s'", tid, got, tt.want)
+		}
+		if !bytes.Equal(req.Bytes(), buildJKRequestFrame(tt.command, 0)) {
+			t.Errorf("test %d sent '%s'", tid, hex.EncodeToString(req.Bytes()))
+		}
+	}
+}
@@ -6,30 +6,73 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"wombatt/internal/common"
 )
 
+// LFP4Options has the settings of the protocols that use the LFP4 framing.
+type LFP4Options struct {
+	Version uint8 // VER
+	CID1    uint8 // Device type
+	// AddressInfoCommands has the commands (CID2) whose requests send the ADR as the INFO.
+	// The requests for other commands have an empty INFO.
+	AddressInfoCommands []uint8
+}
+
+var (
+	// Lifepower4Options are the settings of the lifepower4 protocol.
+	Lifepower4Options = LFP4Options{Version: 0x20, CID1: 0x4a} // BMS/LiFePO4 battery BMS
+	// lithiumIronOptions are the settings of seplosv2 and pylontech, whose analog value (0x42) and
+	// alarm info (0x44) requests have the address of the pack or module as the INFO.
+	lithiumIronOptions = LFP4Options{Version: 0x20, CID1: 0x46, AddressInfoCommands: []uint8{0x42, 0x44}}
+)
+
 // LFP4 comms is described in https://eg4electronics.com/backend/wp-content/uploads/2023/04/EG4_LifePower4_Communication_Protocol.pdf
 // It is NOT Modbus.
 type LFP4 struct {
 	port common.Port
+	opts LFP4Options
 }
 
 func NewLFP4(port common.Port) RegisterReader {
-	return &LFP4{port: port}
+	return NewLFP4WithOptions(port, Lifepower4Options)
+}
+
+// NewLFP4WithOptions returns the reader for a protocol with the same framing as LFP4, and the VER,
+// CID1 and INFO of the requests in 'opts'.
+func NewLFP4WithOptions(port common.Port, opts LFP4Options) RegisterReader {
+	return &LFP4{port: port, opts: opts}
+}
+
+// NewSeplosV2 returns the reader for the v2 protocol of Seplos BMS. It has the same framing as LFP4,
+// with a different CID1 and the address of the pack in the requests.
+func NewSeplosV2(port common.Port) RegisterReader {
+	return NewLFP4WithOptions(port, lithiumIronOptions)
 }
 
-func buildReadRequestLFP4Frame(id uint8, cid2 uint8) []byte {
+// NewPylontech returns the reader for the RS485 protocol of Pylontech batteries. It has the same
+// framing as LFP4, with a different CID1 and the address of the module in the requests.
+func NewPylontech(port common.Port) RegisterReader {
+	return NewLFP4WithOptions(port, lithiumIronOptions)
+}
+
+func buildReadRequestLFP4Frame(opts LFP4Options, id uint8, cid2 uint8) []byte {
+	var ascii string
+	if slices.Contains(opts.AddressInfoCommands, cid2) {
+		ascii = fmt.Sprintf("%02X", id)
+	}
 	var b bytes.Buffer
-	b.WriteByte(0x7e)                                           // SOI
-	b.WriteString("20")                                         // VER
-	b.WriteString(fmt.Sprintf("%02X", id))                      // ADR
-	b.WriteString("4A")                                         // CID1 = BMS/LiFePO4 battery BMS
-	b.WriteString(fmt.Sprintf("%02X", cid2))                    // CID2
-	b.WriteString("0000")                                       // LENGTH
-	b.WriteString(fmt.Sprintf("%04X", lfp4Checksum(b.Bytes()))) // CHKSUM
-	b.WriteByte(0x0d)                                           // EOI
+	b.WriteByte(0x7e)                                                  // SOI
+	b.WriteString(fmt.Sprintf("%02X", opts.Version))                   // VER
+	b.WriteString(fmt.Sprintf("%02X", id))                             // ADR
+	b.WriteString(fmt.Sprintf("%02X", opts.CID1))                      // CID1
+	b.WriteString(fmt.Sprintf("%02X", cid2))                           // CID2
+	b.WriteString(fmt.Sprintf("%04X", lengthWithChecksum(len(ascii)))) // LENGTH
+	b.WriteString(ascii)                                               // INFO
+	b.WriteString(fmt.Sprintf("%04X", lfp4Checksum(b.Bytes())))        // CHKSUM
+	b.WriteByte(0x0d)                                                  // EOI
 	return b.Bytes()
 }
 
@@ -48,7 +91,7 @@ func (r *LFP4) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte,
 // ReadRegisters sends the cid2 command to unit id and returns the response.
 func (t *LFP4) readRegisters(id uint8, _ uint16, cid2 uint8) ([]byte, error) {
 	_ = t.port.ResetInputBuffer()
-	f := buildReadRequestLFP4Frame(id, cid2)
+	f := buildReadRequestLFP4Frame(t.opts, id, cid2)
 	if _, err := t.port.Write(f); err != nil {
 		return nil, err
 	}
@@ -108,6 +151,56 @@ func (t *LFP4) readHeader() ([]byte, uint16, error) {
 	return header, length, nil
 }
 
+// ReadLFP4Request reads a request frame from 'r'. It returns the ADR and CID2 fields, and the INFO
+// data decoded from ASCII.
+func ReadLFP4Request(r io.Reader) (id uint8, cid2 uint8, info []byte, err error) {
+	frame := make([]byte, 13) // Same header layout as responses, with CID2 instead of RTN.
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, 0, nil, err
+	}
+	if frame[0] != 0x7e {
+		return 0, 0, nil, fmt.Errorf("wrong SOI: got 0x%02x, want 0x7e", frame[0])
+	}
+	fields, err := hex.DecodeString(string(frame[1:13])) // VER, ADR, CID1, CID2 and LENGTH
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error decoding header '%s'", frame[1:13])
+	}
+	length := uint16(fields[4])<<8 | uint16(fields[5])
+	if err := checkLengthChecksum(length); err != nil {
+		return 0, 0, nil, err
+	}
+	length &= 0x0fff
+	frame = append(frame, make([]byte, int(length)+5)...) // INFO, CHKSUM and EOI
+	if _, err := io.ReadFull(r, frame[13:]); err != nil {
+		return 0, 0, nil, err
+	}
+	if err := verifyChecksum(frame); err != nil {
+		return 0, 0, nil, err
+	}
+	info, err = hex.DecodeString(string(frame[13 : 13+length]))
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error decoding ascii data: %w", err)
+	}
+	return fields[1], fields[3], info, nil
+}
+
+// BuildLFP4Response returns the response frame from unit 'id' with the VER and CID1 in 'opts', the
+// return code 'rtn' and 'info' as the INFO data.
+func BuildLFP4Response(opts LFP4Options, id uint8, rtn LFP4ReturnCode, info []byte) []byte {
+	ascii := strings.ToUpper(hex.EncodeToString(info))
+	var b bytes.Buffer
+	b.WriteByte(0x7e)                                                  // SOI
+	b.WriteString(fmt.Sprintf("%02X", opts.Version))                   // VER
+	b.WriteString(fmt.Sprintf("%02X", id))                             // ADR
+	b.WriteString(fmt.Sprintf("%02X", opts.CID1))                      // CID1
+	b.WriteString(fmt.Sprintf("%02X", uint8(rtn)))                     // RTN
+	b.WriteString(fmt.Sprintf("%04X", lengthWithChecksum(len(ascii)))) // LENGTH
+	b.WriteString(ascii)                                               // INFO
+	b.WriteString(fmt.Sprintf("%04X", lfp4Checksum(b.Bytes())))        // CHKSUM
+	b.WriteByte(0x0d)                                                  // EOI
+	return b.Bytes()
+}
+
 func verifyChecksum(b []byte) error {
 	targetCRC, err := asciiToBin(b[len(b)-5 : len(b)-1])
 	if err != nil {
@@ -142,6 +235,14 @@ func checkLengthChecksum(length uint16) error {
 	return nil
 }
 
+// lengthWithChecksum returns the LENGTH field for an INFO of 'length' ASCII characters, with
+// the LCHKSUM in the upper 4 bits.
+func lengthWithChecksum(length int) uint16 {
+	l := uint16(length) & 0x0fff
+	sum := (l >> 8) + (l>>4)&0xf + l&0xf
+	return ((^sum+1)&0xf)<<12 | l
+}
+
 func asciiToBin(ascii []byte) (int, error) {
 	b := make([]byte, hex.DecodedLen(len(ascii)))
 	if _, err := hex.Decode(b, ascii); err != nil {
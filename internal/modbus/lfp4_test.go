@@ -33,13 +33,67 @@ func TestLFP4Request(t *testing.T) {
 		if err != nil {
 			t.Fatalf("malformed request string in test %d: %s", tid, tt.req)
 		}
-		data := buildReadRequestLFP4Frame(tt.id, tt.cid2)
+		data := buildReadRequestLFP4Frame(Lifepower4Options, tt.id, tt.cid2)
 		if !bytes.Equal(data, req) {
 			t.Errorf("test %d got '%s'; want '%s'", tid, hex.EncodeToString(data), tt.req)
 		}
 	}
 }
 
+// TestLFP4OptionsRequest tests the requests of the protocols with the LFP4 framing and other VER, CID1
+// or INFO.
+func TestLFP4OptionsRequest(t *testing.T) {
+	tests := []struct {
+		newReader func(common.Port) RegisterReader
+		id        uint8
+		cid2      uint8
+		req       string
+	}{
+		{
+			newReader: NewSeplosV2,
+			id:        0,
+			cid2:      0x42,
+			req:       "~20004642E00200FD37\r",
+		},
+		{
+			newReader: NewSeplosV2,
+			id:        0,
+			cid2:      0x44,
+			req:       "~20004644E00200FD35\r",
+		},
+		{
+			newReader: NewPylontech,
+			id:        2,
+			cid2:      0x42,
+			req:       "~20024642E00202FD33\r",
+		},
+		{
+			newReader: NewPylontech,
+			id:        2,
+			cid2:      0x47, // System parameters, with no INFO.
+			req:       "~200246470000FDA7\r",
+		},
+		{
+			newReader: func(port common.Port) RegisterReader {
+				return NewLFP4WithOptions(port, LFP4Options{Version: 0x25, CID1: 0x46, AddressInfoCommands: []uint8{0x42}})
+			},
+			id:   2,
+			cid2: 0x42,
+			req:  "~25024642E00202FD2E\r",
+		},
+	}
+	for tid, tt := range tests {
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(nil), &req, 0)
+		if _, err := tt.newReader(port).ReadHoldingRegisters(tt.id, 0, tt.cid2); err == nil {
+			t.Errorf("test %d got no error reading from an empty port", tid)
+		}
+		if got := req.String(); got != tt.req {
+			t.Errorf("test %d got request %q; want %q", tid, got, tt.req)
+		}
+	}
+}
+
 // test data from examples in https://eg4electronics.com/backend/wp-content/uploads/2023/04/EG4_LifePower4_Communication_Protocol.pdf
 // TestLFP4Response tests the raw response contents before being processed by ReadHoldingRegisters.
 func TestLFP4Response(t *testing.T) {
@@ -141,3 +195,30 @@ func TestLFP4ReadHoldingRegisters(t *testing.T) {
 		}
 	}
 }
+
+// TestLFP4Server tests reading requests and building responses, using the same examples as above.
+func TestLFP4Server(t *testing.T) {
+	req, _ := hex.DecodeString("7e323030313441343430303030464441300d")
+	id, cid2, info, err := ReadLFP4Request(bytes.NewReader(req))
+	if err != nil || id != 1 || cid2 != 0x44 || len(info) != 0 {
+		t.Errorf("wrong request: got id %d, cid2 0x%02x, info %x, error %v", id, cid2, info, err)
+	}
+	req[len(req)-2] = '1'
+	if _, _, _, err := ReadLFP4Request(bytes.NewReader(req)); err == nil {
+		t.Errorf("CHKSUM error not detected")
+	}
+
+	want := "7e323030313441303037303534303130313130303030303030303030303030303030303030303030303030303030303030303030343030303030303030303030303030303030393030303030303030303030313033303030303030303030303030454443340d"
+	info, _ = hex.DecodeString("010110000000000000000000000000000000000400000000000000000900000000000103000000000000")
+	if got := hex.EncodeToString(BuildLFP4Response(Lifepower4Options, 1, Normal, info)); got != want {
+		t.Errorf("wrong response: got\n'%s'; want\n'%s'", got, want)
+	}
+	want = "7e323030313441303430303030464441340d"
+	if got := hex.EncodeToString(BuildLFP4Response(Lifepower4Options, 1, InvalidCID2, nil)); got != want {
+		t.Errorf("wrong error response: got '%s'; want '%s'", got, want)
+	}
+	want = "~200246040000FDAE\r"
+	if got := string(BuildLFP4Response(lithiumIronOptions, 2, InvalidCID2, nil)); got != want {
+		t.Errorf("wrong error response: got %q; want %q", got, want)
+	}
+}
@@ -1,22 +1,37 @@
 package modbus
 
 // Package modbus provides Modbus communication interfaces and implementations.
-// It supports different Modbus protocols (RTU, TCP, Lifepower4) and provides a factory
-// function to create appropriate Modbus readers.
+// It supports different Modbus protocols (RTU, TCP, RTU over TCP, ASCII) and the protocols of some BMS
+// that are not Modbus (Lifepower4, Daly, Seplos v2, Pylontech, JBD, JK), and provides a factory function to create appropriate Modbus readers.
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strings"
 
 	"wombatt/internal/common"
 )
 
 const (
+	AutoProtocol       = "auto"
 	RTUProtocol        = "ModbusRTU"
 	TCPProtocol        = "ModbusTCP"
+	RTUoverTCPProtocol = "ModbusRTUoverTCP"
+	ASCIIProtocol      = "ModbusASCII"
 	Lifepower4Protocol = "lifepower4"
+	DalyProtocol       = "daly"
+	SeplosV2Protocol   = "seplosv2"
+	PylontechProtocol  = "pylontech"
+	JBDProtocol        = "jbd"
+	JKProtocol         = "jk"
 )
 
 // RegisterReader defines the interface for reading Modbus registers.
+// The readers of the protocols that are not Modbus reuse 'start' and 'count' for their requests:
+// 'count' is the command (CID2 for lifepower4, seplosv2 and pylontech; the data ID for Daly; the
+// register for JBD; the command for JK), and 'start' is the number of response frames for Daly or
+// the data identification code for JK. It is ignored by the others.
 type RegisterReader interface {
 	// ReadHoldingRegisters reads a block of holding registers from a Modbus device.
 	// It takes the device ID, starting address, and number of registers to read.
@@ -26,19 +41,62 @@ type RegisterReader interface {
 	ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error)
 }
 
+// BitReader defines the interface for reading Modbus coils and discrete inputs.
+type BitReader interface {
+	// ReadCoils reads a block of coils from a Modbus device.
+	// It takes the device ID, starting address, and number of coils to read.
+	ReadCoils(id uint8, start uint16, count uint16) ([]bool, error)
+	// ReadDiscreteInputs reads a block of discrete inputs from a Modbus device.
+	// It takes the device ID, starting address, and number of inputs to read.
+	ReadDiscreteInputs(id uint8, start uint16, count uint16) ([]bool, error)
+}
+
+// RegisterWriter defines the interface for writing Modbus coils and registers.
+type RegisterWriter interface {
+	// WriteSingleCoil turns the coil at 'address' on or off.
+	WriteSingleCoil(id uint8, address uint16, value bool) error
+	// WriteSingleRegister writes 'value' to the holding register at 'address'.
+	WriteSingleRegister(id uint8, address uint16, value uint16) error
+	// WriteMultipleCoils writes a block of coils starting at the 'start' address.
+	WriteMultipleCoils(id uint8, start uint16, values []bool) error
+	// WriteMultipleRegisters writes a block of holding registers starting at the 'start' address.
+	WriteMultipleRegisters(id uint8, start uint16, values []uint16) error
+}
+
 // Reader creates and returns a new Modbus RegisterReader based on the specified protocol and BMS type.
-// It attempts to auto-detect the protocol if "auto" is provided.
+// It attempts to auto-detect the protocol if "auto" is provided. For TCP devices, the framing
+// (Modbus TCP or RTU over TCP) is probed with the first request.
+// A protocol in the address the port was opened with takes precedence over 'protocol', unless it is auto.
 func Reader(port common.Port, protocol, bmsType string) (RegisterReader, error) {
+	if p := protocolFromAddress(common.PortProtocol(port)); p != "" && p != AutoProtocol {
+		protocol = p
+	}
+	return newReader(port, protocol, bmsType)
+}
+
+func newReader(port common.Port, protocol, bmsType string) (RegisterReader, error) {
 	switch protocol {
-	case "auto":
-		if bmsType == "lifepower4" {
+	case AutoProtocol:
+		switch bmsType {
+		case "lifepower4":
 			return NewLFP4(port), nil
+		case "daly":
+			return NewDaly(port), nil
+		case "seplosv2":
+			return NewSeplosV2(port), nil
+		case "pylontech":
+			return NewPylontech(port), nil
+		case "jbd":
+			return NewJBD(port), nil
 		}
 		switch port.Type() {
-		case common.SerialDevice, common.HidRawDevice:
+		case common.SerialDevice, common.HidRawDevice, common.ReplayDevice, common.PTYDevice, common.RFC2217Device:
 			return NewRTU(port), nil
-		case common.TCPDevice:
-			return NewTCP(port), nil
+		case common.TCPDevice, common.UDPDevice:
+			if detected, ok := detectedFraming.Load(framingKey(port)); ok {
+				return newReader(port, detected.(string), bmsType)
+			}
+			return newTCPProbe(port), nil
 		default:
 			return nil, fmt.Errorf("unable to guess a protocol for %v/%v - %v", protocol, bmsType, port.Type())
 		}
@@ -46,9 +104,86 @@ func Reader(port common.Port, protocol, bmsType string) (RegisterReader, error)
 		return NewRTU(port), nil
 	case TCPProtocol:
 		return NewTCP(port), nil
+	case RTUoverTCPProtocol:
+		return NewRTUoverTCP(port), nil
+	case ASCIIProtocol:
+		return NewASCII(port), nil
 	case Lifepower4Protocol:
 		return NewLFP4(port), nil
+	case DalyProtocol:
+		return NewDaly(port), nil
+	case SeplosV2Protocol:
+		return NewSeplosV2(port), nil
+	case PylontechProtocol:
+		return NewPylontech(port), nil
+	case JBDProtocol:
+		return NewJBD(port), nil
+	case JKProtocol:
+		return NewJK(port), nil
 	default:
 		return nil, fmt.Errorf("unknown protocol: %v", protocol)
 	}
 }
+
+// IsModbusProtocol returns true if 'protocol' is one of the Modbus framings. The other protocols
+// reuse the start address and count of the reads for their commands.
+func IsModbusProtocol(protocol string) bool {
+	switch protocol {
+	case RTUProtocol, TCPProtocol, RTUoverTCPProtocol, ASCIIProtocol:
+		return true
+	default:
+		return false
+	}
+}
+
+// protocolAliases has the short protocol names that can be used in addresses.
+var protocolAliases = map[string]string{
+	"rtu":        RTUProtocol,
+	"tcp":        TCPProtocol,
+	"rtuovertcp": RTUoverTCPProtocol,
+	"ascii":      ASCIIProtocol,
+}
+
+// protocolFromAddress returns the protocol for the name used in an address, which can be a short
+// name or any protocol name in any case.
+func protocolFromAddress(name string) string {
+	name = strings.ToLower(name)
+	if protocol, ok := protocolAliases[name]; ok {
+		return protocol
+	}
+	for _, protocol := range []string{AutoProtocol, RTUProtocol, TCPProtocol, RTUoverTCPProtocol, ASCIIProtocol, Lifepower4Protocol, DalyProtocol, SeplosV2Protocol, PylontechProtocol, JBDProtocol, JKProtocol} {
+		if strings.ToLower(protocol) == name {
+			return protocol
+		}
+	}
+	return name
+}
+
+// Writer creates and returns a new Modbus RegisterWriter based on the specified protocol.
+// Only the Modbus protocols support writing.
+func Writer(port common.Port, protocol string) (RegisterWriter, error) {
+	reader, err := Reader(port, protocol, "")
+	if err != nil {
+		return nil, err
+	}
+	writer, ok := reader.(RegisterWriter)
+	if !ok {
+		return nil, fmt.Errorf("protocol %v does not support writing", protocol)
+	}
+	return writer, nil
+}
+
+// frameReader returns the reader for the next frame from 'port'. UDP devices send each frame in
+// a datagram, so the whole datagram is read at once. Short frames are then reported as such instead
+// of being completed with the next datagram.
+func frameReader(port io.Reader) (io.Reader, error) {
+	if p, ok := port.(common.Port); !ok || p.Type() != common.UDPDevice {
+		return port, nil
+	}
+	b := make([]byte, common.MaxDatagramSize)
+	n, err := port.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b[:n]), nil
+}
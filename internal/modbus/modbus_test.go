@@ -1,9 +1,12 @@
 package modbus
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"testing"
+	"time"
 
 	"wombatt/internal/common"
 )
@@ -24,6 +27,14 @@ func TestReader(t *testing.T) {
 			protocol:       "ModbusTCP",
 			readerTypeName: "*modbus.TCP",
 		},
+		{
+			protocol:       "ModbusRTUoverTCP",
+			readerTypeName: "*modbus.RTUoverTCP",
+		},
+		{
+			protocol:       "ModbusASCII",
+			readerTypeName: "*modbus.ASCII",
+		},
 		{
 			protocol:       "lifepower4",
 			readerTypeName: "*modbus.LFP4",
@@ -41,7 +52,7 @@ func TestReader(t *testing.T) {
 		{
 			protocol:       "auto",
 			deviceType:     common.TCPDevice,
-			readerTypeName: "*modbus.TCP",
+			readerTypeName: "*modbus.tcpProbe",
 		},
 		{
 			protocol:       "auto",
@@ -91,3 +102,105 @@ func TestReader(t *testing.T) {
 		}
 	}
 }
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		protocol       string
+		writerTypeName string
+		mustFail       bool
+	}{
+		{protocol: "ModbusRTU", writerTypeName: "*modbus.RTU"},
+		{protocol: "ModbusTCP", writerTypeName: "*modbus.TCP"},
+		{protocol: "ModbusRTUoverTCP", writerTypeName: "*modbus.RTUoverTCP"},
+		{protocol: "ModbusASCII", writerTypeName: "*modbus.ASCII"},
+		{protocol: "lifepower4", mustFail: true},
+		{protocol: "whatever", mustFail: true},
+	}
+	for tid, tt := range tests {
+		port := common.NewTestPort(nil, io.Discard, 0)
+		w, err := Writer(port, tt.protocol)
+		if err == nil && tt.mustFail {
+			t.Errorf("error (#%d): got no error, expecting an error", tid)
+			continue
+		}
+		if err != nil {
+			if !tt.mustFail {
+				t.Errorf("error (#%d): got error %q, expecting no error", tid, err)
+			}
+			continue
+		}
+		if wtype := fmt.Sprintf("%T", w); wtype != tt.writerTypeName {
+			t.Errorf("error(#%d): got %v; want %v", tid, wtype, tt.writerTypeName)
+		}
+	}
+}
+
+func TestReaderAddressProtocol(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+	for _, tt := range []struct{ proto, readerTypeName string }{
+		{"rtuovertcp", "*modbus.RTUoverTCP"},
+		{"ModbusTCP", "*modbus.TCP"},
+		{"auto", "*modbus.RTU"}, // auto keeps the protocol of the command.
+	} {
+		port, err := common.OpenPort(&common.PortOptions{Address: "tcp://" + l.Addr().String() + "?proto=" + tt.proto, Type: common.SerialDevice})
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		// The protocol in the address takes precedence.
+		r, err := Reader(port, RTUProtocol, "")
+		if err != nil {
+			t.Errorf("%s: got error %v", tt.proto, err)
+		} else if rtype := fmt.Sprintf("%T", r); rtype != tt.readerTypeName {
+			t.Errorf("%s: got %v; want %v", tt.proto, rtype, tt.readerTypeName)
+		}
+		port.Close()
+	}
+}
+
+// TestReaderAddressAutoProtocol reads from a port opened with proto=auto, which probes the framing.
+func TestReaderAddressAutoProtocol(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req := make([]byte, 12)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		// Modbus TCP response with the same transaction ID.
+		resp, _ := hex.DecodeString("00000000000711030400010002")
+		copy(resp, req[:2])
+		_, _ = conn.Write(resp)
+	}()
+
+	port, err := common.OpenPort(&common.PortOptions{Address: "tcp://" + l.Addr().String() + "?proto=auto", ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer port.Close()
+	r, err := Reader(port, AutoProtocol, "")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if rtype := fmt.Sprintf("%T", r); rtype != "*modbus.tcpProbe" {
+		t.Errorf("got %v; want *modbus.tcpProbe", rtype)
+	}
+	data, err := r.ReadHoldingRegisters(0x11, 0, 2)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got, want := hex.EncodeToString(data), "00010002"; got != want {
+		t.Errorf("wrong data: got %s; want %s", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package modbus
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -55,6 +56,14 @@ const (
 
 	// MaxRTUFrameLength is the maximum length of an RTU frame.
 	MaxRTUFrameLength = 256
+	// MaxReadRegisters is the maximum number of registers in a read request.
+	MaxReadRegisters = 125
+	// MaxWriteRegisters is the maximum number of registers in a WriteMultipleRegisters request.
+	MaxWriteRegisters = 123
+	// MaxWriteCoils is the maximum number of coils in a WriteMultipleCoil request.
+	MaxWriteCoils = 1968
+	// MaxReadBits is the maximum number of coils or discrete inputs in a read request.
+	MaxReadBits = 2000
 )
 
 var protocolErrorMap = map[RTUProtocolError]string{
@@ -93,6 +102,101 @@ func buildReadRequestRTUFrame(id uint8, function RTUFunction, address uint16, le
 	return b.Bytes()
 }
 
+// buildRTUFrame builds a request with the given ID, function code and data, and appends the CRC.
+func buildRTUFrame(id uint8, function RTUFunction, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(id)
+	b.WriteByte(byte(function))
+	b.Write(data)
+	checksum := CRC(b.Bytes())
+	b.WriteByte(uint8(checksum & uint16(0xff)))
+	b.WriteByte(uint8((checksum & uint16(0xff00) >> 8)))
+	return b.Bytes()
+}
+
+// writeSingleData returns the data for a WriteSingleCoil or WriteSingleRegister request.
+func writeSingleData(address uint16, value uint16) []byte {
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, address), value)
+}
+
+// coilValue returns the value used in WriteSingleCoil requests to turn a coil on or off.
+func coilValue(on bool) uint16 {
+	if on {
+		return 0xff00
+	}
+	return 0x0000
+}
+
+// writeMultipleRegistersData returns the data for a WriteMultipleRegisters request.
+func writeMultipleRegistersData(start uint16, values []uint16) ([]byte, error) {
+	if len(values) == 0 || len(values) > MaxWriteRegisters {
+		return nil, fmt.Errorf("invalid number of registers to write: got %d, want 1 to %d", len(values), MaxWriteRegisters)
+	}
+	b := binary.BigEndian.AppendUint16(nil, start)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(values)))
+	b = append(b, uint8(len(values)*2))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b, nil
+}
+
+// writeMultipleCoilsData returns the data for a WriteMultipleCoil request.
+func writeMultipleCoilsData(start uint16, values []bool) ([]byte, error) {
+	if len(values) == 0 || len(values) > MaxWriteCoils {
+		return nil, fmt.Errorf("invalid number of coils to write: got %d, want 1 to %d", len(values), MaxWriteCoils)
+	}
+	packed := packCoils(values)
+	b := binary.BigEndian.AppendUint16(nil, start)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(values)))
+	b = append(b, uint8(len(packed)))
+	return append(b, packed...), nil
+}
+
+// packCoils packs the coil values into bytes, with the first coil in the least significant bit.
+func packCoils(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// unpackBits returns the first 'count' bits from the data in a ReadCoils or ReadDiscreteInputs
+// response, with the first bit in the least significant bit of the first byte.
+func unpackBits(data []byte, count uint16) ([]bool, error) {
+	if want := (int(count) + 7) / 8; len(data) != want {
+		return nil, fmt.Errorf("unexpected data length: got %d, want %d", len(data), want)
+	}
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = data[i/8]&(1<<(i%8)) != 0
+	}
+	return bits, nil
+}
+
+// checkBitCount returns an error if 'count' is not valid for a coils or discrete inputs read request.
+func checkBitCount(count uint16) error {
+	if count == 0 || count > MaxReadBits {
+		return fmt.Errorf("invalid number of bits to read: got %d, want 1 to %d", count, MaxReadBits)
+	}
+	return nil
+}
+
+// checkWriteResponse verifies that a response to a write request echoes the function code,
+// the address and the value or quantity from the request. Both arguments are entire frames.
+func checkWriteResponse(req, resp []byte) error {
+	if len(resp) < 8 {
+		return fmt.Errorf("short write response: got %d, want 8 bytes", len(resp))
+	}
+	if !bytes.Equal(req[1:6], resp[1:6]) {
+		return fmt.Errorf("unexpected write response: got %s, want %s", hex.EncodeToString(resp[1:6]), hex.EncodeToString(req[1:6]))
+	}
+	return nil
+}
+
 // ID returns the client ID of the RTUFrame.
 func (f *RTUFrame) ID() uint8 {
 	return f.rawData[0]
@@ -122,6 +226,10 @@ func (f *RTUFrame) CRC() uint16 {
 //
 // The frame returned will be nil in case of an error, except for protocol and/or CRC errors.
 func readRTUResponse(port io.Reader) (*RTUFrame, error) {
+	port, err := frameReader(port)
+	if err != nil {
+		return nil, err
+	}
 	b := make([]byte, MaxRTUFrameLength)
 	if n, err := io.ReadFull(port, b[0:3]); err != nil {
 		if err == io.ErrUnexpectedEOF {
@@ -147,9 +255,8 @@ func readRTUResponse(port io.Reader) (*RTUFrame, error) {
 	frame := NewRTUFrame(b[0 : 3+pending])
 
 	// CRC error or protocol error also return the frame.
-	var err error
 	if (b[1] & 0x80) == 0x80 {
-		err = protocolError(b[1])
+		err = protocolError(b[2])
 	}
 	if checksum != frame.CRC() {
 		if err == nil {
@@ -188,7 +295,8 @@ func readRTURequest(port io.Reader) (*RTUFrame, error) {
 		}
 		return nil, err
 	}
-	pending := expectedRequestLength(RTUFunction(b[1]), uint16(b[5])*256+uint16(b[6]))
+	// For WriteMultipleCoil and WriteMultipleRegisters, the byte count is at byte 6.
+	pending := expectedRequestLength(RTUFunction(b[1]), uint16(b[6]))
 	if pending == -1 {
 		return nil, fmt.Errorf("invalid function code: %02x\n", b[1])
 	}
@@ -241,6 +349,77 @@ func (r *RTU) readRegisters(id uint8, functionCode RTUFunction, start uint16, co
 	return frame.Data(), nil
 }
 
+// ReadCoils requests 'count' coils from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (r *RTU) ReadCoils(id uint8, start uint16, count uint16) ([]bool, error) {
+	return r.readBits(id, ReadCoils, start, count)
+}
+
+// ReadDiscreteInputs requests 'count' discrete inputs from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (r *RTU) ReadDiscreteInputs(id uint8, start uint16, count uint16) ([]bool, error) {
+	return r.readBits(id, ReadDiscreteInputs, start, count)
+}
+
+func (r *RTU) readBits(id uint8, functionCode RTUFunction, start uint16, count uint16) ([]bool, error) {
+	if err := checkBitCount(count); err != nil {
+		return nil, err
+	}
+	_ = r.port.ResetInputBuffer()
+	f := buildReadRequestRTUFrame(id, functionCode, start, count)
+	if _, err := r.port.Write(f); err != nil {
+		return nil, err
+	}
+	frame, err := readRTUResponse(r.port)
+	if err != nil {
+		return nil, err
+	}
+	return unpackBits(frame.Data(), count)
+}
+
+// WriteSingleCoil turns the coil at 'address' in unit 'id' on or off and verifies the response.
+func (r *RTU) WriteSingleCoil(id uint8, address uint16, value bool) error {
+	return r.write(id, WriteSingleCoil, writeSingleData(address, coilValue(value)))
+}
+
+// WriteSingleRegister writes 'value' to the register at 'address' in unit 'id' and verifies the response.
+func (r *RTU) WriteSingleRegister(id uint8, address uint16, value uint16) error {
+	return r.write(id, WriteSingleRegister, writeSingleData(address, value))
+}
+
+// WriteMultipleCoils writes 'values' to the coils in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (r *RTU) WriteMultipleCoils(id uint8, start uint16, values []bool) error {
+	data, err := writeMultipleCoilsData(start, values)
+	if err != nil {
+		return err
+	}
+	return r.write(id, WriteMultipleCoil, data)
+}
+
+// WriteMultipleRegisters writes 'values' to the registers in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (r *RTU) WriteMultipleRegisters(id uint8, start uint16, values []uint16) error {
+	data, err := writeMultipleRegistersData(start, values)
+	if err != nil {
+		return err
+	}
+	return r.write(id, WriteMultipleRegisters, data)
+}
+
+func (r *RTU) write(id uint8, functionCode RTUFunction, data []byte) error {
+	_ = r.port.ResetInputBuffer()
+	f := buildRTUFrame(id, functionCode, data)
+	if _, err := r.port.Write(f); err != nil {
+		return err
+	}
+	frame, err := readRTUResponse(r.port)
+	if err != nil {
+		return err
+	}
+	return checkWriteResponse(f, frame.RawData())
+}
+
 func expectedResponseLength(functionCode RTUFunction, receivedLength uint8) int {
 	switch functionCode {
 	case ReadCoils, ReadInputRegisters, ReadHoldingRegisters, ReadDiscreteInputs:
@@ -254,7 +433,7 @@ func expectedResponseLength(functionCode RTUFunction, receivedLength uint8) int
 			switch f {
 			case ReadCoils, ReadInputRegisters, ReadHoldingRegisters, ReadDiscreteInputs, WriteSingleCoil,
 				WriteSingleRegister, WriteMultipleCoil, WriteMultipleRegisters:
-				return 1 // 1 byte in the response data contains the error code.
+				return 0 // The error code is the only byte after the function code.
 			}
 		}
 		return -1
@@ -272,9 +451,14 @@ func expectedRequestLength(functionCode RTUFunction, count uint16) int {
 	return -1
 }
 
-func protocolError(code uint8) error {
-	if s, ok := protocolErrorMap[RTUProtocolError(0x7f&code)]; ok {
-		return fmt.Errorf("protocol error: %s", s)
+// Error returns the description of the exception code.
+func (e RTUProtocolError) Error() string {
+	if s, ok := protocolErrorMap[e]; ok {
+		return s
 	}
-	return fmt.Errorf("protocol error: unknown error code %02x", code)
+	return fmt.Sprintf("unknown error code %02x", uint8(e))
+}
+
+func protocolError(code uint8) error {
+	return fmt.Errorf("protocol error: %w", RTUProtocolError(0x7f&code))
 }
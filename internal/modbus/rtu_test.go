@@ -33,12 +33,24 @@ func TestReadRTURequest(t *testing.T) {
 			req:    "018300130010b5c3",
 			errstr: "invalid function code", // 0x83
 		},
-		{ // TODO: add one for write coils?
+		{
 			req:   "010300131010b803",
 			id:    1,
 			fcode: ReadHoldingRegisters,
 			crc:   uint16(0x3b8),
 		},
+		{
+			req:   "110f0013000a02cd01bf0b",
+			id:    0x11,
+			fcode: WriteMultipleCoil,
+			crc:   uint16(0x0bbf),
+		},
+		{
+			req:   "11100001000204000a0102c6f0",
+			id:    0x11,
+			fcode: WriteMultipleRegisters,
+			crc:   uint16(0xf0c6),
+		},
 		{
 			req:    "110300130010b5c3",
 			errstr: "invalid crc",
@@ -125,11 +137,11 @@ func TestReadRTUResponse(t *testing.T) {
 			errstr: "EOF",
 		},
 		{
-			resp:   "018320012830",
+			resp:   "0183030131",
 			errstr: "illegal data value", // error 3
 		},
 		{
-			resp:   "018320012831",
+			resp:   "0183030130",
 			errstr: "in addition, invalid crc", // illegal data value + crc error
 		},
 	}
@@ -227,3 +239,164 @@ func TestRTUReadHoldingRegisters(t *testing.T) {
 		}
 	}
 }
+
+func TestRTUWrite(t *testing.T) {
+	tests := []struct {
+		write  func(RegisterWriter) error
+		req    string
+		resp   string
+		errstr string
+	}{
+		{
+			write: func(w RegisterWriter) error { return w.WriteSingleCoil(0x11, 0xac, true) },
+			req:   "110500acff004e8b",
+			resp:  "110500acff004e8b",
+		},
+		{
+			write: func(w RegisterWriter) error { return w.WriteSingleRegister(0x11, 1, 3) },
+			req:   "1106000100039a9b",
+			resp:  "1106000100039a9b",
+		},
+		{
+			write: func(w RegisterWriter) error {
+				return w.WriteMultipleCoils(0x11, 0x13, []bool{true, false, true, true, false, false, true, true, true, false})
+			},
+			req:  "110f0013000a02cd01bf0b",
+			resp: "110f0013000a2699",
+		},
+		{
+			write: func(w RegisterWriter) error { return w.WriteMultipleRegisters(0x11, 1, []uint16{0x000a, 0x0102}) },
+			req:   "11100001000204000a0102c6f0",
+			resp:  "1110000100021298",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteSingleRegister(1, 1, 3) },
+			req:    "010600010003980b",
+			resp:   "018602c3a1",
+			errstr: "illegal data address",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteSingleRegister(1, 1, 3) },
+			req:    "010600010003980b",
+			resp:   "010600010004d9c9",
+			errstr: "unexpected write response",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteMultipleRegisters(1, 1, nil) },
+			errstr: "invalid number of registers",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteMultipleCoils(1, 1, make([]bool, MaxWriteCoils+1)) },
+			errstr: "invalid number of coils",
+		},
+	}
+
+	for tid, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test %d: %s", tid, tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		rtu, _ := Writer(port, RTUProtocol)
+		err = tt.write(rtu)
+		if got, want := hex.EncodeToString(req.Bytes()), tt.req; got != want {
+			t.Errorf("wrong request (%d): got %s; want %s", tid, got, want)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("write failed (%d): got %v; want no error", tid, err)
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("write succeded, but it should fail (%d): got no error; want %v", tid, tt.errstr)
+		} else if err != nil && !strings.Contains(err.Error(), tt.errstr) {
+			t.Errorf("unkown error (%d): got '%s'; want error with '%s'", tid, err, tt.errstr)
+		}
+	}
+}
+
+func TestRTUReadBits(t *testing.T) {
+	tests := []struct {
+		discrete bool
+		start    uint16
+		count    uint16
+		req      string
+		resp     string
+		bits     string // '1' for on and '0' for off
+		errstr   string
+	}{
+		{
+			start: 0x13,
+			count: 37,
+			req:   "110100130025 0e84",
+			resp:  "110105cd6bb20e1b45e6",
+			bits:  "1011001111010110010011010111000011011",
+		},
+		{
+			discrete: true,
+			start:    0xc4,
+			count:    22,
+			req:      "110200c40016baa9",
+			resp:     "110203acdb352018",
+			bits:     "0011010111011011101011",
+		},
+		{
+			start:  0x13,
+			count:  37,
+			req:    "1101001300250e84",
+			resp:   "118102c054",
+			errstr: "illegal data address",
+		},
+		{
+			start:  0x13,
+			count:  37,
+			req:    "1101001300250e84",
+			resp:   "110101cd",
+			errstr: "short frame data",
+		},
+		{
+			count:  MaxReadBits + 1,
+			errstr: "invalid number of bits",
+		},
+	}
+
+	for tid, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test %d: %s", tid, tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		reader, _ := Reader(port, RTUProtocol, "")
+		br := reader.(BitReader)
+		read := br.ReadCoils
+		if tt.discrete {
+			read = br.ReadDiscreteInputs
+		}
+		bits, err := read(0x11, tt.start, tt.count)
+		if got, want := hex.EncodeToString(req.Bytes()), strings.ReplaceAll(tt.req, " ", ""); got != want {
+			t.Errorf("wrong request (%d): got %s; want %s", tid, got, want)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("read failed (%d): got %v; want no error", tid, err)
+			continue
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("read succeded, but it should fail (%d): got no error; want %v", tid, tt.errstr)
+			continue
+		} else if err != nil {
+			if !strings.Contains(err.Error(), tt.errstr) {
+				t.Errorf("unkown error (%d): got '%s'; want error with '%s'", tid, err, tt.errstr)
+			}
+			continue
+		}
+		var got strings.Builder
+		for _, b := range bits {
+			if b {
+				got.WriteByte('1')
+			} else {
+				got.WriteByte('0')
+			}
+		}
+		if got.String() != tt.bits {
+			t.Errorf("wrong bits (%d): got %s; want %s", tid, got.String(), tt.bits)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"wombatt/internal/common"
+)
+
+const (
+	// RTUoverTCPFrameGap is the minimum time between the end of a response and the next request.
+	// RS485 gateways forward each TCP segment to the serial bus and drop requests sent too quickly.
+	RTUoverTCPFrameGap = 20 * time.Millisecond
+	// MaxStaleFrames is the maximum number of unexpected frames discarded while waiting for a response.
+	MaxStaleFrames = 3
+	// TCPProbeTimeout is the read timeout used for each framing tried when probing a TCP device.
+	TCPProbeTimeout = 2 * time.Second
+)
+
+// RTUoverTCP reads and writes registers sending raw RTU frames, including their CRC, over a
+// TCP connection. This is what most RS485 to Ethernet gateways do in their transparent mode.
+//
+// Unlike RTU, it does not drain the input before each request. Late responses to previous
+// requests that timed out are discarded instead by checking the ID and function code.
+type RTUoverTCP struct {
+	port common.Port
+	last time.Time
+}
+
+func NewRTUoverTCP(port common.Port) RegisterReader {
+	return &RTUoverTCP{port: port}
+}
+
+// ReadHoldingRegisters requests 'count' holding registers from unit 'id' from the 'start' memory address.
+// and reads the response back.
+func (r *RTUoverTCP) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return r.readRegisters(id, ReadHoldingRegisters, start, count)
+}
+
+// ReadInputRegisters requests 'count' input registers from unit 'id' from the 'start' memory address.
+// and reads the response back.
+func (r *RTUoverTCP) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	return r.readRegisters(id, ReadInputRegisters, start, count)
+}
+
+func (r *RTUoverTCP) readRegisters(id uint8, functionCode RTUFunction, start uint16, count uint8) ([]byte, error) {
+	frame, err := r.send(buildReadRequestRTUFrame(id, functionCode, start, uint16(count)))
+	if err != nil {
+		return nil, err
+	}
+	return frame.Data(), nil
+}
+
+// ReadCoils requests 'count' coils from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (r *RTUoverTCP) ReadCoils(id uint8, start uint16, count uint16) ([]bool, error) {
+	return r.readBits(id, ReadCoils, start, count)
+}
+
+// ReadDiscreteInputs requests 'count' discrete inputs from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (r *RTUoverTCP) ReadDiscreteInputs(id uint8, start uint16, count uint16) ([]bool, error) {
+	return r.readBits(id, ReadDiscreteInputs, start, count)
+}
+
+func (r *RTUoverTCP) readBits(id uint8, functionCode RTUFunction, start uint16, count uint16) ([]bool, error) {
+	if err := checkBitCount(count); err != nil {
+		return nil, err
+	}
+	frame, err := r.send(buildReadRequestRTUFrame(id, functionCode, start, count))
+	if err != nil {
+		return nil, err
+	}
+	return unpackBits(frame.Data(), count)
+}
+
+// WriteSingleCoil turns the coil at 'address' in unit 'id' on or off and verifies the response.
+func (r *RTUoverTCP) WriteSingleCoil(id uint8, address uint16, value bool) error {
+	return r.write(id, WriteSingleCoil, writeSingleData(address, coilValue(value)))
+}
+
+// WriteSingleRegister writes 'value' to the register at 'address' in unit 'id' and verifies the response.
+func (r *RTUoverTCP) WriteSingleRegister(id uint8, address uint16, value uint16) error {
+	return r.write(id, WriteSingleRegister, writeSingleData(address, value))
+}
+
+// WriteMultipleCoils writes 'values' to the coils in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (r *RTUoverTCP) WriteMultipleCoils(id uint8, start uint16, values []bool) error {
+	data, err := writeMultipleCoilsData(start, values)
+	if err != nil {
+		return err
+	}
+	return r.write(id, WriteMultipleCoil, data)
+}
+
+// WriteMultipleRegisters writes 'values' to the registers in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (r *RTUoverTCP) WriteMultipleRegisters(id uint8, start uint16, values []uint16) error {
+	data, err := writeMultipleRegistersData(start, values)
+	if err != nil {
+		return err
+	}
+	return r.write(id, WriteMultipleRegisters, data)
+}
+
+func (r *RTUoverTCP) write(id uint8, functionCode RTUFunction, data []byte) error {
+	f := buildRTUFrame(id, functionCode, data)
+	frame, err := r.send(f)
+	if err != nil {
+		return err
+	}
+	return checkWriteResponse(f, frame.RawData())
+}
+
+// send waits for the inter-frame gap, sends the RTU frame 'req' and reads frames until one
+// matches the ID and function code of the request.
+func (r *RTUoverTCP) send(req []byte) (*RTUFrame, error) {
+	time.Sleep(time.Until(r.last.Add(RTUoverTCPFrameGap)))
+	defer func() { r.last = time.Now() }()
+
+	if _, err := r.port.Write(req); err != nil {
+		return nil, err
+	}
+	for range MaxStaleFrames + 1 {
+		frame, err := readRTUResponse(r.port)
+		if frame == nil {
+			return nil, err
+		}
+		if frame.ID() != req[0] || frame.Function()&0x7f != RTUFunction(req[1]) {
+			slog.Debug("discarding stale frame", "id", frame.ID(), "function", frame.Function())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+	return nil, fmt.Errorf("no response for ID %d after discarding %d stale frames", req[0], MaxStaleFrames)
+}
+
+// detectedFraming maps each port probed by tcpProbe to the protocol detected, so that readers
+// created later for the same port do not probe again.
+var detectedFraming sync.Map
+
+// framingKey returns the key for 'port' in detectedFraming. Shared ports are handed out in a new
+// wrapper for each turn, and the port they wrap is used instead.
+func framingKey(port common.Port) common.Port {
+	if w, ok := port.(interface{ Unwrap() common.Port }); ok {
+		return w.Unwrap()
+	}
+	return port
+}
+
+// tcpProbe is used for the "auto" protocol with TCP devices. The first read is tried with
+// Modbus TCP framing first and then with RTU over TCP. The first one that gets a response,
+// even a protocol error, is used from then on. Writes are never used to probe, as a late response
+// to the first framing would make the same write reach the device twice.
+type tcpProbe struct {
+	port   common.Port
+	mu     sync.Mutex
+	reader RegisterReader
+}
+
+func newTCPProbe(port common.Port) RegisterReader {
+	return &tcpProbe{port: port}
+}
+
+func (p *tcpProbe) do(f func(RegisterReader) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reader != nil {
+		return f(p.reader)
+	}
+	var errs []error
+	for _, protocol := range []string{TCPProtocol, RTUoverTCPProtocol} {
+		reader, _ := newReader(p.port, protocol, "") // Not Reader, as the address protocol may be auto.
+		_ = p.port.SetReadTimeout(TCPProbeTimeout)
+		err := f(reader)
+		var perr RTUProtocolError
+		if err == nil || errors.As(err, &perr) {
+			slog.Info("detected Modbus framing", "protocol", protocol)
+			_ = p.port.SetReadTimeout(0) // Restores the ReadTimeout of the port.
+			p.reader = reader
+			detectedFraming.Store(framingKey(p.port), protocol)
+			return err
+		}
+		slog.Debug("Modbus framing probe failed", "protocol", protocol, "error", err)
+		errs = append(errs, fmt.Errorf("%v: %w", protocol, err))
+		if errors.Is(err, io.EOF) {
+			// Some gateways close the connection when they get a frame they don't understand.
+			_ = p.port.ReopenWithBackoff()
+		} else {
+			_ = p.port.ResetInputBuffer()
+		}
+	}
+	_ = p.port.SetReadTimeout(0)
+	return fmt.Errorf("unable to detect the Modbus framing: %w", errors.Join(errs...))
+}
+
+// ReadHoldingRegisters probes the framing if needed, and then reads the holding registers.
+func (p *tcpProbe) ReadHoldingRegisters(id uint8, start uint16, count uint8) (data []byte, err error) {
+	err = p.do(func(r RegisterReader) error {
+		data, err = r.ReadHoldingRegisters(id, start, count)
+		return err
+	})
+	return data, err
+}
+
+// ReadInputRegisters probes the framing if needed, and then reads the input registers.
+func (p *tcpProbe) ReadInputRegisters(id uint8, start uint16, count uint8) (data []byte, err error) {
+	err = p.do(func(r RegisterReader) error {
+		data, err = r.ReadInputRegisters(id, start, count)
+		return err
+	})
+	return data, err
+}
+
+// ReadCoils probes the framing if needed, and then reads the coils.
+func (p *tcpProbe) ReadCoils(id uint8, start uint16, count uint16) (bits []bool, err error) {
+	err = p.do(func(r RegisterReader) error {
+		bits, err = r.(BitReader).ReadCoils(id, start, count)
+		return err
+	})
+	return bits, err
+}
+
+// ReadDiscreteInputs probes the framing if needed, and then reads the discrete inputs.
+func (p *tcpProbe) ReadDiscreteInputs(id uint8, start uint16, count uint16) (bits []bool, err error) {
+	err = p.do(func(r RegisterReader) error {
+		bits, err = r.(BitReader).ReadDiscreteInputs(id, start, count)
+		return err
+	})
+	return bits, err
+}
+
+// write calls 'f' with the writer for the detected framing, and fails if it is not known yet.
+func (p *tcpProbe) write(f func(RegisterWriter) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reader == nil {
+		return fmt.Errorf("the Modbus framing is only detected with reads, so that writes are not sent twice: use the %s or %s protocol", TCPProtocol, RTUoverTCPProtocol)
+	}
+	return f(p.reader.(RegisterWriter))
+}
+
+// WriteSingleCoil writes the coil with the detected framing.
+func (p *tcpProbe) WriteSingleCoil(id uint8, address uint16, value bool) error {
+	return p.write(func(w RegisterWriter) error {
+		return w.WriteSingleCoil(id, address, value)
+	})
+}
+
+// WriteSingleRegister writes the register with the detected framing.
+func (p *tcpProbe) WriteSingleRegister(id uint8, address uint16, value uint16) error {
+	return p.write(func(w RegisterWriter) error {
+		return w.WriteSingleRegister(id, address, value)
+	})
+}
+
+// WriteMultipleCoils writes the coils with the detected framing.
+func (p *tcpProbe) WriteMultipleCoils(id uint8, start uint16, values []bool) error {
+	return p.write(func(w RegisterWriter) error {
+		return w.WriteMultipleCoils(id, start, values)
+	})
+}
+
+// WriteMultipleRegisters writes the registers with the detected framing.
+func (p *tcpProbe) WriteMultipleRegisters(id uint8, start uint16, values []uint16) error {
+	return p.write(func(w RegisterWriter) error {
+		return w.WriteMultipleRegisters(id, start, values)
+	})
+}
@@ -0,0 +1,186 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+// replyPort returns the next reply in 'replies' after each write, and EOF once they are exhausted.
+type replyPort struct {
+	*common.TestPort
+	replies []string
+	reply   io.Reader
+	reqs    []string
+}
+
+func newReplyPort(replies ...string) *replyPort {
+	return &replyPort{TestPort: common.NewTestPort(nil, nil, common.TCPDevice), replies: replies}
+}
+
+func (p *replyPort) Write(b []byte) (int, error) {
+	p.reqs = append(p.reqs, hex.EncodeToString(b))
+	p.reply = bytes.NewReader(nil)
+	if len(p.replies) > 0 {
+		r, _ := hex.DecodeString(p.replies[0])
+		p.reply = bytes.NewReader(r)
+		p.replies = p.replies[1:]
+	}
+	return len(b), nil
+}
+
+func (p *replyPort) Read(b []byte) (int, error) {
+	if p.reply == nil {
+		return 0, io.EOF
+	}
+	return p.reply.Read(b)
+}
+
+func TestRTUoverTCPReadHoldingRegisters(t *testing.T) {
+	tests := []struct {
+		resp   string
+		data   string
+		errstr string
+	}{
+		{
+			resp: "110306ae415652434049ad",
+			data: "ae4156524340",
+		},
+		{ // Late response to a previous request for a different ID
+			resp: "0103020064b9af" + "110306ae415652434049ad",
+			data: "ae4156524340",
+		},
+		{
+			resp:   "118302c134",
+			errstr: "illegal data address",
+		},
+		{
+			resp:   "110306ae415652434049ae",
+			errstr: "invalid crc",
+		},
+		{
+			resp:   strings.Repeat("0103020064b9af", MaxStaleFrames+1),
+			errstr: "stale frames",
+		},
+		{
+			resp:   "",
+			errstr: "EOF",
+		},
+	}
+
+	for tid, tt := range tests {
+		port := newReplyPort(tt.resp)
+		reader := NewRTUoverTCP(port)
+		data, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3)
+		if got, want := strings.Join(port.reqs, ","), "1103006b00037687"; got != want {
+			t.Errorf("wrong request (%d): got %s; want %s", tid, got, want)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("read failed (%d): got %v; want no error", tid, err)
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("read succeded, but it should fail (%d): got no error; want %v", tid, tt.errstr)
+		} else if err != nil && !strings.Contains(err.Error(), tt.errstr) {
+			t.Errorf("unkown error (%d): got '%s'; want error with '%s'", tid, err, tt.errstr)
+		}
+		if got := hex.EncodeToString(data); got != tt.data {
+			t.Errorf("wrong data (%d): got %s; want %s", tid, got, tt.data)
+		}
+	}
+}
+
+func TestRTUoverTCPWrite(t *testing.T) {
+	port := newReplyPort("1106000100039a9b")
+	w, _ := Writer(port, RTUoverTCPProtocol)
+	if err := w.WriteSingleRegister(0x11, 1, 3); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got, want := strings.Join(port.reqs, ","), "1106000100039a9b"; got != want {
+		t.Errorf("wrong request: got %s; want %s", got, want)
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	const (
+		mbapReq = "0001000000061103006b0003"
+		rtuReq  = "1103006b00037687"
+	)
+	tests := []struct {
+		replies  []string
+		reqs     []string
+		errstr   [2]string // For each of the two reads
+		detected string    // Reader type returned for the same port afterwards
+	}{
+		{ // Modbus TCP
+			replies:  []string{"000100000009110306ae4156524340", "000200000009110306ae4156524340"},
+			reqs:     []string{mbapReq, "0002000000061103006b0003"},
+			detected: "*modbus.TCP",
+		},
+		{ // Modbus TCP, with a protocol error
+			replies:  []string{"000100000003118302", "000200000009110306ae4156524340"},
+			reqs:     []string{mbapReq, "0002000000061103006b0003"},
+			errstr:   [2]string{"illegal data address", ""},
+			detected: "*modbus.TCP",
+		},
+		{ // RTU over TCP, MBAP request ignored
+			replies:  []string{"", "110306ae415652434049ad", "110306ae415652434049ad"},
+			reqs:     []string{mbapReq, rtuReq, rtuReq},
+			detected: "*modbus.RTUoverTCP",
+		},
+		{ // No response
+			reqs:     []string{mbapReq, rtuReq, "0002000000061103006b0003", rtuReq},
+			errstr:   [2]string{"unable to detect the Modbus framing", "unable to detect the Modbus framing"},
+			detected: "*modbus.tcpProbe",
+		},
+	}
+
+	for id, tt := range tests {
+		tid.Store(0) // Reset the transaction counter in tcp.go so we get predictable TIDs
+		port := newReplyPort(tt.replies...)
+		reader, _ := Reader(port, "auto", "")
+		for i, errstr := range tt.errstr {
+			data, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3)
+			if err != nil && errstr == "" {
+				t.Errorf("read failed (%d/%d): got %v; want no error", id, i, err)
+			} else if err == nil && errstr != "" {
+				t.Errorf("read succeded, but it should fail (%d/%d): got no error; want %v", id, i, errstr)
+			} else if err != nil && !strings.Contains(err.Error(), errstr) {
+				t.Errorf("unkown error (%d/%d): got '%s'; want error with '%s'", id, i, err, errstr)
+			} else if err == nil && hex.EncodeToString(data) != "ae4156524340" {
+				t.Errorf("wrong data (%d/%d): got %x", id, i, data)
+			}
+		}
+		if got, want := strings.Join(port.reqs, ","), strings.Join(tt.reqs, ","); got != want {
+			t.Errorf("wrong requests (%d): got %s; want %s", id, got, want)
+		}
+		if r, _ := Reader(port, "auto", ""); fmt.Sprintf("%T", r) != tt.detected {
+			t.Errorf("wrong reader after probing (%d): got %T; want %s", id, r, tt.detected)
+		}
+	}
+}
+
+func TestTCPProbeWrite(t *testing.T) {
+	tid.Store(0)
+	port := newReplyPort("0001000000051103020007", "000200000006110600010003")
+	w, _ := Writer(port, AutoProtocol)
+	if err := w.WriteSingleRegister(0x11, 1, 3); err == nil || !strings.Contains(err.Error(), "only detected with reads") {
+		t.Errorf("got error %v; want the framing to be unknown", err)
+	}
+	if len(port.reqs) != 0 {
+		t.Errorf("requests sent before detecting the framing: %v", port.reqs)
+	}
+	// Once a read detects the framing, writes use it.
+	if _, err := w.(RegisterReader).ReadHoldingRegisters(0x11, 1, 1); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if err := w.WriteSingleRegister(0x11, 1, 3); err != nil {
+		t.Errorf("write failed: %v", err)
+	}
+	if got, want := strings.Join(port.reqs, ","), "000100000006110300010001,000200000006110600010003"; got != want {
+		t.Errorf("wrong requests: got %s; want %s", got, want)
+	}
+}
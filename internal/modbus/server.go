@@ -0,0 +1,261 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"wombatt/internal/common"
+)
+
+// RegisterImage holds the last known values of the holding and input registers of multiple units.
+// It is safe for concurrent use.
+type RegisterImage struct {
+	mu    sync.RWMutex
+	regs  map[imageAddress]uint16
+	units map[uint8]bool
+}
+
+type imageAddress struct {
+	id       uint8
+	function RTUFunction
+	address  uint16
+}
+
+func NewRegisterImage() *RegisterImage {
+	return &RegisterImage{regs: make(map[imageAddress]uint16), units: make(map[uint8]bool)}
+}
+
+// Set stores the registers in 'data', in big endian order, for unit 'id' starting at the 'start' address.
+// 'function' is either ReadHoldingRegisters or ReadInputRegisters.
+func (img *RegisterImage) Set(id uint8, function RTUFunction, start uint16, data []byte) {
+	img.mu.Lock()
+	defer img.mu.Unlock()
+	img.units[id] = true
+	for i := 0; i+1 < len(data); i += 2 {
+		img.regs[imageAddress{id, function, start + uint16(i/2)}] = binary.BigEndian.Uint16(data[i:])
+	}
+}
+
+// Get returns 'count' registers for unit 'id' starting at the 'start' address, in big endian order.
+// It returns IllegalDataAddress if any of the registers is not in the image.
+func (img *RegisterImage) Get(id uint8, function RTUFunction, start uint16, count uint16) ([]byte, error) {
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+	data := make([]byte, 0, 2*count)
+	for i := range count {
+		v, ok := img.regs[imageAddress{id, function, start + i}]
+		if !ok {
+			return nil, IllegalDataAddress
+		}
+		data = binary.BigEndian.AppendUint16(data, v)
+	}
+	return data, nil
+}
+
+// HasUnit returns true if any register for unit 'id' has been stored in the image.
+func (img *RegisterImage) HasUnit(id uint8) bool {
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+	return img.units[id]
+}
+
+type imageReader struct {
+	RegisterReader
+	image *RegisterImage
+}
+
+// NewImageReader returns a RegisterReader that stores all the registers successfully read
+// with 'reader' in 'image'. If 'image' is nil, or 'reader' is for a protocol that is not Modbus,
+// 'reader' is returned.
+func NewImageReader(reader RegisterReader, image *RegisterImage) RegisterReader {
+	switch reader.(type) {
+	case *LFP4, *Daly, *JBD, *JK:
+		// Their start address and count carry commands, not registers.
+		return reader
+	}
+	if image == nil {
+		return reader
+	}
+	return &imageReader{RegisterReader: reader, image: image}
+}
+
+// ReadHoldingRegisters reads the holding registers and stores them in the image.
+func (r *imageReader) ReadHoldingRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	data, err := r.RegisterReader.ReadHoldingRegisters(id, start, count)
+	if err == nil {
+		r.image.Set(id, ReadHoldingRegisters, start, data)
+	}
+	return data, err
+}
+
+// ReadInputRegisters reads the input registers and stores them in the image.
+func (r *imageReader) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, error) {
+	data, err := r.RegisterReader.ReadInputRegisters(id, start, count)
+	if err == nil {
+		r.image.Set(id, ReadInputRegisters, start, data)
+	}
+	return data, err
+}
+
+type imageContextKey struct{}
+
+// ContextWithImage returns a copy of ctx carrying 'image'.
+func ContextWithImage(ctx context.Context, image *RegisterImage) context.Context {
+	return context.WithValue(ctx, imageContextKey{}, image)
+}
+
+// ImageFromContext returns the image set with ContextWithImage, or nil.
+func ImageFromContext(ctx context.Context) *RegisterImage {
+	image, _ := ctx.Value(imageContextKey{}).(*RegisterImage)
+	return image
+}
+
+// Server answers ReadHoldingRegisters and ReadInputRegisters requests using the values in a RegisterImage.
+// Requests for units without any register in the image are not answered in RTU mode, and get a
+// GWTargetFailedToRespond error in TCP mode.
+type Server struct {
+	image *RegisterImage
+}
+
+func NewServer(image *RegisterImage) *Server {
+	return &Server{image: image}
+}
+
+// handle returns the response PDU (function code and data) for the request PDU 'pdu' for unit 'id'.
+func (s *Server) handle(id uint8, pdu []byte) []byte {
+	function := RTUFunction(pdu[0])
+	switch function {
+	case ReadHoldingRegisters, ReadInputRegisters:
+		if len(pdu) != 5 {
+			return exceptionPDU(function, IllegalDataValue)
+		}
+		start := binary.BigEndian.Uint16(pdu[1:])
+		count := binary.BigEndian.Uint16(pdu[3:])
+		if count == 0 || count > MaxReadRegisters {
+			return exceptionPDU(function, IllegalDataValue)
+		}
+		data, err := s.image.Get(id, function, start, count)
+		if err != nil {
+			return exceptionPDU(function, IllegalDataAddress)
+		}
+		return append([]byte{byte(function), uint8(len(data))}, data...)
+	default:
+		return exceptionPDU(function, IllegalFunction)
+	}
+}
+
+func exceptionPDU(function RTUFunction, code RTUProtocolError) []byte {
+	return []byte{byte(function) | 0x80, byte(code)}
+}
+
+// ServeRTU reads RTU requests from 'port' and writes the responses back until ctx is done or
+// there is an error other than a malformed request.
+func (s *Server) ServeRTU(ctx context.Context, port common.Port) error {
+	for ctx.Err() == nil {
+		frame, err := readRTURequest(port)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if frame == nil && (errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)) {
+				return err
+			}
+			slog.Debug("discarding invalid request", "error", err)
+			_ = port.ResetInputBuffer()
+			continue
+		}
+		if !s.image.HasUnit(frame.ID()) {
+			continue
+		}
+		raw := frame.RawData()
+		resp := s.handle(frame.ID(), raw[1:len(raw)-2])
+		if _, err := port.Write(buildRTUFrame(frame.ID(), RTUFunction(resp[0]), resp[1:])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeTCP accepts Modbus TCP connections from 'l' and answers their requests until ctx is done.
+// 'l' is closed when ctx is done.
+func (s *Server) ServeTCP(ctx context.Context, l net.Listener) error {
+	return serveMBAP(ctx, l, func(header TCPRTUHeader, pdu []byte) []byte {
+		if !s.image.HasUnit(header.UnitID) {
+			return exceptionPDU(RTUFunction(pdu[0]), GWTargetFailedToRespond)
+		}
+		return s.handle(header.UnitID, pdu)
+	})
+}
+
+// serveMBAP accepts Modbus TCP connections from 'l' until ctx is done, and calls 'handle' for each
+// request. 'handle' returns the response PDU, that is sent back with the same MBAP header, or nil
+// if there is no response.
+func serveMBAP(ctx context.Context, l net.Listener, handle func(TCPRTUHeader, []byte) []byte) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go serveMBAPConn(ctx, conn, handle)
+	}
+}
+
+func serveMBAPConn(ctx context.Context, conn net.Conn, handle func(TCPRTUHeader, []byte) []byte) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	for {
+		header, pdu, err := readTCPRequest(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				slog.Debug("closing Modbus TCP connection", "remote", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		resp := handle(header, pdu)
+		if resp == nil {
+			continue
+		}
+		header.Length = uint16(len(resp)) + 1 // +1 for the unit ID
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.BigEndian, &header)
+		buf.Write(resp)
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// readTCPRequest reads an MBAP header and the request PDU that follows it.
+func readTCPRequest(r io.Reader) (TCPRTUHeader, []byte, error) {
+	var header TCPRTUHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return header, nil, err
+	}
+	if header.PID != 0 {
+		return header, nil, fmt.Errorf("unexpected protocol ID: got 0x%04x; want 0", header.PID)
+	}
+	if header.Length < 2 || header.Length > MaxRTUFrameLength-2 {
+		return header, nil, fmt.Errorf("invalid length: %d", header.Length)
+	}
+	pdu := make([]byte, header.Length-1) // UnitID is already read.
+	if n, err := io.ReadFull(r, pdu); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return header, nil, fmt.Errorf("short frame: read %d, want %d bytes", n, len(pdu))
+		}
+		return header, nil, err
+	}
+	return header, pdu, nil
+}
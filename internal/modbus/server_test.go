@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"wombatt/internal/common"
+)
+
+func TestRegisterImage(t *testing.T) {
+	image := NewRegisterImage()
+	image.Set(1, ReadHoldingRegisters, 10, []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x03})
+	image.Set(1, ReadInputRegisters, 10, []byte{0xff, 0xff})
+
+	if !image.HasUnit(1) || image.HasUnit(2) {
+		t.Errorf("wrong units: got %v, %v; want true, false", image.HasUnit(1), image.HasUnit(2))
+	}
+	data, err := image.Get(1, ReadHoldingRegisters, 11, 2)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got, want := hex.EncodeToString(data), "00020003"; got != want {
+		t.Errorf("wrong data: got %s; want %s", got, want)
+	}
+	if _, err := image.Get(1, ReadHoldingRegisters, 11, 3); !errors.Is(err, IllegalDataAddress) {
+		t.Errorf("wrong error: got %v; want %v", err, IllegalDataAddress)
+	}
+	if _, err := image.Get(1, ReadInputRegisters, 11, 1); !errors.Is(err, IllegalDataAddress) {
+		t.Errorf("wrong error: got %v; want %v", err, IllegalDataAddress)
+	}
+}
+
+func TestImageReader(t *testing.T) {
+	image := NewRegisterImage()
+	resp, _ := hex.DecodeString("110306ae415652434049ad")
+	port := common.NewTestPort(bytes.NewReader(resp), &bytes.Buffer{}, 0)
+	reader := NewImageReader(NewRTU(port), image)
+	if _, err := reader.ReadHoldingRegisters(0x11, 0x6b, 3); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	data, err := image.Get(0x11, ReadHoldingRegisters, 0x6b, 3)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got, want := hex.EncodeToString(data), "ae4156524340"; got != want {
+		t.Errorf("wrong data: got %s; want %s", got, want)
+	}
+	if r := NewImageReader(reader, nil); r != reader {
+		t.Errorf("NewImageReader with a nil image should return the reader")
+	}
+}
+
+func TestImageReaderNonModbus(t *testing.T) {
+	image := NewRegisterImage()
+	resp := BuildLFP4Response(Lifepower4Options, 2, Normal, []byte{0x00, 0x01, 0x00, 0x02})
+	port := common.NewTestPort(bytes.NewReader(resp), &bytes.Buffer{}, 0)
+	reader := NewImageReader(NewLFP4(port), image)
+	if _, err := reader.ReadHoldingRegisters(2, 0, 0x42); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if image.HasUnit(2) {
+		t.Errorf("the lifepower4 response was stored in the image")
+	}
+}
+
+func TestIsModbusProtocol(t *testing.T) {
+	for _, protocol := range []string{RTUProtocol, TCPProtocol, RTUoverTCPProtocol, ASCIIProtocol} {
+		if !IsModbusProtocol(protocol) {
+			t.Errorf("IsModbusProtocol(%s) = false; want true", protocol)
+		}
+	}
+	for _, protocol := range []string{AutoProtocol, Lifepower4Protocol, DalyProtocol, SeplosV2Protocol, PylontechProtocol, JBDProtocol, JKProtocol} {
+		if IsModbusProtocol(protocol) {
+			t.Errorf("IsModbusProtocol(%s) = true; want false", protocol)
+		}
+	}
+}
+
+func TestServeRTU(t *testing.T) {
+	image := NewRegisterImage()
+	image.Set(0x11, ReadHoldingRegisters, 0x6b, []byte{0xae, 0x41, 0x56, 0x52, 0x43, 0x40})
+
+	tests := []struct {
+		req  string
+		resp string
+	}{
+		{
+			req:  "1103006b00037687",
+			resp: "110306ae415652434049ad",
+		},
+		{ // Not in the image
+			req:  "1104006b0003c347",
+			resp: "118402c304",
+		},
+		{
+			req:  "1106000100039a9b",
+			resp: "1186018265",
+		},
+		{ // Unknown unit
+			req: "010300000001840a",
+		},
+		{ // Invalid CRC
+			req: "1103006b00037688",
+		},
+	}
+
+	for tid, tt := range tests {
+		req, _ := hex.DecodeString(tt.req)
+		var resp bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(req), &resp, 0)
+		err := NewServer(image).ServeRTU(context.Background(), port)
+		if err == nil || !strings.Contains(err.Error(), "EOF") {
+			t.Errorf("unexpected error (%d): got %v; want EOF", tid, err)
+		}
+		if got := hex.EncodeToString(resp.Bytes()); got != tt.resp {
+			t.Errorf("wrong response (%d): got %s; want %s", tid, got, tt.resp)
+		}
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	image := NewRegisterImage()
+	image.Set(3, ReadInputRegisters, 0, []byte{0x00, 0x64, 0x01, 0x02})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewServer(image).ServeTCP(ctx, l) }()
+
+	port, err := common.OpenPort(&common.PortOptions{Address: l.Addr().String(), Type: common.TCPDevice})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer port.Close()
+	reader := NewTCP(port)
+	data, err := reader.ReadInputRegisters(3, 0, 2)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got, want := hex.EncodeToString(data), "00640102"; got != want {
+		t.Errorf("wrong data: got %s; want %s", got, want)
+	}
+	if _, err := reader.ReadHoldingRegisters(3, 0, 2); err == nil || !strings.Contains(err.Error(), "illegal data address") {
+		t.Errorf("wrong error: got %v; want illegal data address", err)
+	}
+	if _, err := reader.ReadInputRegisters(4, 0, 2); err == nil || !strings.Contains(err.Error(), "gateway target failed to respond") {
+		t.Errorf("wrong error: got %v; want gateway target failed to respond", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("ServeTCP failed: %v", err)
+	}
+}
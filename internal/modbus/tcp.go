@@ -40,7 +40,78 @@ func (t *TCP) ReadInputRegisters(id uint8, start uint16, count uint8) ([]byte, e
 }
 
 func (t *TCP) readRegisters(id uint8, functionCode RTUFunction, start uint16, count uint8) ([]byte, error) {
-	raw := buildReadRequestRTUFrame(id, functionCode, start, uint16(count))
+	raw, err := t.send(id, buildReadRequestRTUFrame(id, functionCode, start, uint16(count)))
+	if err != nil {
+		return nil, err
+	}
+	return NewRTUFrame(raw).Data(), nil
+}
+
+// ReadCoils requests 'count' coils from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (t *TCP) ReadCoils(id uint8, start uint16, count uint16) ([]bool, error) {
+	return t.readBits(id, ReadCoils, start, count)
+}
+
+// ReadDiscreteInputs requests 'count' discrete inputs from unit 'id' from the 'start' memory address
+// and reads the response back.
+func (t *TCP) ReadDiscreteInputs(id uint8, start uint16, count uint16) ([]bool, error) {
+	return t.readBits(id, ReadDiscreteInputs, start, count)
+}
+
+func (t *TCP) readBits(id uint8, functionCode RTUFunction, start uint16, count uint16) ([]bool, error) {
+	if err := checkBitCount(count); err != nil {
+		return nil, err
+	}
+	raw, err := t.send(id, buildReadRequestRTUFrame(id, functionCode, start, count))
+	if err != nil {
+		return nil, err
+	}
+	return unpackBits(NewRTUFrame(raw).Data(), count)
+}
+
+// WriteSingleCoil turns the coil at 'address' in unit 'id' on or off and verifies the response.
+func (t *TCP) WriteSingleCoil(id uint8, address uint16, value bool) error {
+	return t.write(id, WriteSingleCoil, writeSingleData(address, coilValue(value)))
+}
+
+// WriteSingleRegister writes 'value' to the register at 'address' in unit 'id' and verifies the response.
+func (t *TCP) WriteSingleRegister(id uint8, address uint16, value uint16) error {
+	return t.write(id, WriteSingleRegister, writeSingleData(address, value))
+}
+
+// WriteMultipleCoils writes 'values' to the coils in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (t *TCP) WriteMultipleCoils(id uint8, start uint16, values []bool) error {
+	data, err := writeMultipleCoilsData(start, values)
+	if err != nil {
+		return err
+	}
+	return t.write(id, WriteMultipleCoil, data)
+}
+
+// WriteMultipleRegisters writes 'values' to the registers in unit 'id' starting at the 'start' address
+// and verifies the response.
+func (t *TCP) WriteMultipleRegisters(id uint8, start uint16, values []uint16) error {
+	data, err := writeMultipleRegistersData(start, values)
+	if err != nil {
+		return err
+	}
+	return t.write(id, WriteMultipleRegisters, data)
+}
+
+func (t *TCP) write(id uint8, functionCode RTUFunction, data []byte) error {
+	f := buildRTUFrame(id, functionCode, data)
+	raw, err := t.send(id, f)
+	if err != nil {
+		return err
+	}
+	return checkWriteResponse(f, raw)
+}
+
+// send sends the RTU frame 'raw' wrapped in an MBAP header and returns the response
+// in the same layout as an RTU frame, with two zero bytes in place of the CRC.
+func (t *TCP) send(id uint8, raw []byte) ([]byte, error) {
 	tf := &TCPRTUHeader{
 		TID:    uint16(tid.Add(1) & 0x0ffff),
 		Length: uint16(len(raw)) - 2, // -2 for CRC
@@ -56,17 +127,27 @@ func (t *TCP) readRegisters(id uint8, functionCode RTUFunction, start uint16, co
 	if _, err := t.port.Write(buf.Bytes()); err != nil {
 		return nil, err
 	}
-	raw, err := t.ReadTCPResponse(tf.TID, id)
+	resp, err := t.ReadTCPResponse(tf.TID, id)
 	if err != nil {
 		return nil, err
 	}
-	return NewRTUFrame(raw).Data(), nil
+	if len(resp) < 5 {
+		return nil, fmt.Errorf("short frame: read %d, want at least 3 bytes", len(resp)-2)
+	}
+	if (resp[1] & 0x80) == 0x80 {
+		return nil, protocolError(resp[2])
+	}
+	return resp, nil
 }
 
 func (t *TCP) ReadTCPResponse(tid uint16, unitID uint8) ([]byte, error) {
+	r, err := frameReader(t.port)
+	if err != nil {
+		return nil, err
+	}
 	mbap := make([]byte, 7)
 	// The UnitID is not read at this moment
-	if n, err := io.ReadFull(t.port, mbap[0:6]); err != nil {
+	if n, err := io.ReadFull(r, mbap[0:6]); err != nil {
 		if err == io.ErrUnexpectedEOF {
 			return nil, fmt.Errorf("short frame: read %d, want at least 6 bytes", n)
 		}
@@ -80,7 +161,7 @@ func (t *TCP) ReadTCPResponse(tid uint16, unitID uint8) ([]byte, error) {
 		return nil, fmt.Errorf("unexpected transaction ID: got 0x%04x; want 0x%04x", header.TID, tid)
 	}
 	rtu := make([]byte, header.Length+2) // Add 2 more bytes because RTUFrame expects a CRC there.
-	if n, err := io.ReadFull(t.port, rtu[0:len(rtu)-2]); err != nil {
+	if n, err := io.ReadFull(r, rtu[0:len(rtu)-2]); err != nil {
 		if err == io.ErrUnexpectedEOF {
 			return nil, fmt.Errorf("short frame: read %d, want at least %d bytes", n, header.Length)
 		}
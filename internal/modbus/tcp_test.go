@@ -83,3 +83,75 @@ func TestTCPReadHoldingRegisters(t *testing.T) {
 		}
 	}
 }
+
+func TestTCPWrite(t *testing.T) {
+	tests := []struct {
+		write  func(RegisterWriter) error
+		req    string
+		resp   string
+		errstr string
+	}{
+		{
+			write: func(w RegisterWriter) error { return w.WriteSingleRegister(1, 1, 3) },
+			req:   "000100000006010600010003",
+			resp:  "000100000006010600010003",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteSingleCoil(1, 1, true) },
+			req:    "00020000000601050001ff00",
+			resp:   "000200000003018502",
+			errstr: "illegal data address",
+		},
+		{
+			write: func(w RegisterWriter) error { return w.WriteMultipleRegisters(1, 1, []uint16{0x000a, 0x0102}) },
+			req:   "00030000000b01100001000204000a0102",
+			resp:  "000300000006011000010002",
+		},
+		{
+			write:  func(w RegisterWriter) error { return w.WriteMultipleCoils(1, 1, []bool{true, true}) },
+			req:    "000400000008010f000100020103",
+			resp:   "000400000006010f00010003",
+			errstr: "unexpected write response",
+		},
+	}
+
+	tid.Store(0) // Reset the transaction counter in tcp.go so we get predictable TIDs
+	for id, tt := range tests {
+		resp, err := hex.DecodeString(tt.resp)
+		if err != nil {
+			t.Fatalf("malformed response string in test: %s", tt.resp)
+		}
+		var req bytes.Buffer
+		port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+		tcp, _ := Writer(port, TCPProtocol)
+		err = tt.write(tcp)
+		if got := hex.EncodeToString(req.Bytes()); got != tt.req {
+			t.Errorf("wrong request (%d): got %s; want %s", id, got, tt.req)
+		}
+		if err != nil && tt.errstr == "" {
+			t.Errorf("write failed (%d): got %v; want no error", id, err)
+		} else if err == nil && tt.errstr != "" {
+			t.Errorf("write succeded, but it should fail (%d): got no error; want %v", id, tt.errstr)
+		} else if err != nil && !strings.Contains(err.Error(), tt.errstr) {
+			t.Errorf("unkown error (%d): got '%s'; want error with '%s'", id, err, tt.errstr)
+		}
+	}
+}
+
+func TestTCPReadBits(t *testing.T) {
+	var req bytes.Buffer
+	resp, _ := hex.DecodeString("000100000008110105cd6bb20e1b")
+	port := common.NewTestPort(bytes.NewReader(resp), &req, 0)
+	reader, _ := Reader(port, TCPProtocol, "")
+	tid.Store(0) // Reset the transaction counter in tcp.go so we get predictable TIDs
+	bits, err := reader.(BitReader).ReadCoils(0x11, 0x13, 37)
+	if err != nil {
+		t.Fatalf("read failed: got %v; want no error", err)
+	}
+	if got, want := hex.EncodeToString(req.Bytes()), "000100000006110100130025"; got != want {
+		t.Errorf("wrong request: got %s; want %s", got, want)
+	}
+	if len(bits) != 37 || !bits[0] || bits[1] || !bits[36] {
+		t.Errorf("wrong bits: got %v", bits)
+	}
+}
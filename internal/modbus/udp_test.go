@@ -0,0 +1,72 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"wombatt/internal/common"
+)
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer conn.Close()
+	image := NewRegisterImage()
+	image.Set(3, ReadHoldingRegisters, 0, []byte{0x00, 0x64, 0x01, 0x02})
+	server := NewServer(image)
+	// The server answers with a whole datagram the first request, a truncated one the second,
+	// nothing the third, and a whole datagram again from then on.
+	go func() {
+		buf := make([]byte, common.MaxDatagramSize)
+		for n := 1; ; n++ {
+			size, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			header, pdu, err := readTCPRequest(bytes.NewReader(buf[:size]))
+			if err != nil {
+				t.Errorf("invalid request: %v", err)
+				return
+			}
+			resp := server.handle(header.UnitID, pdu)
+			header.Length = uint16(len(resp)) + 1
+			var b bytes.Buffer
+			_ = binary.Write(&b, binary.BigEndian, header)
+			b.Write(resp)
+			switch n {
+			case 2:
+				_, _ = conn.WriteTo(b.Bytes()[:8], addr)
+			case 3:
+			default:
+				_, _ = conn.WriteTo(b.Bytes(), addr)
+			}
+		}
+	}()
+
+	port, err := common.OpenPort(&common.PortOptions{Address: conn.LocalAddr().String(), Type: common.UDPDevice, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer port.Close()
+	reader, err := Reader(port, AutoProtocol, "")
+	if err != nil {
+		t.Fatalf("Reader failed: %v", err)
+	}
+	for i, want := range []string{"", "short frame", "read timeout", ""} {
+		data, err := reader.ReadHoldingRegisters(3, 0, 2)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("request #%d: got %v; want no error", i+1, err)
+		case want == "" && !bytes.Equal(data, []byte{0x00, 0x64, 0x01, 0x02}):
+			t.Errorf("request #%d: wrong data: got %x", i+1, data)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("request #%d: got %v; want error with '%s'", i+1, err, want)
+		}
+	}
+}
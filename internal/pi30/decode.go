@@ -0,0 +1,46 @@
+package pi30
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// maxFrameLength is the maximum length of a command or response accepted by SplitFrame.
+const maxFrameLength = 512
+
+// SplitFrame finds the command or response at the start of 'data'. It returns the length of the
+// frame, 0 if more data is needed, or -1 if 'data' does not start with a PI30 frame.
+// 'ok' is true if the CRC of the frame is valid.
+func SplitFrame(data []byte, request bool) (n int, ok bool) {
+	if len(data) == 0 {
+		return 0, false
+	}
+	if (request && (data[0] < 'A' || data[0] > 'Z')) || (!request && data[0] != '(') {
+		return -1, false
+	}
+	end := bytes.IndexByte(data, '\r')
+	if end == -1 {
+		if len(data) > maxFrameLength {
+			return -1, false
+		}
+		return 0, false
+	}
+	n = end + 1
+	if n < 4 { // At least one byte of data, 2 for the CRC, and '\r'.
+		return -1, false
+	}
+	return n, frameCRC(data[:n]) == crc(data[:n-3])
+}
+
+// DescribeFrame returns the command or the response in the frame, and the CRC status.
+func DescribeFrame(frame []byte) string {
+	status := "CRC ok"
+	if got, want := frameCRC(frame), crc(frame[:len(frame)-3]); got != want {
+		status = fmt.Sprintf("CRC error: got %04x, want %04x", got, want)
+	}
+	return fmt.Sprintf("%s (%s)", frame[:len(frame)-3], status)
+}
+
+func frameCRC(frame []byte) uint16 {
+	return uint16(frame[len(frame)-3])*256 + uint16(frame[len(frame)-2])
+}
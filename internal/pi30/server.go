@@ -0,0 +1,61 @@
+package pi30
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ReadCommand reads a command from 'r' and returns it without the CRC and '\r'.
+func ReadCommand(r *bufio.Reader) (string, error) {
+	b, err := r.ReadSlice('\r')
+	if err != nil {
+		return "", err
+	}
+	if len(b) < 4 {
+		return "", fmt.Errorf("short command: '%q'", b)
+	}
+	computed := crc(b[:len(b)-3])
+	if received := frameCRC(b); received != computed {
+		return "", fmt.Errorf("crc error: got %04x, want %04x", received, computed)
+	}
+	return string(b[:len(b)-3]), nil
+}
+
+// EncodeResponse returns the response frame with the fields of the struct pointed by 'v' separated
+// by spaces, which is the reverse of what RunCommand does to decode it.
+func EncodeResponse(v any) []byte {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	stValue := reflect.ValueOf(v).Elem()
+	stType := stValue.Type()
+	for i := range stType.NumField() {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(formatField(stValue.Field(i), stType.Field(i)))
+	}
+	c := crc(b.Bytes())
+	b.WriteByte(byte(c >> 8))
+	b.WriteByte(byte(c & 0x0ff))
+	b.WriteByte('\r')
+	return b.Bytes()
+}
+
+func formatField(v reflect.Value, f reflect.StructField) string {
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint8, reflect.Uint16:
+		if f.Tag.Get("parseas") == "binary" {
+			return fmt.Sprintf("%0*b", v.Type().Bits(), v.Uint())
+		}
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', 1, 32)
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,50 @@
+package pi30
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	var b bytes.Buffer
+	_ = sendCommand(&b, "QPIGS")
+	_ = sendCommand(&b, "QPGS1")
+	b.WriteString("QPIRI\x00\x00\r")
+	r := bufio.NewReader(&b)
+	for _, want := range []string{"QPIGS", "QPGS1"} {
+		if cmd, err := ReadCommand(r); err != nil || cmd != want {
+			t.Errorf("wrong command: got %q (%v); want %q", cmd, err, want)
+		}
+	}
+	if _, err := ReadCommand(r); err == nil {
+		t.Errorf("crc error not detected")
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	tests := []any{
+		&QPIGSResponse{GridVoltage: 230.5, GridFrequency: 50, AcOutputActivePower: 1234, BatteryVoltage: 52.4,
+			BatteryCapacity: 87, DeviceStatus: 0x16, PV1ChargingPower: 2500},
+		&QPGSResponse{Instance: 1, Serial: "92932004102443", WorkMode: "B", InverterStatus: "00010010", BatteryCapacity: 55},
+		&Q1Response{SccCommunicating: 1, InverterTemperature: 41, SyncFrequency: 60, InverterChargeStatus: 12},
+		&EmptyResponse{AckOrNak: "NAK"},
+	}
+	for tid, want := range tests {
+		strs, err := readResponse(bytes.NewReader(EncodeResponse(want)))
+		if err != nil {
+			t.Fatalf("error reading response (%d): %v", tid, err)
+		}
+		got := reflect.New(reflect.TypeOf(want).Elem()).Interface()
+		if err := decodeResponse(strs, got); err != nil {
+			t.Fatalf("error decoding response (%d): %v", tid, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong response (%d): got %+v; want %+v", tid, got, want)
+		}
+	}
+	if got, want := string(EncodeResponse(&QPIGS2Response{PV2InputCurrent: 1.5, PV2InputVoltage: 300, PV2ChargingPower: 450})), "(1.5 300.0 450"; got[:len(got)-3] != want {
+		t.Errorf("wrong response: got %q; want %q", got[:len(got)-3], want)
+	}
+}
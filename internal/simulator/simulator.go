@@ -0,0 +1,235 @@
+// Package simulator serves simulated battery and inverter data. The responses are encoded from
+// the same structs used to decode the data read from real devices.
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"wombatt/internal/bms"
+	"wombatt/internal/common"
+	"wombatt/internal/modbus"
+	"wombatt/internal/pi30"
+)
+
+const (
+	PI30Model      = "pi30"
+	SolarkModel    = "solark"
+	EG418kPVModel  = "eg4_18kpv"
+	EG46000XPModel = "eg4_6000xp"
+
+	// updateInterval is how often the Modbus registers are updated.
+	updateInterval = time.Second
+)
+
+// Models has all the models that can be simulated.
+var Models = []string{bms.EG4LLv2BMS, bms.Lifepower4BMS, bms.PaceBMS, PI30Model, SolarkModel, EG418kPVModel, EG46000XPModel}
+
+// Simulator answers the requests for one or more devices of the same model.
+type Simulator struct {
+	model string
+	ids   []uint8
+	start time.Time
+	now   func() time.Time
+}
+
+// New returns a Simulator for devices of 'model' with the given IDs. PI30 devices have no ID,
+// and only the first one is used to vary the values.
+func New(model string, ids []uint8) (*Simulator, error) {
+	if !slices.Contains(Models, model) {
+		return nil, fmt.Errorf("unsupported model: %s", model)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no device IDs")
+	}
+	return &Simulator{model: model, ids: ids, start: time.Now(), now: time.Now}, nil
+}
+
+// Serve answers the requests read from 'port' until ctx is done or there is an error reading.
+func (s *Simulator) Serve(ctx context.Context, port common.Port) error {
+	if s.isModbus() {
+		return modbus.NewServer(s.startImage(ctx)).ServeRTU(ctx, port)
+	}
+	return s.serveFrames(ctx, port)
+}
+
+// ServeTCP accepts connections from 'l' and answers their requests until ctx is done.
+// Modbus models use Modbus TCP, and lifepower4 and pi30 the same frames as in a serial port.
+// 'l' is closed when ctx is done.
+func (s *Simulator) ServeTCP(ctx context.Context, l net.Listener) error {
+	if s.isModbus() {
+		return modbus.NewServer(s.startImage(ctx)).ServeTCP(ctx, l)
+	}
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			if err := s.serveFrames(ctx, conn); err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				slog.Debug("closing connection", "remote", conn.RemoteAddr(), "error", err)
+			}
+		}()
+	}
+}
+
+func (s *Simulator) isModbus() bool {
+	return s.model != bms.Lifepower4BMS && s.model != PI30Model
+}
+
+// startImage returns a register image with the values for all the devices, updated every second until ctx is done.
+func (s *Simulator) startImage(ctx context.Context) *modbus.RegisterImage {
+	image := modbus.NewRegisterImage()
+	for _, id := range s.ids {
+		// All the registers read are in the image, even the ones not in the structs.
+		image.Set(id, s.registerFunction(), 0, make([]byte, 2*256))
+	}
+	s.updateImage(image)
+	go func() {
+		ticker := time.NewTicker(updateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.updateImage(image)
+			}
+		}
+	}()
+	return image
+}
+
+// registerFunction returns the function used to read the registers of the model.
+func (s *Simulator) registerFunction() modbus.RTUFunction {
+	if s.model == EG418kPVModel || s.model == EG46000XPModel {
+		return modbus.ReadInputRegisters
+	}
+	return modbus.ReadHoldingRegisters
+}
+
+func (s *Simulator) updateImage(image *modbus.RegisterImage) {
+	function := s.registerFunction()
+	for _, id := range s.ids {
+		st := s.state(id)
+		switch s.model {
+		case bms.EG4LLv2BMS:
+			setStruct(image, id, function, 0, st.eg4Info())
+			setStruct(image, id, function, 105, st.eg4ExtraInfo(id))
+		case bms.PaceBMS:
+			setStruct(image, id, function, 0, st.paceInfo())
+			setStruct(image, id, function, 150, st.paceExtraInfo(id))
+		case SolarkModel:
+			setFields(image, id, function, binary.BigEndian, st.solarkRealtimeData())
+			setFields(image, id, function, binary.BigEndian, solarkIntrinsicAttributes(id))
+		case EG418kPVModel:
+			setFields(image, id, function, binary.BigEndian, st.eg418kPVRealtimeData())
+		case EG46000XPModel:
+			// The eg4_6000xp registers are little endian.
+			setFields(image, id, function, binary.LittleEndian, st.eg46000XPRealtimeData())
+		}
+	}
+}
+
+// serveFrames answers lifepower4 or pi30 requests read from 'rw' until ctx is done or there is
+// an error reading.
+func (s *Simulator) serveFrames(ctx context.Context, rw io.ReadWriter) error {
+	br := bufio.NewReader(rw)
+	for ctx.Err() == nil {
+		var resp []byte
+		var err error
+		if s.model == PI30Model {
+			resp, err = s.pi30Response(br)
+		} else {
+			resp, err = s.lfp4Response(br)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+				return err
+			}
+			slog.Debug("discarding invalid request", "error", err)
+			br.Reset(rw)
+			if flusher, ok := rw.(interface{ ResetInputBuffer() error }); ok {
+				_ = flusher.ResetInputBuffer()
+			}
+			continue
+		}
+		if resp == nil {
+			continue
+		}
+		if _, err := rw.Write(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lfp4Response reads a lifepower4 request and returns the response, or nil if the request is for
+// an unknown device.
+func (s *Simulator) lfp4Response(r io.Reader) ([]byte, error) {
+	id, cid2, _, err := modbus.ReadLFP4Request(r)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(s.ids, id) {
+		return nil, nil
+	}
+	st := s.state(id)
+	switch cid2 {
+	case lfp4AnalogValueCommand:
+		return modbus.BuildLFP4Response(modbus.Lifepower4Options, id, modbus.Normal, encodeStruct(st.lfp4AnalogValue())), nil
+	case lfp4AlarmInfoCommand:
+		return modbus.BuildLFP4Response(modbus.Lifepower4Options, id, modbus.Normal, encodeStruct(st.lfp4AlarmInfo())), nil
+	default:
+		return modbus.BuildLFP4Response(modbus.Lifepower4Options, id, modbus.InvalidCID2, nil), nil
+	}
+}
+
+// pi30Response reads a pi30 command and returns the response. Unknown commands get a NAK.
+func (s *Simulator) pi30Response(r *bufio.Reader) ([]byte, error) {
+	cmd, err := pi30.ReadCommand(r)
+	if err != nil {
+		return nil, err
+	}
+	st := s.state(s.ids[0])
+	var resp any
+	switch {
+	case cmd == "Q1":
+		resp = st.q1()
+	case cmd == "QPIRI":
+		resp = qpiri()
+	case cmd == "QPIGS":
+		resp = st.qpigs()
+	case cmd == "QPIGS2":
+		resp = st.qpigs2()
+	case len(cmd) > 4 && cmd[0:4] == "QPGS":
+		var n int
+		if _, err := fmt.Sscanf(cmd[4:], "%d", &n); err != nil {
+			resp = &pi30.EmptyResponse{AckOrNak: "NAK"}
+			break
+		}
+		resp = s.state(s.ids[0] + uint8(n)).qpgs(n)
+	default:
+		resp = &pi30.EmptyResponse{AckOrNak: "NAK"}
+	}
+	return pi30.EncodeResponse(resp), nil
+}
@@ -0,0 +1,136 @@
+package simulator
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"wombatt/internal/bms"
+	"wombatt/internal/common"
+	"wombatt/internal/eg4_18kpv"
+	"wombatt/internal/eg4_6000xp"
+	"wombatt/internal/modbus"
+	"wombatt/internal/pi30"
+	"wombatt/internal/solark"
+
+	"go.bug.st/serial"
+)
+
+func newTestSimulator(t *testing.T, model string, ids []uint8) *Simulator {
+	s, err := New(model, ids)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %v", model, err)
+	}
+	now := s.start.Add(15 * time.Minute)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+// checkDevice reads the data for device 'id' through 'port' with the same functions used for real
+// devices and compares it with the simulated values.
+func checkDevice(t *testing.T, s *Simulator, port common.Port, deviceType string, id uint8) {
+	st := s.state(id)
+	var got, want any
+	var err error
+	switch s.model {
+	case bms.EG4LLv2BMS, bms.Lifepower4BMS, bms.PaceBMS:
+		b, _ := bms.Instance(s.model)
+		reader, rerr := modbus.Reader(port, b.DefaultProtocol(deviceType), s.model)
+		if rerr != nil {
+			t.Fatalf("%s: %v", s.model, rerr)
+		}
+		got, err = b.ReadInfo(reader, id, time.Second)
+		switch info := got.(type) {
+		case *bms.EG4BatteryInfo:
+			info.FullCapacity *= 3600
+			got = &info.EG4ModbusBatteryInfo
+			want = st.eg4Info()
+		case *bms.PaceBatteryInfo:
+			got = &info.PaceModbusBatteryInfo
+			want = st.paceInfo()
+		default:
+			want = st.lfp4AnalogValue()
+		}
+	case SolarkModel:
+		got, err = solark.ReadRealtimeData(modbus.NewTCP(port), id)
+		want = st.solarkRealtimeData()
+	case EG418kPVModel:
+		got, err = eg4_18kpv.ReadRealtimeData(modbus.NewTCP(port), id)
+		want = st.eg418kPVRealtimeData()
+	case EG46000XPModel:
+		got, err = eg4_6000xp.ReadRealtimeData(modbus.NewTCP(port), id)
+		want = st.eg46000XPRealtimeData()
+	case PI30Model:
+		got, err = pi30.RunCommand(context.Background(), port, "QPIGS")
+		want = s.state(s.ids[0]).qpigs() // There are no IDs in pi30.
+	}
+	if err != nil {
+		t.Fatalf("%s: error reading device %d: %v", s.model, id, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: wrong data for device %d:\ngot  %+v\nwant %+v", s.model, id, got, want)
+	}
+}
+
+func TestSimulatorTCP(t *testing.T) {
+	ids := []uint8{2, 3}
+	for _, model := range Models {
+		s := newTestSimulator(t, model, ids)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- s.ServeTCP(ctx, l) }()
+
+		port, err := common.OpenPort(&common.PortOptions{Address: l.Addr().String(), Type: common.TCPDevice, ReadTimeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			checkDevice(t, s, port, "tcp", id)
+		}
+		port.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("%s: ServeTCP failed: %v", model, err)
+		}
+	}
+}
+
+func TestSimulatorPTY(t *testing.T) {
+	for _, model := range []string{bms.Lifepower4BMS, PI30Model} {
+		master, name, err := common.OpenPTY()
+		if err != nil {
+			t.Skipf("no pseudo-terminals: %v", err)
+		}
+		s := newTestSimulator(t, model, []uint8{1})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- s.Serve(ctx, master) }()
+
+		port, err := common.OpenPort(&common.PortOptions{Address: name, Mode: &serial.Mode{BaudRate: 9600}, Type: common.SerialDevice, ReadTimeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDevice(t, s, port, "serial", 1)
+		port.Close()
+		cancel()
+		master.Close()
+		if err := <-done; err != nil {
+			t.Errorf("%s: Serve failed: %v", model, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("unknown", []uint8{1}); err == nil {
+		t.Errorf("no error for an unknown model")
+	}
+	if _, err := New(SolarkModel, nil); err == nil {
+		t.Errorf("no error without IDs")
+	}
+}
@@ -0,0 +1,533 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"wombatt/internal/bms"
+	"wombatt/internal/eg4_18kpv"
+	"wombatt/internal/eg4_6000xp"
+	"wombatt/internal/modbus"
+	"wombatt/internal/pi30"
+	"wombatt/internal/solark"
+)
+
+const (
+	// cyclePeriod is the duration of a full charge and discharge cycle of the batteries.
+	cyclePeriod = 3600.0 // seconds
+
+	lfp4AnalogValueCommand uint8 = 0x42
+	lfp4AlarmInfoCommand   uint8 = 0x44
+
+	fullCapacity = 100.0 // Ah
+	maxCurrent   = 40.0  // A
+)
+
+// state has the simulated values of a device, which slowly change over time following a charge
+// and discharge cycle. All the devices of a Simulator are at a different point of the cycle.
+type state struct {
+	current     float64 // A, positive while charging
+	soc         float64 // %
+	cells       [16]float64
+	voltage     float64 // V
+	temps       [4]float64
+	mosfetTemp  float64 // °C
+	envTemp     float64 // °C
+	pvPower     float64 // W
+	loadPower   float64 // W
+	gridPower   float64 // W, positive when importing from the grid
+	gridVoltage float64 // V
+	frequency   float64 // Hz
+	cycles      int
+	uptime      float64 // seconds
+}
+
+func (s *Simulator) state(id uint8) *state {
+	t := s.now().Sub(s.start).Seconds()
+	x := 2*math.Pi*t/cyclePeriod + float64(id)*0.7
+	st := &state{
+		current:     math.Round(maxCurrent*math.Sin(x)*100) / 100,
+		soc:         60 - 30*math.Cos(x), // Increases while the current is positive.
+		mosfetTemp:  28 + 4*math.Abs(math.Sin(x)),
+		envTemp:     22 + math.Sin(x/4),
+		pvPower:     math.Max(0, 5000*math.Sin(x+0.5)),
+		loadPower:   1200 + 400*math.Sin(3*x),
+		gridVoltage: 240 + 2*math.Sin(5*x),
+		frequency:   60 + 0.02*math.Sin(7*x),
+		cycles:      100 + int(id) + int(t/cyclePeriod),
+		uptime:      t,
+	}
+	for i := range st.cells {
+		st.cells[i] = 3.2 + 0.15*st.soc/100 + 0.01*st.current/maxCurrent + float64((i*7+int(id))%5)*0.002
+		st.voltage += st.cells[i]
+	}
+	for i := range st.temps {
+		st.temps[i] = 24 + 3*math.Abs(st.current)/maxCurrent + float64(i)*0.3
+	}
+	st.gridPower = st.loadPower + st.batteryPower() - st.pvPower
+	return st
+}
+
+// batteryPower returns the power going into the batteries, negative while discharging.
+func (st *state) batteryPower() float64 {
+	return st.current * st.voltage
+}
+
+func (st *state) charging() bool {
+	return st.current > 0
+}
+
+func (st *state) cellVoltages() (mv [16]uint16) {
+	for i, v := range st.cells {
+		mv[i] = uint16(math.Round(v * 1000))
+	}
+	return mv
+}
+
+func (st *state) minMaxCells() (uint16, uint16) {
+	mv := st.cellVoltages()
+	lo, hi := mv[0], mv[0]
+	for _, v := range mv[1:] {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	return lo, hi
+}
+
+// kelvin returns 'c' degrees Celsius in tenths of Kelvin.
+func kelvin(c float64) uint16 {
+	return uint16(math.Round((c + 273.15) * 10))
+}
+
+func positive(v float64) float64 {
+	return math.Max(0, v)
+}
+
+// serialNumber returns a serial number of 'n' characters for device 'id'.
+func serialNumber(prefix string, id uint8, n int) string {
+	return fmt.Sprintf("%s%0*d", prefix, n-len(prefix), id)
+}
+
+func (st *state) eg4Info() *bms.EG4ModbusBatteryInfo {
+	status := uint16(32768) // Active, stand by.
+	if st.current > 0 {
+		status |= 1
+	} else if st.current < 0 {
+		status |= 2
+	}
+	temps := [4]int8{}
+	for i, t := range st.temps {
+		temps[i] = int8(math.Round(t))
+	}
+	return &bms.EG4ModbusBatteryInfo{
+		Voltage:            uint16(math.Round(st.voltage * 100)),
+		Current:            int16(math.Round(st.current * 100)),
+		CellVoltages:       st.cellVoltages(),
+		PCBTemp:            int16(math.Round(st.mosfetTemp)),
+		MaxTemp:            int16(math.Round(st.temps[3])),
+		AvgTemp:            int16(math.Round(st.temps[1])),
+		CapRemaining:       uint16(math.Round(st.soc)),
+		MaxChargingCurrent: 100,
+		SOH:                99,
+		SOC:                uint16(math.Round(st.soc)),
+		Status:             status,
+		CycleCounts:        uint32(st.cycles),
+		FullCapacity:       fullCapacity * 1000 * 3600, // mAs
+		Temp1:              temps[0],
+		Temp2:              temps[1],
+		Temp3:              temps[2],
+		Temp4:              temps[3],
+		CellNum:            16,
+		DesignedCapacity:   fullCapacity * 10,
+	}
+}
+
+func (st *state) eg4ExtraInfo(id uint8) *bms.EG4ModbusExtraBatteryInfo {
+	var info bms.EG4ModbusExtraBatteryInfo
+	copy(info.Model[:], "LL-S 51.2V 100Ah SIM")
+	copy(info.FirmwareVersion[:], "Z02T04")
+	copy(info.Serial[:], serialNumber("SIM", id, 16))
+	return &info
+}
+
+func (st *state) paceInfo() *bms.PaceModbusBatteryInfo {
+	status := uint16(0x0c00) // Both MOSFETs on.
+	if st.current > 0 {
+		status |= 0x0100
+	} else if st.current < 0 {
+		status |= 0x0200
+	}
+	info := &bms.PaceModbusBatteryInfo{
+		Current:           int16(math.Round(st.current * 100)),
+		Voltage:           uint16(math.Round(st.voltage * 100)),
+		SOC:               uint16(math.Round(st.soc)),
+		SOH:               99,
+		RemainingCapacity: uint16(math.Round(st.soc / 100 * fullCapacity * 100)),
+		FullCapacity:      fullCapacity * 100,
+		DesignCapacity:    fullCapacity * 100,
+		CycleCounts:       uint16(st.cycles),
+		StatusFlag:        status,
+		CellVoltages:      st.cellVoltages(),
+		MOSFETTemp:        int16(math.Round(st.mosfetTemp * 10)),
+		EnvTemp:           int16(math.Round(st.envTemp * 10)),
+	}
+	for i, t := range st.temps {
+		info.CellTemps[i] = int16(math.Round(t * 10))
+	}
+	return info
+}
+
+func (st *state) paceExtraInfo(id uint8) *bms.PaceModbusExtraBatteryInfo {
+	var info bms.PaceModbusExtraBatteryInfo
+	copy(info.Version[:], "P16S100A-SIM-1.00")
+	copy(info.ModelSN[:], serialNumber("SIMMODEL", id, 20))
+	copy(info.PackSN[:], serialNumber("SIMPACK", id, 20))
+	return &info
+}
+
+func (st *state) lfp4AnalogValue() *bms.LFP4AnalogValueBatteryInfo {
+	lo, hi := st.minMaxCells()
+	info := &bms.LFP4AnalogValueBatteryInfo{
+		NumberOfCells:   16,
+		CellVoltages:    st.cellVoltages(),
+		EnvTemp:         kelvin(st.envTemp),
+		MOSFETTemp:      kelvin(st.mosfetTemp),
+		PackCurrent:     int16(math.Round(st.current * 100)),
+		PackVoltage:     int16(math.Round(st.voltage * 100)),
+		CapRemaining:    uint16(math.Round(st.soc / 100 * fullCapacity * 100)),
+		FullCapacity:    fullCapacity * 100,
+		CycleCounts:     uint16(st.cycles),
+		SOC:             uint16(math.Round(st.soc)),
+		SOH:             99,
+		MaxCellVoltage:  hi,
+		MinCellVoltage:  lo,
+		CellVoltageDiff: hi - lo,
+		MaxCellTemp:     kelvin(st.temps[3]),
+		MinCellTemp:     kelvin(st.temps[0]),
+	}
+	for i, t := range st.temps {
+		info.CellTemps[i] = kelvin(t)
+	}
+	return info
+}
+
+func (st *state) lfp4AlarmInfo() *bms.LFP4AlarmInfo {
+	info := &bms.LFP4AlarmInfo{
+		NumberOfCells: 16,
+		FETStatusCode: 0x03, // Charge and discharge MOSFETs on.
+	}
+	switch {
+	case st.current > 0:
+		info.SystemStatusCode = 0x02
+	case st.current < 0:
+		info.SystemStatusCode = 0x01
+	default:
+		info.SystemStatusCode = 0x08
+	}
+	return info
+}
+
+func solarkIntrinsicAttributes(id uint8) *solark.IntrinsicAttributes {
+	sn := []byte(serialNumber("SIM", id, 10))
+	return &solark.IntrinsicAttributes{
+		SNByte01: binary.BigEndian.Uint16(sn[0:]),
+		SNByte02: binary.BigEndian.Uint16(sn[2:]),
+		SNByte03: binary.BigEndian.Uint16(sn[4:]),
+		SNByte04: binary.BigEndian.Uint16(sn[6:]),
+		SNByte05: binary.BigEndian.Uint16(sn[8:]),
+	}
+}
+
+func (st *state) solarkRealtimeData() *solark.RealtimeData {
+	load := int16(st.loadPower)
+	grid := int16(st.gridPower)
+	inverter := int16(st.loadPower - st.gridPower)
+	freq := uint16(math.Round(st.frequency * 100))
+	return &solark.RealtimeData{
+		DayActivePowerWh:         int16(math.Mod(st.uptime, 86400) / 360),
+		GridFrequency:            freq,
+		DCDCTemp:                 int16(math.Round(st.mosfetTemp * 10)),
+		IGBTHSCTemp:              int16(math.Round((st.mosfetTemp + 5) * 10)),
+		CorrectedBattCapacity:    fullCapacity,
+		DCVoltage1:               3800,
+		DCCurrent1:               uint16(st.pvPower / 380),
+		GridSideVoltageL1N:       uint16(math.Round(st.gridVoltage * 5)),
+		GridSideVoltageL2N:       uint16(math.Round(st.gridVoltage * 5)),
+		GridSideVoltageL1L2:      uint16(math.Round(st.gridVoltage * 10)),
+		InverterOutputVoltageL1N: uint16(math.Round(st.gridVoltage * 5)),
+		InverterOutputVoltageL2N: uint16(math.Round(st.gridVoltage * 5)),
+		LoadVoltageL1:            uint16(math.Round(st.gridVoltage * 5)),
+		LoadVoltageL2:            uint16(math.Round(st.gridVoltage * 5)),
+		GridSideL1Power:          grid / 2,
+		GridSideL2Power:          grid - grid/2,
+		TotalPowerGridSideL1L2:   grid,
+		GridExternalTotalPower:   grid,
+		InverterOutputsL1Power:   inverter / 2,
+		InverterOutputsL2Power:   inverter - inverter/2,
+		InverterOutputTotalPower: inverter,
+		LoadSideL1Power:          load / 2,
+		LoadSideL2Power:          load - load/2,
+		LoadSideTotalPower:       load,
+		LoadCurrentL1:            uint16(st.loadPower / st.gridVoltage * 100),
+		LoadCurrentL2:            uint16(st.loadPower / st.gridVoltage * 100),
+		BatteryTemperature:       int16(math.Round(st.temps[0] * 10)),
+		BatteryVoltage:           uint16(math.Round(st.voltage * 100)),
+		BatteryCapacitySOC:       uint16(math.Round(st.soc)),
+		PV1InputPower:            uint16(st.pvPower),
+		BatteryOutputPower:       int16(-st.batteryPower()),
+		BatteryOutputCurrent:     int16(math.Round(-st.current * 100)),
+		LoadFrequency:            freq,
+		InverterOutputFrequency:  freq,
+		GridSideRelayStatus:      2,
+		GeneratorSideRelayStatus: 2,
+	}
+}
+
+func (st *state) eg418kPVRealtimeData() *eg4_18kpv.RealtimeData {
+	lo, hi := st.minMaxCells()
+	return &eg4_18kpv.RealtimeData{
+		State:          0x14, // PV+Battery on-grid mode.
+		Vpv1:           3800,
+		Vbat:           uint16(math.Round(st.voltage * 10)),
+		SOC:            uint16(math.Round(st.soc)),
+		SOH:            99,
+		Ppv1:           uint16(st.pvPower),
+		Pcharge:        uint16(positive(st.batteryPower())),
+		Pdischarge:     uint16(positive(-st.batteryPower())),
+		VacR:           uint16(math.Round(st.gridVoltage * 10)),
+		Fac:            uint16(math.Round(st.frequency * 100)),
+		Pinv:           uint16(positive(st.loadPower - st.gridPower)),
+		Prec:           uint16(positive(st.gridPower - st.loadPower)),
+		PF:             1000,
+		VepsR:          uint16(math.Round(st.gridVoltage * 10)),
+		Feps:           uint16(math.Round(st.frequency * 100)),
+		Ptogrid:        uint16(positive(-st.gridPower)),
+		Ptouser:        uint16(positive(st.gridPower)),
+		Vbus1:          3900,
+		Vbus2:          3200,
+		Tinner:         uint16(math.Round(st.mosfetTemp)),
+		Tradiator1:     uint16(math.Round(st.mosfetTemp + 5)),
+		Tradiator2:     uint16(math.Round(st.mosfetTemp + 4)),
+		Tbat:           uint16(math.Round(st.temps[0])),
+		RunningTime:    uint32(st.uptime),
+		BatParallelNum: 1,
+		BatCapacity:    fullCapacity,
+		BatCurrentBMS:  int16(math.Round(st.current * 100)),
+		MaxCellVoltBMS: hi,
+		MinCellVoltBMS: lo,
+		MaxCellTempBMS: int16(math.Round(st.temps[3] * 10)),
+		MinCellTempBMS: int16(math.Round(st.temps[0] * 10)),
+		CycleCntBMS:    uint16(st.cycles),
+	}
+}
+
+func (st *state) eg46000XPRealtimeData() *eg4_6000xp.RealtimeData {
+	lo, hi := st.minMaxCells()
+	return &eg4_6000xp.RealtimeData{
+		State:           0xC0, // PV+battery off-grid mode.
+		Vpv1:            3800,
+		Vbat:            uint16(math.Round(st.voltage * 10)),
+		SOC:             uint16(math.Round(st.soc)),
+		SOH:             99,
+		Ppv1:            uint16(st.pvPower),
+		Pcharge:         uint16(positive(st.batteryPower())),
+		Pdischarge:      uint16(positive(-st.batteryPower())),
+		VacR:            uint16(math.Round(st.gridVoltage * 10)),
+		Fac:             uint16(math.Round(st.frequency * 100)),
+		Pinv:            uint16(positive(st.loadPower - st.gridPower)),
+		Prec:            uint16(positive(st.gridPower - st.loadPower)),
+		PF:              1000,
+		VepsR:           uint16(math.Round(st.gridVoltage * 10)),
+		Feps:            uint16(math.Round(st.frequency * 100)),
+		Peps:            uint16(st.loadPower),
+		Seps:            uint16(st.loadPower),
+		Ptogrid:         uint16(positive(-st.gridPower)),
+		Ptouser:         uint16(positive(st.gridPower)),
+		Vbus1:           3900,
+		Vbus2:           3200,
+		Tinner:          uint16(math.Round(st.mosfetTemp)),
+		Tradiator1:      uint16(math.Round(st.mosfetTemp + 5)),
+		Tradiator2:      uint16(math.Round(st.mosfetTemp + 4)),
+		Tbat:            uint16(math.Round(st.temps[0])),
+		RunningTime:     uint32(st.uptime),
+		BatParallelNum:  1,
+		BatCapacity:     fullCapacity,
+		BatCurrentBMS:   int16(math.Round(st.current * 100)),
+		MaxCellVoltBMS:  hi,
+		MinCellVoltBMS:  lo,
+		MaxCellTempBMS:  int16(math.Round(st.temps[3] * 10)),
+		MinCellTempBMS:  int16(math.Round(st.temps[0] * 10)),
+		CycleCntBMS:     uint16(st.cycles),
+		OnGridLoadPower: uint16(st.loadPower),
+	}
+}
+
+// round1 rounds 'v' to one decimal, which is what pi30 responses have.
+func round1(v float64) float32 {
+	return float32(math.Round(v*10) / 10)
+}
+
+func (st *state) deviceStatus() uint8 {
+	status := uint8(0x10) // Load on.
+	if st.charging() {
+		status |= 0x04 | 0x02 // Charging from the SCC.
+	}
+	return status
+}
+
+func (st *state) qpigs() *pi30.QPIGSResponse {
+	pvCurrent := st.pvPower / 380
+	return &pi30.QPIGSResponse{
+		GridVoltage:                 round1(st.gridVoltage),
+		GridFrequency:               round1(st.frequency),
+		ACOutputVoltage:             round1(st.gridVoltage),
+		ACOutputFrequency:           round1(st.frequency),
+		AcOutputApparentPower:       int16(st.loadPower * 1.05),
+		AcOutputActivePower:         int16(st.loadPower),
+		OutputLoadPercentage:        int8(st.loadPower * 100 / 6500),
+		BusVoltage:                  390,
+		BatteryVoltage:              round1(st.voltage),
+		BatteryChargingCurrent:      int16(positive(st.current)),
+		BatteryCapacity:             int8(math.Round(st.soc)),
+		InverterHeatSinkTemperature: int8(math.Round(st.mosfetTemp)),
+		PV1InputVoltage:             380,
+		PV1InputCurrent:             round1(pvCurrent),
+		BatteryVoltageSCC:           round1(st.voltage),
+		BatteryDischargeCurrent:     int16(positive(-st.current)),
+		DeviceStatus:                st.deviceStatus(),
+		PV1ChargingPower:            int16(st.pvPower),
+		DeviceStatusFlags:           10,
+	}
+}
+
+func (st *state) qpigs2() *pi30.QPIGS2Response {
+	return &pi30.QPIGS2Response{
+		PV2InputCurrent:  round1(st.pvPower / 2 / 380),
+		PV2InputVoltage:  380,
+		PV2ChargingPower: int16(st.pvPower / 2),
+	}
+}
+
+func (st *state) q1() *pi30.Q1Response {
+	status := int8(10) // Not charging.
+	if st.charging() {
+		status = 11 // Bulk stage.
+	}
+	return &pi30.Q1Response{
+		SccCommunicating:       1,
+		SccPwmTemperature:      int8(math.Round(st.mosfetTemp)),
+		InverterTemperature:    int8(math.Round(st.mosfetTemp + 5)),
+		BatteryTemperature:     int8(math.Round(st.temps[0])),
+		TransformerTemperature: int8(math.Round(st.mosfetTemp + 8)),
+		FanPwmSpeed:            int8(30 + st.loadPower/100),
+		SccChargePower:         int16(st.pvPower),
+		SyncFrequency:          round1(st.frequency),
+		InverterChargeStatus:   status,
+	}
+}
+
+func qpiri() *pi30.QPIRIResponse {
+	return &pi30.QPIRIResponse{
+		GridRatingVoltage:           240,
+		GridRatingCurrent:           27.1,
+		ACOutputRatingVoltage:       240,
+		ACOutputRatingFrequency:     60,
+		ACOutputRatingCurrent:       27.1,
+		AcOutputRatingApparentPower: 6500,
+		AcOutputRatingActivePower:   6500,
+		BatteryVoltage:              48,
+		BatteryRechargeVoltage:      51,
+		BatteryUnderVoltage:         48,
+		BatteryBulkVoltage:          56.4,
+		BatteryFloatVoltage:         54,
+		BatteryType:                 2,
+		MaxACChargingCurrent:        30,
+		MaxChargingCurrent:          120,
+		OutputSourcePriority:        2,
+		ChargerSourcePriority:       3,
+		ParallelMaxNum:              9,
+		MachineType:                 1,
+		Topology:                    0,
+		BatteryRedischargeVoltage:   54,
+		MaxChargingTimeAtCV:         120,
+		MaxDischargingCurrent:       120,
+	}
+}
+
+func (st *state) qpgs(n int) *pi30.QPGSResponse {
+	mode := "B" // Battery.
+	if st.gridPower > 0 {
+		mode = "L" // Line.
+	}
+	return &pi30.QPGSResponse{
+		Instance:                   n,
+		Serial:                     serialNumber("9293200410", uint8(n), 14),
+		WorkMode:                   mode,
+		GridVoltage:                round1(st.gridVoltage),
+		GridFrequency:              round1(st.frequency),
+		ACOutputVoltage:            round1(st.gridVoltage),
+		ACOutputFrequency:          round1(st.frequency),
+		AcOutputApparentPower:      int16(st.loadPower * 1.05),
+		AcOutputActivePower:        int16(st.loadPower),
+		LoadPercentage:             int8(st.loadPower * 100 / 6500),
+		BatteryVoltage:             round1(st.voltage),
+		BatteryChargingCurrent:     int16(positive(st.current)),
+		BatteryCapacity:            int8(math.Round(st.soc)),
+		PV1InputVoltage:            380,
+		TotalChargingCurrent:       int16(positive(st.current)),
+		TotalACOutputApparentPower: int16(st.loadPower * 1.05),
+		TotalOutputActivePower:     int16(st.loadPower),
+		TotalACOutputPercentage:    int8(st.loadPower * 100 / 6500),
+		InverterStatus:             "00010010",
+		OutputMode:                 1,
+		ChargerSourcePriority:      3,
+		MaxChargerCurrent:          120,
+		MaxChargingRange:           120,
+		MaxACChargerCurrent:        30,
+		PV1InputCurrent:            round1(st.pvPower / 380),
+		BatteryDischargeCurrent:    int16(positive(-st.current)),
+		PV2InputVoltage:            0,
+	}
+}
+
+// encodeStruct returns the fields of the struct pointed by 'v' in big endian order, the way
+// the bms package reads them.
+func encodeStruct(v any) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, v)
+	return buf.Bytes()
+}
+
+// setStruct stores the struct pointed by 'v' in the registers starting at 'start'.
+func setStruct(image *modbus.RegisterImage, id uint8, function modbus.RTUFunction, start uint16, v any) {
+	image.Set(id, function, start, encodeStruct(v))
+}
+
+// setFields stores each field of the struct pointed by 'v' in the register in its modbus tag.
+// uint32 fields take two registers, in the same byte order as the 16-bit ones.
+func setFields(image *modbus.RegisterImage, id uint8, function modbus.RTUFunction, order binary.AppendByteOrder, v any) {
+	stValue := reflect.ValueOf(v).Elem()
+	stType := stValue.Type()
+	for i := range stType.NumField() {
+		address, err := strconv.ParseUint(stType.Field(i).Tag.Get("modbus"), 10, 16)
+		if err != nil {
+			continue
+		}
+		var data []byte
+		f := stValue.Field(i)
+		switch f.Kind() {
+		case reflect.Uint16:
+			data = order.AppendUint16(nil, uint16(f.Uint()))
+		case reflect.Int16:
+			data = order.AppendUint16(nil, uint16(f.Int()))
+		case reflect.Uint32:
+			data = order.AppendUint32(nil, uint32(f.Uint()))
+		default:
+			continue
+		}
+		image.Set(id, function, uint16(address), data)
+	}
+}
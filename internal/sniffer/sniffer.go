@@ -0,0 +1,157 @@
+// Package sniffer decodes the frames forwarded between a controller and a subordinate device.
+package sniffer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"wombatt/internal/modbus"
+	"wombatt/internal/pi30"
+)
+
+// Direction is the direction of the data forwarded.
+type Direction int
+
+const (
+	// Request is used for data sent by the controller.
+	Request Direction = iota
+	// Response is used for data sent by the subordinate device.
+	Response
+)
+
+func (d Direction) String() string {
+	if d == Request {
+		return "request"
+	}
+	return "response"
+}
+
+type protocol struct {
+	name string
+	// split returns the length of the frame at the start of the data, 0 if more data is needed,
+	// or -1 if there is no frame for this protocol. The bool is true if the checksum is valid.
+	split func(data []byte, request bool) (int, bool)
+	// describe returns a description of the frame. For responses, req is the last request, if any.
+	describe func(frame []byte, req []byte, request bool) string
+}
+
+var protocols = []protocol{
+	{
+		name:     modbus.RTUProtocol,
+		split:    modbus.SplitRTU,
+		describe: modbus.DescribeRTU,
+	},
+	{
+		name:     modbus.TCPProtocol,
+		split:    modbus.SplitTCP,
+		describe: modbus.DescribeTCP,
+	},
+	{
+		name:     modbus.Lifepower4Protocol,
+		split:    modbus.SplitLFP4,
+		describe: func(frame []byte, _ []byte, request bool) string { return modbus.DescribeLFP4(frame, request) },
+	},
+	{
+		name:     "pi30",
+		split:    pi30.SplitFrame,
+		describe: func(frame []byte, _ []byte, _ bool) string { return pi30.DescribeFrame(frame) },
+	},
+}
+
+// Decoder splits the data forwarded in each direction into frames, and writes a description of
+// each frame. Responses are decoded using the last request of the same protocol.
+// It is safe for concurrent use.
+type Decoder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	now     func() time.Time
+	pending [2][]byte
+	req     []byte
+	reqName string
+}
+
+func NewDecoder(w io.Writer) *Decoder {
+	return &Decoder{w: w, now: time.Now}
+}
+
+// Add adds the data forwarded in direction 'dir', and writes the description of the frames completed.
+func (d *Decoder) Add(dir Direction, data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[dir] = append(d.pending[dir], data...)
+	for d.next(dir) {
+	}
+}
+
+// next decodes the data at the start of the pending data for 'dir'. It returns false if more
+// data is needed.
+func (d *Decoder) next(dir Direction) bool {
+	data := d.pending[dir]
+	if len(data) == 0 {
+		return false
+	}
+	request := dir == Request
+	p, n, ok, wait := find(data, request)
+	if !ok {
+		if wait {
+			return false
+		}
+		if p == nil {
+			d.unknown(dir, 1)
+			return true
+		}
+		// Bad checksum. Look for a valid frame starting within this one before using it.
+		for i := 1; i < n; i++ {
+			if _, _, ok, _ := find(data[i:], request); ok {
+				d.unknown(dir, i)
+				return true
+			}
+		}
+	}
+	frame := data[:n]
+	var req []byte
+	if request {
+		d.req, d.reqName = frame, p.name
+	} else if d.reqName == p.name {
+		req = d.req
+		d.req, d.reqName = nil, ""
+	}
+	fmt.Fprintf(d.w, "%s %-8s %s %s: %s\n", d.now().Format("15:04:05.000"), dir, p.name, hex.EncodeToString(frame), p.describe(frame, req, request))
+	d.pending[dir] = data[n:]
+	return true
+}
+
+// find returns the first protocol with a valid frame at the start of 'data'. If there is none,
+// it returns the first protocol with a complete frame with an invalid checksum, and 'wait' is true
+// if any protocol needs more data.
+func find(data []byte, request bool) (p *protocol, n int, ok bool, wait bool) {
+	for i := range protocols {
+		l, valid := protocols[i].split(data, request)
+		switch {
+		case l > 0 && valid:
+			return &protocols[i], l, true, false
+		case l > 0 && p == nil:
+			p, n = &protocols[i], l
+		case l == 0:
+			wait = true
+		}
+	}
+	return p, n, false, wait
+}
+
+// unknown writes the first 'n' bytes of the pending data for 'dir' as unknown, and discards them.
+// Consecutive unknown bytes are written together.
+func (d *Decoder) unknown(dir Direction, n int) {
+	data := d.pending[dir]
+	for n < len(data) {
+		if p, _, _, wait := find(data[n:], dir == Request); p != nil || wait {
+			break
+		}
+		n++
+	}
+	fmt.Fprintf(d.w, "%s %-8s unknown data: %s\n", d.now().Format("15:04:05.000"), dir, hex.EncodeToString(data[:n]))
+	d.pending[dir] = data[n:]
+}
@@ -0,0 +1,102 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+type chunk struct {
+	dir  Direction
+	data string // hex
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		chunks []chunk
+		want   []string
+	}{
+		{ // RTU request and response, split across reads
+			chunks: []chunk{
+				{Request, "1103006b"},
+				{Request, "00037687"},
+				{Response, "110306ae41"},
+				{Response, "5652434049ad"},
+			},
+			want: []string{
+				"request  ModbusRTU 1103006b00037687: ID 17 read holding registers: address 107, count 3 (CRC ok)",
+				"response ModbusRTU 110306ae415652434049ad: ID 17 read holding registers: 107=0xae41 108=0x5652 109=0x4340 (CRC ok)",
+			},
+		},
+		{ // Response without a request, and exception
+			chunks: []chunk{
+				{Response, "110306ae415652434049ad"},
+				{Response, "1186018265"},
+			},
+			want: []string{
+				"response ModbusRTU 110306ae415652434049ad: ID 17 read holding registers: 6 bytes: 0xae41 0x5652 0x4340 (CRC ok)",
+				"response ModbusRTU 1186018265: ID 17 write single register: exception: illegal function (CRC ok)",
+			},
+		},
+		{ // Garbage before a frame, and CRC error
+			chunks: []chunk{
+				{Request, "00ff" + "1106000100039a9b"},
+				{Response, "1106000100039a9c"},
+			},
+			want: []string{
+				"request  unknown data: 00ff",
+				"request  ModbusRTU 1106000100039a9b: ID 17 write single register: address 1, value 0x0003 (CRC ok)",
+				"response ModbusRTU 1106000100039a9c: ID 17 write single register: address 1, value/count 3 (CRC error: got 9c9a, want 9b9a)",
+			},
+		},
+		{ // Modbus TCP
+			chunks: []chunk{
+				{Request, "0001000000061103006b0003"},
+				{Response, "000100000009110306ae4156524340"},
+			},
+			want: []string{
+				"request  ModbusTCP 0001000000061103006b0003: TID 1 ID 17 read holding registers: address 107, count 3",
+				"response ModbusTCP 000100000009110306ae4156524340: TID 1 ID 17 read holding registers: 107=0xae41 108=0x5652 109=0x4340",
+			},
+		},
+		{ // LFP4
+			chunks: []chunk{
+				{Request, "7e323030313441343230303030464441320d"},
+			},
+			want: []string{
+				"request  lifepower4 7e323030313441343230303030464441320d: ADR 1 CID2 0x42: info '' (CHKSUM ok)",
+			},
+		},
+		{ // PI30
+			chunks: []chunk{
+				{Request, hex.EncodeToString([]byte("QPIGS\xb7\xa9\r"))},
+				{Response, hex.EncodeToString([]byte("(2023081415283\xae\xf1\r"))},
+				{Response, hex.EncodeToString([]byte("(2023081415283\x0e\xf1\r"))},
+			},
+			want: []string{
+				"request  pi30 5150494753b7a90d: QPIGS (CRC ok)",
+				"response pi30 2832303233303831343135323833aef10d: (2023081415283 (CRC ok)",
+				"response pi30 28323032333038313431353238330ef10d: (2023081415283 (CRC error: got 0ef1, want aef1)",
+			},
+		},
+	}
+
+	for tid, tt := range tests {
+		var out bytes.Buffer
+		d := NewDecoder(&out)
+		d.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC) }
+		for _, c := range tt.chunks {
+			data, _ := hex.DecodeString(c.data)
+			d.Add(c.dir, data)
+		}
+		var want strings.Builder
+		for _, l := range tt.want {
+			want.WriteString("03:04:05.006 " + l + "\n")
+		}
+		if got := out.String(); got != want.String() {
+			t.Errorf("wrong output (%d):\ngot:\n%s\nwant:\n%s", tid, got, want.String())
+		}
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"wombatt/cmd"
+	"wombatt/internal/common"
+	"wombatt/internal/simulator"
 
 	"github.com/alecthomas/kong"
 	kongyaml "github.com/alecthomas/kong-yaml"
@@ -57,11 +60,18 @@ func main() {
 		kong.Bind(&cli.Globals),
 		kong.BindTo(ctx, (*context.Context)(nil)),
 		kong.Vars{
-			"bms_types":    "EG4LLv2,lifepower4,lifepowerv2,pacemodbus",
-			"device_types": "serial,hidraw,tcp",
-			"protocols":    "auto,ModbusRTU,ModbusTCP,lifepower4",
+			"bms_types":        "daly,EG4LLv2,jbd,jkbms,lifepower4,lifepowerv2,pacemodbus,pylontech,seplosv2,seplosv3",
+			"device_types":     "serial,hidraw,tcp,replay,pty,rfc2217,udp",
+			"protocols":        "auto,ModbusRTU,ModbusTCP,ModbusRTUoverTCP,ModbusASCII,lifepower4,daly,seplosv2,pylontech,jbd,jk",
+			"simulator_models": strings.Join(simulator.Models, ","),
 		})
 	logSetup(cli.Globals.LogLevel)
+	if cli.Globals.Capture != "" {
+		capture, f, err := common.CreateCapture(cli.Globals.Capture)
+		kctx.FatalIfErrorf(err)
+		defer f.Close()
+		common.SetCapture(capture)
+	}
 	err := kctx.Run()
 	kctx.FatalIfErrorf(err)
 }